@@ -1,3 +1,9 @@
 module github.com/fatbrother/virtual-file-system
 
 go 1.18
+
+require (
+	github.com/rivo/uniseg v0.4.7
+	golang.org/x/crypto v0.14.0
+	golang.org/x/text v0.13.0
+)
@@ -0,0 +1,128 @@
+package acl
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Permission is a level of access granted to a principal
+type Permission int
+
+const (
+	// Read allows listing and viewing
+	Read Permission = iota + 1
+	// Write allows creating, changing and deleting, and implies Read
+	Write
+)
+
+// ParsePermission converts "read" or "write" into a Permission
+func ParsePermission(s string) (Permission, error) {
+	switch strings.ToLower(s) {
+	case "read":
+		return Read, nil
+	case "write":
+		return Write, nil
+	}
+	return 0, errors.New("The " + s + " is not a valid permission.")
+}
+
+func (p Permission) String() string {
+	switch p {
+	case Read:
+		return "read"
+	case Write:
+		return "write"
+	}
+	return "none"
+}
+
+// ACL records who owns an entity and who else may access it.
+// Principals are identified by their lookup keys.
+type ACL struct {
+	Owner   string
+	Readers map[string]bool
+	Writers map[string]bool
+}
+
+// New creates an ACL owned by owner with no other grants
+func New(owner string) *ACL {
+	return &ACL{
+		Owner:   owner,
+		Readers: make(map[string]bool),
+		Writers: make(map[string]bool),
+	}
+}
+
+// Clone returns an independent copy of the ACL
+func (a *ACL) Clone() *ACL {
+	c := New(a.Owner)
+	for principal := range a.Readers {
+		c.Readers[principal] = true
+	}
+	for principal := range a.Writers {
+		c.Writers[principal] = true
+	}
+	return c
+}
+
+// Grant gives principal the permission, replacing any previous grant
+func (a *ACL) Grant(principal string, p Permission) {
+	delete(a.Readers, principal)
+	delete(a.Writers, principal)
+
+	switch p {
+	case Read:
+		a.Readers[principal] = true
+	case Write:
+		a.Writers[principal] = true
+	}
+}
+
+// Revoke removes any permission granted to principal
+func (a *ACL) Revoke(principal string) {
+	delete(a.Readers, principal)
+	delete(a.Writers, principal)
+}
+
+// PermissionOf returns the permission principal holds, or 0 if none
+func (a *ACL) PermissionOf(principal string) Permission {
+	switch {
+	case principal == a.Owner || a.Writers[principal]:
+		return Write
+	case a.Readers[principal]:
+		return Read
+	}
+	return 0
+}
+
+// Allows reports whether principal holds at least permission p
+func (a *ACL) Allows(principal string, p Permission) bool {
+	return a.PermissionOf(principal) >= p
+}
+
+// AllowsAny reports whether any of the principals holds at least permission p,
+// such as a user or one of the groups they belong to
+func (a *ACL) AllowsAny(principals []string, p Permission) bool {
+	for _, principal := range principals {
+		if a.Allows(principal, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Grants returns the principals other than the owner holding permission exactly p, sorted
+func (a *ACL) Grants(p Permission) []string {
+	set := a.Readers
+	if p == Write {
+		set = a.Writers
+	}
+
+	principals := make([]string, 0, len(set))
+	for principal := range set {
+		principals = append(principals, principal)
+	}
+	sort.Strings(principals)
+	return principals
+}
@@ -0,0 +1,86 @@
+package acl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestACL(t *testing.T) {
+	a := New("owner")
+	a.Grant("reader", Read)
+	a.Grant("writer", Write)
+
+	tests := []struct {
+		name      string
+		principal string
+		want      Permission
+	}{
+		{"Owner", "owner", Write},
+		{"Reader", "reader", Read},
+		{"Writer", "writer", Write},
+		{"Stranger", "stranger", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := a.PermissionOf(tt.principal); got != tt.want {
+				t.Errorf("PermissionOf(%q) = %v, want %v", tt.principal, got, tt.want)
+			}
+			if got := a.Allows(tt.principal, Read); got != (tt.want >= Read) {
+				t.Errorf("Allows(%q, Read) = %v", tt.principal, got)
+			}
+		})
+	}
+
+	a.Grant("reader", Write)
+	if !reflect.DeepEqual(a.Grants(Write), []string{"reader", "writer"}) || len(a.Grants(Read)) != 0 {
+		t.Errorf("Grant() did not replace the previous permission: read %v, write %v", a.Grants(Read), a.Grants(Write))
+	}
+
+	a.Revoke("writer")
+	if a.Allows("writer", Read) {
+		t.Errorf("Revoke() left access for writer")
+	}
+
+	a.Grant("@team", Read)
+	if !a.AllowsAny([]string{"stranger", "@team"}, Read) || a.AllowsAny([]string{"stranger", "@team"}, Write) || a.AllowsAny(nil, Read) {
+		t.Errorf("AllowsAny() did not combine the principals' permissions")
+	}
+}
+
+func TestParsePermission(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Permission
+		wantErr bool
+	}{
+		{"read", Read, false},
+		{"WRITE", Write, false},
+		{"admin", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParsePermission(tt.input)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ParsePermission(%q) = %v, %v", tt.input, got, err)
+			}
+		})
+	}
+}
+
+func TestACL_Clone(t *testing.T) {
+	a := New("owner")
+	a.Grant("reader", Read)
+
+	c := a.Clone()
+	c.Grant("writer", Write)
+	c.Revoke("reader")
+
+	if !a.Allows("reader", Read) || a.Allows("writer", Read) {
+		t.Errorf("changing a clone changed the original: %+v", a)
+	}
+	if c.Owner != "owner" || c.Allows("reader", Read) || !c.Allows("writer", Write) {
+		t.Errorf("Clone() = %+v", c)
+	}
+}
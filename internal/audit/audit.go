@@ -0,0 +1,335 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Results of an operation
+const (
+	ResultOK     = "ok"
+	ResultDenied = "denied"
+	ResultError  = "error"
+	// ResultRolledBack marks an operation that succeeded inside a transaction that was rolled back
+	ResultRolledBack = "rolled-back"
+)
+
+// Record is one entry of the audit log. Hash covers every other field and
+// the hash of the record before it, so changing, removing or reordering
+// records breaks the chain.
+type Record struct {
+	Seq      uint64    `json:"seq"`
+	Time     time.Time `json:"time"`
+	Actor    string    `json:"actor"`
+	Op       string    `json:"op"`
+	Target   string    `json:"target"`
+	Result   string    `json:"result"`
+	Error    string    `json:"error,omitempty"`
+	PrevHash string    `json:"prev_hash"`
+	Hash     string    `json:"hash"`
+}
+
+// sum returns the hash of the record's contents chained to its PrevHash
+func (r Record) sum() string {
+	h := sha256.New()
+	for _, field := range []string{
+		strconv.FormatUint(r.Seq, 10),
+		r.Time.UTC().Format(time.RFC3339Nano),
+		r.Actor,
+		r.Op,
+		r.Target,
+		r.Result,
+		r.Error,
+		r.PrevHash,
+	} {
+		// Length prefixes keep field boundaries unambiguous
+		h.Write([]byte(strconv.Itoa(len(field)) + ":" + field))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Format prints the record details. Operations without an actor, such as
+// registering, show "-" in its place.
+func (r Record) Format() string {
+	actor := r.Actor
+	if actor == "" {
+		actor = "-"
+	}
+	line := strconv.FormatUint(r.Seq, 10) + " " + r.Time.Format(time.RFC3339) + " " + actor + " " + r.Op + " " + r.Target + " " + r.Result
+	if r.Error != "" {
+		line += ": " + r.Error
+	}
+	return line
+}
+
+// Filter selects records. Empty fields match every record.
+type Filter struct {
+	Actor string
+	Op    string
+	Since time.Time
+}
+
+// Match reports whether r passes the filter. Actors and operations are compared case-insensitively.
+func (f Filter) Match(r Record) bool {
+	if f.Actor != "" && !strings.EqualFold(f.Actor, r.Actor) {
+		return false
+	}
+	if f.Op != "" && !strings.EqualFold(f.Op, r.Op) {
+		return false
+	}
+	return f.Since.IsZero() || !r.Time.Before(f.Since)
+}
+
+// Log is an append-only, hash-chained audit log. Records are kept in memory
+// and, for a log opened from a file, appended to it as JSON lines.
+type Log struct {
+	mu      sync.Mutex
+	records []Record
+	path    string
+	w       io.Writer
+
+	// queue holds posted records until a goroutine appends them; posted and
+	// appended count them so readers can wait for the ones posted before them
+	qmu      sync.Mutex
+	queue    []Record
+	draining bool
+	posted   uint64
+	appended uint64
+	idle     *sync.Cond
+}
+
+// NewLog creates an empty log that only lives in memory
+func NewLog() *Log {
+	return &Log{}
+}
+
+// Open opens the log stored at path, creating the file if needed. New
+// records continue the chain of the ones already in the file. The file is
+// not verified; use Verify for that.
+func Open(path string) (*Log, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("audit log: %w", err)
+	}
+	records, err := decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("audit log %s: %w", path, err)
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("audit log: %w", err)
+	}
+	return &Log{records: records, path: path, w: f}, nil
+}
+
+// Append adds a record for an operation, filling in its sequence number,
+// time and hashes, and returns it. Records posted before are appended first.
+func (l *Log) Append(actor, op, target, result, errText string) (Record, error) {
+	l.flush()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.appendNoLock(newRecord(actor, op, target, result, errText))
+}
+
+// Post queues a record for an operation to be appended in the background,
+// so callers wait neither for other appends nor for the file. Records are
+// appended in the order they are posted. Query, Verify and Close wait for
+// the records posted before them, and a record that cannot be written is
+// left as a gap for Verify to report.
+func (l *Log) Post(actor, op, target, result, errText string) {
+	l.qmu.Lock()
+	defer l.qmu.Unlock()
+
+	l.queue = append(l.queue, newRecord(actor, op, target, result, errText))
+	l.posted++
+	if !l.draining {
+		l.draining = true
+		go l.drain()
+	}
+}
+
+// drain appends posted records until the queue is empty
+func (l *Log) drain() {
+	for {
+		l.qmu.Lock()
+		batch := l.queue
+		l.queue = nil
+		if len(batch) == 0 {
+			l.draining = false
+			l.qmu.Unlock()
+			return
+		}
+		l.qmu.Unlock()
+
+		l.mu.Lock()
+		for _, r := range batch {
+			_, _ = l.appendNoLock(r)
+		}
+		l.mu.Unlock()
+
+		l.qmu.Lock()
+		l.appended += uint64(len(batch))
+		l.idleNoLock().Broadcast()
+		l.qmu.Unlock()
+	}
+}
+
+// flush waits until the records posted so far have been appended
+func (l *Log) flush() {
+	l.qmu.Lock()
+	defer l.qmu.Unlock()
+
+	for target := l.posted; l.appended < target; {
+		l.idleNoLock().Wait()
+	}
+}
+
+// idleNoLock returns the condition signalled as posted records are appended
+func (l *Log) idleNoLock() *sync.Cond {
+	if l.idle == nil {
+		l.idle = sync.NewCond(&l.qmu)
+	}
+	return l.idle
+}
+
+// newRecord returns a record for an operation happening now
+func newRecord(actor, op, target, result, errText string) Record {
+	return Record{
+		Time:   time.Now().UTC(),
+		Actor:  actor,
+		Op:     op,
+		Target: target,
+		Result: result,
+		Error:  errText,
+	}
+}
+
+// appendNoLock fills in the sequence number and hashes of r and adds it
+func (l *Log) appendNoLock(r Record) (Record, error) {
+	r.Seq = 1
+	if n := len(l.records); n > 0 {
+		r.Seq = l.records[n-1].Seq + 1
+		r.PrevHash = l.records[n-1].Hash
+	}
+	r.Hash = r.sum()
+	l.records = append(l.records, r)
+
+	// A record that cannot be written leaves a gap that Verify reports
+	if l.w != nil {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return r, err
+		}
+		if _, err := l.w.Write(append(line, '\n')); err != nil {
+			return r, fmt.Errorf("audit log: %w", err)
+		}
+	}
+	return r, nil
+}
+
+// Close closes the file of a log opened with Open
+func (l *Log) Close() error {
+	l.flush()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if c, ok := l.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Query returns the records passing the filter, oldest first
+func (l *Log) Query(f Filter) []Record {
+	l.flush()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var records []Record
+	for _, r := range l.records {
+		if f.Match(r) {
+			records = append(records, r)
+		}
+	}
+	return records
+}
+
+// Verify checks the hash chain and returns the number of records checked.
+// A log opened from a file is read back from the file, so changes made to
+// it behind the log's back are found, and the file must end with the last
+// record the log holds, so records removed from its end are found too. The
+// chain cannot show such removals by itself: once the log is reopened, the
+// file is all there is to compare.
+func (l *Log) Verify() (int, error) {
+	l.flush()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.path == "" {
+		return len(l.records), Verify(l.records)
+	}
+
+	data, err := os.ReadFile(l.path)
+	if err != nil {
+		return 0, fmt.Errorf("audit log: %w", err)
+	}
+	records, err := decode(data)
+	if err != nil {
+		return 0, fmt.Errorf("audit log %s: %w", l.path, err)
+	}
+	if err := Verify(records); err != nil {
+		return len(records), err
+	}
+	if n := len(l.records); len(records) != n || (n > 0 && records[n-1].Hash != l.records[n-1].Hash) {
+		return len(records), fmt.Errorf("The audit log file has %d records, but %d were written.", len(records), n)
+	}
+	return len(records), nil
+}
+
+// Verify checks that records form an unbroken hash chain starting at sequence number 1
+func Verify(records []Record) error {
+	prev := ""
+	for i, r := range records {
+		if r.Seq != uint64(i)+1 {
+			return fmt.Errorf("Audit record %d is out of sequence (expected %d).", r.Seq, i+1)
+		}
+		if r.PrevHash != prev {
+			return fmt.Errorf("Audit record %d does not follow record %d.", r.Seq, i)
+		}
+		if r.sum() != r.Hash {
+			return fmt.Errorf("Audit record %d has been modified.", r.Seq)
+		}
+		prev = r.Hash
+	}
+	return nil
+}
+
+// decode reads records written as JSON lines
+func decode(data []byte) ([]Record, error) {
+	var records []Record
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		records = append(records, r)
+	}
+	return records, scanner.Err()
+}
@@ -0,0 +1,123 @@
+package audit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLog_AppendAndVerify(t *testing.T) {
+	l := NewLog()
+	_, _ = l.Append("alice", "CreateFolder", "alice/docs", ResultOK, "")
+	r, _ := l.Append("bob", "DeleteFolder", "alice/docs", ResultDenied, "Permission denied")
+	if r.Seq != 2 || r.PrevHash == "" || r.Hash == r.PrevHash {
+		t.Errorf("Append() = %+v", r)
+	}
+	if n, err := l.Verify(); n != 2 || err != nil {
+		t.Errorf("Verify() = %d, %v", n, err)
+	}
+
+	tests := []struct {
+		name    string
+		tamper  func(records []Record) []Record
+		wantErr string
+	}{
+		{"Modified", func(r []Record) []Record { r[0].Result = ResultError; return r }, "Audit record 1 has been modified."},
+		{"Removed", func(r []Record) []Record { return r[1:] }, "Audit record 2 is out of sequence (expected 1)."},
+		{"Reordered", func(r []Record) []Record { r[0].Seq, r[1].Seq = 2, 1; return []Record{r[1], r[0]} }, "Audit record 1 does not follow record 0."},
+		{"Rehashed", func(r []Record) []Record { r[0].Actor = "carol"; r[0].Hash = r[0].sum(); return r }, "Audit record 2 does not follow record 1."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records := tt.tamper(l.Query(Filter{}))
+			if err := Verify(records); err == nil || err.Error() != tt.wantErr {
+				t.Errorf("Verify() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLog_Post(t *testing.T) {
+	l := NewLog()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				l.Post(fmt.Sprintf("user%d", i), "CreateFile", fmt.Sprintf("user%d/docs/%d.txt", i, j), ResultOK, "")
+			}
+		}(i)
+	}
+	wg.Wait()
+	_, _ = l.Append("admin", "QueryAudit", "audit", ResultOK, "")
+
+	records := l.Query(Filter{})
+	if len(records) != 401 || records[400].Actor != "admin" {
+		t.Fatalf("Query() returned %d records, want the 400 posted before the appended one", len(records))
+	}
+	next := make(map[string]int)
+	for _, r := range records[:400] {
+		if want := fmt.Sprintf("%s/docs/%d.txt", r.Actor, next[r.Actor]); r.Target != want {
+			t.Fatalf("record %d is %s, want %s", r.Seq, r.Target, want)
+		}
+		next[r.Actor]++
+	}
+	if n, err := l.Verify(); n != 401 || err != nil {
+		t.Errorf("Verify() = %d, %v", n, err)
+	}
+}
+
+func TestLog_Query(t *testing.T) {
+	l := NewLog()
+	_, _ = l.Append("alice", "CreateFolder", "alice/docs", ResultOK, "")
+	_, _ = l.Append("bob", "CreateFolder", "bob/docs", ResultOK, "")
+	_, _ = l.Append("Alice", "DeleteFolder", "alice/docs", ResultOK, "")
+
+	if got := l.Query(Filter{Actor: "alice"}); len(got) != 2 || got[1].Op != "DeleteFolder" {
+		t.Errorf("Query(actor) = %v", got)
+	}
+	if got := l.Query(Filter{Op: "createfolder", Actor: "bob"}); len(got) != 1 || got[0].Target != "bob/docs" {
+		t.Errorf("Query(op, actor) = %v", got)
+	}
+	if got := l.Query(Filter{Since: time.Now().Add(time.Hour)}); len(got) != 0 {
+		t.Errorf("Query(since) = %v", got)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	_, _ = l.Append("alice", "CreateFolder", "alice/docs", ResultOK, "")
+	_ = l.Close()
+
+	// Reopening continues the chain
+	l, _ = Open(path)
+	if r, _ := l.Append("alice", "DeleteFolder", "alice/docs", ResultOK, ""); r.Seq != 2 {
+		t.Errorf("Append() after reopening = %+v", r)
+	}
+	if n, err := l.Verify(); n != 2 || err != nil {
+		t.Errorf("Verify() = %d, %v", n, err)
+	}
+
+	// Editing the file is found even though the records in memory are intact
+	data, _ := os.ReadFile(path)
+	_ = os.WriteFile(path, []byte(strings.Replace(string(data), "DeleteFolder", "CreateFolder", 1)), 0o600)
+	if _, err := l.Verify(); err == nil || err.Error() != "Audit record 2 has been modified." {
+		t.Errorf("Verify() after editing the file error = %v", err)
+	}
+
+	// Cutting records off the end leaves a valid chain, but not the records written
+	_ = os.WriteFile(path, data[:strings.Index(string(data), "\n")+1], 0o600)
+	if n, err := l.Verify(); n != 1 || err == nil || err.Error() != "The audit log file has 1 records, but 2 were written." {
+		t.Errorf("Verify() after truncating the file = %d, %v", n, err)
+	}
+	_ = l.Close()
+}
@@ -0,0 +1,1468 @@
+package command
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatbrother/virtual-file-system/internal/acl"
+	"github.com/fatbrother/virtual-file-system/internal/audit"
+	"github.com/fatbrother/virtual-file-system/internal/search"
+	"github.com/fatbrother/virtual-file-system/internal/storage"
+	"github.com/fatbrother/virtual-file-system/internal/tag"
+	"github.com/fatbrother/virtual-file-system/internal/user"
+)
+
+// Session is an interactive CLI session against a Storage. Once a user has
+// logged in, commands act as that user and the <username> argument may be
+// omitted to mean the logged-in user.
+type Session struct {
+	storage *storage.Storage
+	user    string
+	out     io.Writer
+	errOut  io.Writer
+	// in supplies answers to confirmation prompts; without it nothing is confirmed
+	in *bufio.Scanner
+	// inTx is set between begin and commit or rollback, while pending collects the commands
+	inTx    bool
+	pending []string
+	// events delivers the changes seen by watch until stopWatch is called
+	events    <-chan storage.Event
+	stopWatch context.CancelFunc
+}
+
+// usageError is reported as a usage line rather than an error
+type usageError string
+
+func (e usageError) Error() string {
+	return "Usage: " + string(e)
+}
+
+// errUnknownCommand is reported as is rather than as an error
+var errUnknownCommand = errors.New("Unknown command")
+
+type handler func(s *Session, args []string) error
+
+// handlers is filled in by init because commit dispatches through it
+var handlers map[string]handler
+
+func init() {
+	handlers = map[string]handler{
+		"register":           (*Session).register,
+		"delete":             (*Session).deleteUser,
+		"login":              (*Session).login,
+		"passwd":             (*Session).passwd,
+		"token":              (*Session).token,
+		"logout":             (*Session).logout,
+		"whoami":             (*Session).whoami,
+		"set-role":           (*Session).setRole,
+		"set-quota":          (*Session).setQuota,
+		"quota":              (*Session).quota,
+		"create-group":       (*Session).createGroup,
+		"delete-group":       (*Session).deleteGroup,
+		"add-member":         (*Session).addMember,
+		"remove-member":      (*Session).removeMember,
+		"list-groups":        (*Session).listGroups,
+		"create-folder":      (*Session).createFolder,
+		"delete-folder":      (*Session).deleteFolder,
+		"list-folders":       (*Session).listFolders,
+		"share-folder":       (*Session).shareFolder,
+		"create-file":        (*Session).createFile,
+		"delete-file":        (*Session).deleteFile,
+		"list-files":         (*Session).listFiles,
+		"share-file":         (*Session).shareFile,
+		"stat":               (*Session).stat,
+		"write":              (*Session).write,
+		"cat":                (*Session).cat,
+		"history":            (*Session).history,
+		"revert":             (*Session).revert,
+		"set-revision-limit": (*Session).setRevisionLimit,
+		"set-description":    (*Session).setDescription,
+		"tag":                (*Session).tag,
+		"untag":              (*Session).untag,
+		"find-tags":          (*Session).findTags,
+		"search":             (*Session).search,
+		"trash":              (*Session).trash,
+		"restore":            (*Session).restore,
+		"snapshot":           (*Session).snapshot,
+		"watch":              (*Session).watch,
+		"unwatch":            (*Session).unwatch,
+		"audit":              (*Session).audit,
+		"begin":              (*Session).begin,
+		"commit":             (*Session).commit,
+		"rollback":           (*Session).rollback,
+		"help":               (*Session).help,
+	}
+}
+
+// NewSession creates a logged-out session writing results to out and errors to errOut
+func NewSession(s *storage.Storage, out, errOut io.Writer) *Session {
+	return &Session{storage: s, out: out, errOut: errOut}
+}
+
+// User returns the logged-in username, or "" when logged out
+func (s *Session) User() string {
+	return s.user
+}
+
+// Prompt returns the prompt showing who is logged in and whether a transaction is open
+func (s *Session) Prompt() string {
+	prompt := s.user
+	if s.inTx {
+		prompt = strings.TrimSpace(prompt + " (tx)")
+	}
+	return prompt + "> "
+}
+
+// Run reads commands from in until "exit" or end of input
+func (s *Session) Run(in io.Reader) {
+	scanner := bufio.NewScanner(in)
+	s.in = scanner
+	for {
+		fmt.Fprint(s.out, s.Prompt())
+		if !scanner.Scan() {
+			break
+		}
+		if !s.Execute(scanner.Text()) {
+			break
+		}
+	}
+	if s.inTx {
+		fmt.Fprintln(s.errOut, "Transaction rolled back: not committed.")
+	}
+	if s.stopWatch != nil {
+		s.stopWatch()
+	}
+	fmt.Fprintln(s.out, "Goodbye!")
+}
+
+// Execute runs a single command line and reports whether the session should continue
+func (s *Session) Execute(input string) bool {
+	if strings.ToLower(input) == "exit" {
+		return false
+	}
+
+	args := strings.Fields(input)
+	if len(args) == 0 {
+		return true
+	}
+
+	if err := s.dispatch(input, args); err != nil {
+		var usage usageError
+		switch {
+		case errors.As(err, &usage):
+			fmt.Fprintln(s.errOut, usage.Error())
+		case err == errUnknownCommand:
+			fmt.Fprintln(s.errOut, err)
+		default:
+			fmt.Fprintf(s.errOut, "Error: %v\n", err)
+		}
+	}
+	s.printEvents()
+	return true
+}
+
+// dispatch runs a command, or queues it while a transaction is open
+func (s *Session) dispatch(input string, args []string) error {
+	name := strings.ToLower(args[0])
+	if s.inTx && name != "begin" && name != "commit" && name != "rollback" {
+		if err := checkQueueable(name, args); err != nil {
+			return err
+		}
+		s.pending = append(s.pending, input)
+		return nil
+	}
+
+	h, ok := handlers[name]
+	if !ok {
+		return errUnknownCommand
+	}
+	return h(s, args)
+}
+
+// checkQueueable fails for commands that cannot be part of a transaction:
+// those that change the session rather than the storage, and questions,
+// which would wait for an answer while the storage is locked
+func checkQueueable(name string, args []string) error {
+	switch name {
+	case "login", "logout", "watch", "unwatch":
+		return errors.New("The " + name + " command cannot be used in a transaction.")
+	case "delete":
+		for _, arg := range args[1:] {
+			if arg == "--force" || arg == "--dry-run" {
+				return nil
+			}
+		}
+		return errors.New("The delete command needs --force in a transaction.")
+	}
+	return nil
+}
+
+// namespace splits the arguments of a command working in a user's namespace
+// and taking at least n more arguments. Commands act as the logged-in user
+// in their own namespace; a first argument of ~<username> names another
+// user's. Without the tilde an argument is never taken for a username, so
+// folders may be named like users. It returns the acting user, the namespace
+// owner and the remaining arguments.
+func (s *Session) namespace(args []string, n int, usage string) (string, string, []string, error) {
+	if err := s.loggedIn(); err != nil {
+		return "", "", nil, err
+	}
+	username, rest := s.user, args[1:]
+	if len(rest) > 0 && len(rest[0]) > 1 && strings.HasPrefix(rest[0], "~") {
+		username, rest = rest[0][1:], rest[1:]
+	}
+	if len(rest) < n {
+		return "", "", nil, usageError(usage)
+	}
+	return s.user, username, rest, nil
+}
+
+// target is namespace for a command taking exactly n more arguments
+func (s *Session) target(args []string, n int, usage string) (string, string, []string, error) {
+	actor, username, rest, err := s.namespace(args, n, usage)
+	if err == nil && len(rest) != n {
+		err = usageError(usage)
+	}
+	return actor, username, rest, err
+}
+
+// loggedIn fails unless a user is logged in
+func (s *Session) loggedIn() error {
+	if s.user == "" {
+		return errors.New("Not logged in.")
+	}
+	return nil
+}
+
+// confirm asks a yes/no question and reports whether it was answered yes
+func (s *Session) confirm(question string) bool {
+	fmt.Fprint(s.out, question+" [y/N] ")
+	if s.in == nil || !s.in.Scan() {
+		fmt.Fprintln(s.out)
+		return false
+	}
+	answer := strings.ToLower(strings.TrimSpace(s.in.Text()))
+	return answer == "y" || answer == "yes"
+}
+
+// isUser reports whether name refers to a registered user
+func (s *Session) isUser(name string) bool {
+	_, err := s.storage.GetUser(name)
+	return err == nil
+}
+
+// register adds a user with a password, so that every user can log in; the
+// first one becomes the admin
+func (s *Session) register(args []string) error {
+	if len(args) != 3 {
+		return usageError("register <username> <password>")
+	}
+	username := args[1]
+	if err := s.storage.AddUserWithPassword(username, args[2]); err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "User '%s' registered successfully\n", username)
+	return nil
+}
+
+func (s *Session) deleteUser(args []string) error {
+	const usage = "delete <username> [--dry-run] [--force] [--transfer-to <username>]"
+	if len(args) < 2 || strings.HasPrefix(args[1], "--") {
+		return usageError(usage)
+	}
+
+	username := args[1]
+	var opts storage.DeleteUserOptions
+	force := false
+	for i := 2; i < len(args); i++ {
+		switch args[i] {
+		case "--dry-run":
+			opts.DryRun = true
+		case "--force":
+			force = true
+		case "--transfer-to":
+			if i+1 == len(args) {
+				return usageError(usage)
+			}
+			i++
+			opts.TransferTo = args[i]
+		default:
+			return usageError(usage)
+		}
+	}
+
+	if err := s.loggedIn(); err != nil {
+		return err
+	}
+	actor := s.user
+
+	if opts.DryRun || !force {
+		plan := opts
+		plan.DryRun = true
+		report, err := s.storage.DeleteUserWithOptions(actor, username, plan)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(s.out, describeDeletion(report))
+		if opts.DryRun {
+			return nil
+		}
+		if !s.confirm("Delete user " + username + "?") {
+			fmt.Fprintln(s.out, "Deletion cancelled")
+			return nil
+		}
+	}
+
+	if _, err := s.storage.DeleteUserWithOptions(actor, username, opts); err != nil {
+		return err
+	}
+	if s.user != "" && !s.isUser(s.user) {
+		s.user = ""
+	}
+	fmt.Fprintf(s.out, "User %s deleted successfully\n", username)
+	return nil
+}
+
+// describeDeletion summarizes what deleting a user will do
+func describeDeletion(r storage.DeletionReport) string {
+	contents := fmt.Sprintf("%d folders, %d files and %d bytes", r.Folders, r.Files, r.Bytes)
+	if r.TransferredTo != "" {
+		return fmt.Sprintf("Deleting user %s transfers %s to %s and removes %d trashed items.", r.Username, contents, r.TransferredTo, r.TrashedItems)
+	}
+	return fmt.Sprintf("Deleting user %s removes %s, and %d trashed items.", r.Username, contents, r.TrashedItems)
+}
+
+func (s *Session) login(args []string) error {
+	if len(args) != 3 {
+		return usageError("login <username> <password|token>")
+	}
+	u, err := s.storage.Authenticate(args[1], args[2])
+	if err != nil {
+		return err
+	}
+	s.user = u.Username
+	fmt.Fprintf(s.out, "Logged in as %s\n", s.user)
+	return nil
+}
+
+func (s *Session) logout(args []string) error {
+	if len(args) != 1 {
+		return usageError("logout")
+	}
+	if s.user == "" {
+		return errors.New("Not logged in.")
+	}
+	fmt.Fprintf(s.out, "Logged out %s\n", s.user)
+	s.user = ""
+	return nil
+}
+
+func (s *Session) whoami(args []string) error {
+	if len(args) != 1 {
+		return usageError("whoami")
+	}
+	if err := s.loggedIn(); err != nil {
+		return err
+	}
+	fmt.Fprintln(s.out, s.user)
+	return nil
+}
+
+func (s *Session) setRole(args []string) error {
+	if len(args) != 3 {
+		return usageError("set-role <username> <user|admin>")
+	}
+	if err := s.loggedIn(); err != nil {
+		return err
+	}
+	role, err := user.ParseRole(args[2])
+	if err != nil {
+		return err
+	}
+	if err := s.storage.SetRole(s.user, args[1], role); err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "Role of %s set to %s\n", args[1], role)
+	return nil
+}
+
+func (s *Session) setQuota(args []string) error {
+	if len(args) != 4 {
+		return usageError("set-quota <username> <folders|files|bytes> <limit|unlimited>")
+	}
+	if err := s.loggedIn(); err != nil {
+		return err
+	}
+
+	username, resource := args[1], strings.ToLower(args[2])
+	var limit int64
+	if strings.ToLower(args[3]) != "unlimited" {
+		var err error
+		if limit, err = strconv.ParseInt(args[3], 10, 64); err != nil {
+			return errors.New("The " + args[3] + " is not a valid quota limit.")
+		}
+	}
+
+	quota, _, err := s.storage.GetQuota(s.user, username)
+	if err != nil {
+		return err
+	}
+	if err := quota.Set(resource, limit); err != nil {
+		return err
+	}
+	if err := s.storage.SetQuota(s.user, username, quota); err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "Quota of %s for %s set to %s\n", resource, username, user.FormatLimit(limit))
+	return nil
+}
+
+func (s *Session) quota(args []string) error {
+	actor, username, _, err := s.target(args, 0, "quota [~username]")
+	if err != nil {
+		return err
+	}
+	quota, usage, err := s.storage.GetQuota(actor, username)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "Quota for user %s:\n", username)
+	fmt.Fprintf(s.out, "- %s: %d/%s\n", user.QuotaFolders, usage.Folders, user.FormatLimit(quota.Limit(user.QuotaFolders)))
+	fmt.Fprintf(s.out, "- %s: %d/%s\n", user.QuotaFiles, usage.Files, user.FormatLimit(quota.Limit(user.QuotaFiles)))
+	fmt.Fprintf(s.out, "- %s: %d/%s\n", user.QuotaBytes, usage.Bytes, user.FormatLimit(quota.Limit(user.QuotaBytes)))
+	return nil
+}
+
+func (s *Session) passwd(args []string) error {
+	actor, username, rest, err := s.target(args, 1, "passwd [~username] <new-password>")
+	if err != nil {
+		return err
+	}
+	if err := s.storage.SetPassword(actor, username, rest[0]); err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "Password for %s updated successfully\n", username)
+	return nil
+}
+
+func (s *Session) token(args []string) error {
+	const usage = "token create [name] | token list | token revoke <id>"
+	if len(args) < 2 {
+		return usageError(usage)
+	}
+	if err := s.loggedIn(); err != nil {
+		return err
+	}
+
+	switch strings.ToLower(args[1]) {
+	case "create":
+		name := strings.Join(args[2:], " ")
+		secret, token, err := s.storage.CreateToken(s.user, s.user, name)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(s.out, "Token %s created. Copy it now, it will not be shown again:\n%s\n", token.ID, secret)
+	case "list":
+		if len(args) != 2 {
+			return usageError(usage)
+		}
+		tokens, err := s.storage.ListTokens(s.user, s.user)
+		if err != nil {
+			return err
+		}
+		if len(tokens) == 0 {
+			fmt.Fprintf(s.out, "No tokens found for user %s\n", s.user)
+			return nil
+		}
+		fmt.Fprintf(s.out, "Tokens for user %s:\n", s.user)
+		for _, token := range tokens {
+			fmt.Fprintf(s.out, "- %s\n", token.Format())
+		}
+	case "revoke":
+		if len(args) != 3 {
+			return usageError(usage)
+		}
+		if err := s.storage.RevokeToken(s.user, s.user, args[2]); err != nil {
+			return err
+		}
+		fmt.Fprintf(s.out, "Token %s revoked successfully\n", args[2])
+	default:
+		return usageError(usage)
+	}
+	return nil
+}
+
+func (s *Session) createFolder(args []string) error {
+	const usage = "create-folder [~username] <foldername> [description]"
+	actor, username, rest, err := s.namespace(args, 1, usage)
+	if err != nil {
+		return err
+	}
+
+	folderName, description := rest[0], strings.Join(rest[1:], " ")
+	if err := s.storage.CreateFolder(actor, username, folderName, description); err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "Create %s successfully.\n", folderName)
+	return nil
+}
+
+func (s *Session) deleteFolder(args []string) error {
+	args, ifVersion, err := parseIfVersion(args)
+	if err != nil {
+		return err
+	}
+	actor, username, rest, err := s.target(args, 1, "delete-folder [~username] <foldername> [--if-version N]")
+	if err != nil {
+		return err
+	}
+	folderName := rest[0]
+	if err := s.storage.DeleteFolderIfVersion(actor, username, folderName, ifVersion); err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "Delete %s successfully for user %s\n", folderName, username)
+	return nil
+}
+
+func (s *Session) listFolders(args []string) error {
+	const usage = "list-folders [~username] [--sort <field[:asc|desc],...>|--sort-name|--sort-created|--sort-modified [asc|desc]] [filters]"
+	args, filter, err := parseListFilter(args, usage)
+	if err != nil {
+		return err
+	}
+
+	actor, username, rest, err := s.namespace(args, 0, usage)
+	if err != nil {
+		return err
+	}
+
+	spec, err := parseSort(rest, usage)
+	if err != nil {
+		return err
+	}
+
+	folders, err := s.storage.ListFolders(actor, username, spec, filter)
+	if err != nil {
+		return err
+	}
+	if len(folders) == 0 {
+		fmt.Fprintf(s.out, "No folders found for user %s\n", username)
+		return nil
+	}
+	fmt.Fprintf(s.out, "Folders for user %s:\n", username)
+	for _, folder := range folders {
+		fmt.Fprintf(s.out, "- %s\n", folder.Format())
+	}
+	return nil
+}
+
+func (s *Session) shareFolder(args []string) error {
+	actor, owner, rest, err := s.target(args, 3, "share-folder [~owner] <foldername> <grantee> <read|write>")
+	if err != nil {
+		return err
+	}
+	folderName, grantee := rest[0], rest[1]
+	permission, err := acl.ParsePermission(rest[2])
+	if err != nil {
+		return err
+	}
+	if groupName := strings.TrimPrefix(grantee, "@"); groupName != grantee {
+		err = s.storage.ShareFolderWithGroup(actor, owner, folderName, groupName, permission)
+	} else {
+		err = s.storage.ShareFolder(actor, owner, folderName, grantee, permission)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "Share %s/%s with %s (%s) successfully.\n", owner, folderName, grantee, permission)
+	return nil
+}
+
+func (s *Session) createFile(args []string) error {
+	const usage = "create-file [~username] <foldername> <filename> [description]"
+	actor, username, rest, err := s.namespace(args, 2, usage)
+	if err != nil {
+		return err
+	}
+
+	folderName, fileName, description := rest[0], rest[1], strings.Join(rest[2:], " ")
+	if err := s.storage.CreateFile(actor, username, folderName, fileName, description); err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "Create %s in %s/%s successfully.\n", fileName, username, folderName)
+	return nil
+}
+
+func (s *Session) deleteFile(args []string) error {
+	args, ifVersion, err := parseIfVersion(args)
+	if err != nil {
+		return err
+	}
+	actor, username, rest, err := s.target(args, 2, "delete-file [~username] <foldername> <filename> [--if-version N]")
+	if err != nil {
+		return err
+	}
+	folderName, fileName := rest[0], rest[1]
+	if err := s.storage.DeleteFileIfVersion(actor, username, folderName, fileName, ifVersion); err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "Delete %s in %s/%s successfully.\n", fileName, username, folderName)
+	return nil
+}
+
+func (s *Session) stat(args []string) error {
+	const usage = "stat [~username] <foldername> [filename]"
+	actor, username, rest, err := s.namespace(args, 1, usage)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 2 {
+		return usageError(usage)
+	}
+
+	if len(rest) == 1 {
+		f, err := s.storage.GetFolder(actor, username, rest[0])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(s.out, "%s (version %d)%s\n", f.Format(), f.Version, formatTags(f.Tags))
+		return nil
+	}
+	fl, err := s.storage.GetFile(actor, username, rest[0], rest[1])
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "%s (version %d)%s\n", fl.Format(), fl.Version, formatTags(fl.Tags))
+	return nil
+}
+
+func (s *Session) listFiles(args []string) error {
+	const usage = "list-files [~username] <foldername> [--sort <field[:asc|desc],...>|--sort-name|--sort-created|--sort-modified [asc|desc]] [filters]"
+	args, filter, err := parseListFilter(args, usage)
+	if err != nil {
+		return err
+	}
+	actor, username, rest, err := s.namespace(args, 1, usage)
+	if err != nil {
+		return err
+	}
+
+	folderName := rest[0]
+	spec, err := parseSort(rest[1:], usage)
+	if err != nil {
+		return err
+	}
+
+	files, err := s.storage.ListFiles(actor, username, folderName, spec, filter)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		fmt.Fprintf(s.out, "No files found in folder %s for user %s\n", folderName, username)
+		return nil
+	}
+	fmt.Fprintf(s.out, "Files in folder %s for user %s:\n", folderName, username)
+	for _, file := range files {
+		fmt.Fprintf(s.out, "- %s\n", file.Format())
+	}
+	return nil
+}
+
+func (s *Session) shareFile(args []string) error {
+	actor, owner, rest, err := s.target(args, 4, "share-file [~owner] <foldername> <filename> <grantee> <read|write>")
+	if err != nil {
+		return err
+	}
+	folderName, fileName, grantee := rest[0], rest[1], rest[2]
+	permission, err := acl.ParsePermission(rest[3])
+	if err != nil {
+		return err
+	}
+	if err := s.storage.ShareFile(actor, owner, folderName, fileName, grantee, permission); err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "Share %s/%s/%s with %s (%s) successfully.\n", owner, folderName, fileName, grantee, permission)
+	return nil
+}
+
+func (s *Session) write(args []string) error {
+	const usage = "write [~username] <foldername> <filename> <content>"
+	actor, username, rest, err := s.namespace(args, 3, usage)
+	if err != nil {
+		return err
+	}
+
+	folderName, fileName, content := rest[0], rest[1], strings.Join(rest[2:], " ")
+	rev, err := s.storage.WriteFile(actor, username, folderName, fileName, []byte(content))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "Write %s in %s/%s successfully (revision %d).\n", fileName, username, folderName, rev.Number)
+	return nil
+}
+
+func (s *Session) cat(args []string) error {
+	const usage = "cat [~username] <foldername> <filename> [--rev N]"
+	number := 0
+	if n := len(args); n > 2 && args[n-2] == "--rev" {
+		var err error
+		if number, err = strconv.Atoi(args[n-1]); err != nil || number < 1 {
+			return errors.New("The " + args[n-1] + " is not a valid revision.")
+		}
+		args = args[:n-2]
+	}
+
+	actor, username, rest, err := s.target(args, 2, usage)
+	if err != nil {
+		return err
+	}
+	rev, err := s.storage.ReadFile(actor, username, rest[0], rest[1], number)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(s.out, string(rev.Content()))
+	return nil
+}
+
+func (s *Session) history(args []string) error {
+	actor, username, rest, err := s.target(args, 2, "history [~username] <foldername> <filename>")
+	if err != nil {
+		return err
+	}
+	folderName, fileName := rest[0], rest[1]
+	revisions, err := s.storage.FileHistory(actor, username, folderName, fileName)
+	if err != nil {
+		return err
+	}
+	if len(revisions) == 0 {
+		fmt.Fprintf(s.out, "No revisions found for %s in %s/%s\n", fileName, username, folderName)
+		return nil
+	}
+	fmt.Fprintf(s.out, "History of %s in %s/%s:\n", fileName, username, folderName)
+	for _, rev := range revisions {
+		fmt.Fprintf(s.out, "- %s\n", rev.Format())
+	}
+	return nil
+}
+
+func (s *Session) revert(args []string) error {
+	actor, username, rest, err := s.target(args, 3, "revert [~username] <foldername> <filename> <revision>")
+	if err != nil {
+		return err
+	}
+	folderName, fileName := rest[0], rest[1]
+	number, err := strconv.Atoi(rest[2])
+	if err != nil {
+		return errors.New("The " + rest[2] + " is not a valid revision.")
+	}
+	rev, err := s.storage.RevertFile(actor, username, folderName, fileName, number)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "Revert %s in %s/%s to revision %d successfully (revision %d).\n", fileName, username, folderName, number, rev.Number)
+	return nil
+}
+
+func (s *Session) setRevisionLimit(args []string) error {
+	actor, username, rest, err := s.target(args, 2, "set-revision-limit [~username] <foldername> <limit|unlimited>")
+	if err != nil {
+		return err
+	}
+	folderName := rest[0]
+	limit := 0
+	if strings.ToLower(rest[1]) != "unlimited" {
+		if limit, err = strconv.Atoi(rest[1]); err != nil {
+			return errors.New("The " + rest[1] + " is not a valid revision limit.")
+		}
+	}
+	if err := s.storage.SetRevisionLimit(actor, username, folderName, limit); err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "Files in %s/%s keep %s revisions\n", username, folderName, user.FormatLimit(int64(limit)))
+	return nil
+}
+
+func (s *Session) setDescription(args []string) error {
+	const usage = "set-description folder [~username] <foldername> <description> [--if-version N] | " +
+		"set-description file [~username] <foldername> <filename> <description> [--if-version N]"
+	args, ifVersion, err := parseIfVersion(args)
+	if err != nil {
+		return err
+	}
+	actor, username, folderName, fileName, rest, err := s.metadataTarget(args, usage)
+	if err != nil {
+		return err
+	}
+	description := strings.Join(rest, " ")
+	path, version, _, err := s.updateMetadata(actor, username, folderName, fileName, storage.FileUpdate{Description: &description}, ifVersion)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "Update description of %s successfully (version %d)\n", path, version)
+	return nil
+}
+
+func (s *Session) tag(args []string) error {
+	const usage = "tag folder [~username] <foldername> <key=value>... | tag file [~username] <foldername> <filename> <key=value>..."
+	actor, username, folderName, fileName, rest, err := s.metadataTarget(args, usage)
+	if err != nil {
+		return err
+	}
+	tags, err := tag.Parse(rest)
+	if err != nil {
+		return err
+	}
+	path, _, tags, err := s.updateMetadata(actor, username, folderName, fileName, storage.FileUpdate{SetTags: tags}, 0)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "Tags of %s: %s\n", path, tags)
+	return nil
+}
+
+func (s *Session) untag(args []string) error {
+	const usage = "untag folder [~username] <foldername> <key>... | untag file [~username] <foldername> <filename> <key>..."
+	actor, username, folderName, fileName, rest, err := s.metadataTarget(args, usage)
+	if err != nil {
+		return err
+	}
+	path, _, tags, err := s.updateMetadata(actor, username, folderName, fileName, storage.FileUpdate{RemoveTags: rest}, 0)
+	if err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		fmt.Fprintf(s.out, "No tags left on %s\n", path)
+		return nil
+	}
+	fmt.Fprintf(s.out, "Tags of %s: %s\n", path, tags)
+	return nil
+}
+
+func (s *Session) findTags(args []string) error {
+	const usage = "find-tags [~username] <selector>"
+	actor, username, rest, err := s.namespace(args, 1, usage)
+	if err != nil {
+		return err
+	}
+
+	// Spaces after the commas split the selector into several arguments
+	selector, err := tag.ParseSelector(strings.Join(rest, " "))
+	if err != nil {
+		return err
+	}
+	matches, err := s.storage.FindByTags(actor, username, selector)
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		fmt.Fprintf(s.out, "No folders or files of user %s match %s\n", username, selector)
+		return nil
+	}
+	for _, m := range matches {
+		fmt.Fprintf(s.out, "%s/%s %s\n", username, m.Path(), m.Tags())
+	}
+	return nil
+}
+
+func (s *Session) search(args []string) error {
+	const usage = `search [~username] <words and "quoted phrases">`
+	actor, username, rest, err := s.namespace(args, 1, usage)
+	if err != nil {
+		return err
+	}
+
+	query, err := search.ParseQuery(strings.Join(rest, " "))
+	if err != nil {
+		return err
+	}
+	results, err := s.storage.Search(actor, username, query)
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		fmt.Fprintf(s.out, "No folders or files of user %s match %s\n", username, query)
+		return nil
+	}
+	for _, r := range results {
+		fmt.Fprintf(s.out, "%s/%s %.3f\n", username, r.Path(), r.Score)
+	}
+	return nil
+}
+
+// metadataTarget reads "folder [~username] <foldername>" or "file [~username]
+// <foldername> <filename>" after the command name, followed by at least one
+// more argument. It returns the acting user, the namespace owner, the folder
+// and file names, the file name being "" for a folder, and the remaining arguments.
+func (s *Session) metadataTarget(args []string, usage string) (string, string, string, string, []string, error) {
+	if len(args) < 2 {
+		return "", "", "", "", nil, usageError(usage)
+	}
+
+	// names counts the folder and file names
+	var names int
+	switch args[1] {
+	case "folder":
+		names = 1
+	case "file":
+		names = 2
+	default:
+		return "", "", "", "", nil, usageError(usage)
+	}
+	// The kind takes the place of the command name
+	actor, username, rest, err := s.namespace(args[1:], names+1, usage)
+	if err != nil {
+		return "", "", "", "", nil, err
+	}
+	if names == 1 {
+		return actor, username, rest[0], "", rest[1:], nil
+	}
+	return actor, username, rest[0], rest[1], rest[2:], nil
+}
+
+// updateMetadata applies a description or tag change to a folder, or to a
+// file when fileName is set. It returns the path with the version and tags
+// the change left.
+func (s *Session) updateMetadata(actor, username, folderName, fileName string, update storage.FileUpdate, ifVersion uint64) (string, uint64, tag.Tags, error) {
+	path := username + "/" + folderName
+	if fileName == "" {
+		f, err := s.storage.UpdateFolder(actor, username, folderName, storage.FolderUpdate{
+			Description: update.Description,
+			SetTags:     update.SetTags,
+			RemoveTags:  update.RemoveTags,
+		}, ifVersion)
+		return path, f.Version, f.Tags, err
+	}
+	fl, err := s.storage.UpdateFile(actor, username, folderName, fileName, update, ifVersion)
+	return path + "/" + fileName, fl.Version, fl.Tags, err
+}
+
+func (s *Session) trash(args []string) error {
+	const usage = "trash list [~username] | trash empty [~username]"
+	if len(args) < 2 {
+		return usageError(usage)
+	}
+
+	// The subcommand takes the place of the command name
+	actor, username, _, err := s.target(args[1:], 0, usage)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(args[1]) {
+	case "list":
+		items, err := s.storage.ListTrash(actor, username)
+		if err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			fmt.Fprintf(s.out, "Trash is empty for user %s\n", username)
+			return nil
+		}
+		fmt.Fprintf(s.out, "Trash for user %s:\n", username)
+		for _, item := range items {
+			fmt.Fprintf(s.out, "- %s\n", item.Format())
+		}
+	case "empty":
+		n, err := s.storage.EmptyTrash(actor, username)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(s.out, "Deleted %d items from the trash of user %s\n", n, username)
+	default:
+		return usageError(usage)
+	}
+	return nil
+}
+
+func (s *Session) restore(args []string) error {
+	actor, username, rest, err := s.target(args, 1, "restore [~username] <id>")
+	if err != nil {
+		return err
+	}
+	item, err := s.storage.RestoreFromTrash(actor, username, rest[0])
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "Restore %s for user %s successfully.\n", item.Location(), username)
+	return nil
+}
+
+func (s *Session) snapshot(args []string) error {
+	const usage = "snapshot create [~username] [name] | snapshot list [~username] | snapshot delete [~username] <name> | snapshot restore [~username] <name>"
+	if len(args) < 2 {
+		return usageError(usage)
+	}
+
+	// The subcommand takes the place of the command name
+	subcommand := strings.ToLower(args[1])
+	actor, username, rest, err := s.namespace(args[1:], 0, usage)
+	if err != nil {
+		return err
+	}
+
+	var name string
+	switch {
+	case subcommand == "list" && len(rest) == 0:
+	case subcommand == "create" && len(rest) <= 1:
+		if len(rest) == 1 {
+			name = rest[0]
+		}
+	case (subcommand == "delete" || subcommand == "restore") && len(rest) == 1:
+		name = rest[0]
+	default:
+		return usageError(usage)
+	}
+
+	switch subcommand {
+	case "create":
+		name, err := s.storage.CreateSnapshot(actor, username, name)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(s.out, "Create snapshot %s for user %s successfully.\n", name, username)
+	case "list":
+		snapshots, err := s.storage.ListSnapshots(actor, username)
+		if err != nil {
+			return err
+		}
+		if len(snapshots) == 0 {
+			fmt.Fprintf(s.out, "No snapshots found for user %s\n", username)
+			return nil
+		}
+		fmt.Fprintf(s.out, "Snapshots for user %s:\n", username)
+		for _, snap := range snapshots {
+			fmt.Fprintf(s.out, "- %s\n", snap.Format())
+		}
+	case "delete":
+		if err := s.storage.DeleteSnapshot(actor, username, name); err != nil {
+			return err
+		}
+		fmt.Fprintf(s.out, "Delete snapshot %s for user %s successfully.\n", name, username)
+	case "restore":
+		if err := s.storage.RestoreSnapshot(actor, username, name); err != nil {
+			return err
+		}
+		fmt.Fprintf(s.out, "Restore snapshot %s for user %s successfully.\n", name, username)
+	}
+	return nil
+}
+
+func (s *Session) createGroup(args []string) error {
+	if len(args) != 2 {
+		return usageError("create-group <groupname>")
+	}
+	if err := s.loggedIn(); err != nil {
+		return err
+	}
+	if err := s.storage.CreateGroup(s.user, args[1]); err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "Create group %s successfully.\n", args[1])
+	return nil
+}
+
+func (s *Session) deleteGroup(args []string) error {
+	if len(args) != 2 {
+		return usageError("delete-group <groupname>")
+	}
+	if err := s.loggedIn(); err != nil {
+		return err
+	}
+	if err := s.storage.DeleteGroup(s.user, args[1]); err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "Delete group %s successfully.\n", args[1])
+	return nil
+}
+
+func (s *Session) addMember(args []string) error {
+	if len(args) != 3 {
+		return usageError("add-member <groupname> <username>")
+	}
+	if err := s.loggedIn(); err != nil {
+		return err
+	}
+	if err := s.storage.AddGroupMember(s.user, args[1], args[2]); err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "Add %s to group %s successfully.\n", args[2], args[1])
+	return nil
+}
+
+func (s *Session) removeMember(args []string) error {
+	if len(args) != 3 {
+		return usageError("remove-member <groupname> <username>")
+	}
+	if err := s.loggedIn(); err != nil {
+		return err
+	}
+	if err := s.storage.RemoveGroupMember(s.user, args[1], args[2]); err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "Remove %s from group %s successfully.\n", args[2], args[1])
+	return nil
+}
+
+func (s *Session) listGroups(args []string) error {
+	if len(args) != 1 {
+		return usageError("list-groups")
+	}
+	groups, err := s.storage.ListGroups()
+	if err != nil {
+		return err
+	}
+	if len(groups) == 0 {
+		fmt.Fprintln(s.out, "No groups found")
+		return nil
+	}
+	fmt.Fprintln(s.out, "Groups:")
+	for _, group := range groups {
+		members, err := s.storage.ListGroupMembers(group.Name)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(s.out, "- %s members: %s\n", group.Format(), strings.Join(members, ", "))
+	}
+	return nil
+}
+
+func (s *Session) begin(args []string) error {
+	if len(args) != 1 {
+		return usageError("begin")
+	}
+	if s.inTx {
+		return errors.New("A transaction is already in progress.")
+	}
+	s.inTx, s.pending = true, nil
+	return nil
+}
+
+func (s *Session) commit(args []string) error {
+	if len(args) != 1 {
+		return usageError("commit")
+	}
+	if !s.inTx {
+		return errors.New("No transaction in progress.")
+	}
+	lines := s.pending
+	s.inTx, s.pending = false, nil
+
+	// Results are only shown once the whole transaction has succeeded
+	var buffered bytes.Buffer
+	out, in, st, user := s.out, s.in, s.storage, s.user
+	// Nothing may wait for input while the storage is locked
+	s.out, s.in = &buffered, nil
+	err := st.Tx(func(tx *storage.Tx) error {
+		s.storage = tx.Storage
+		for _, line := range lines {
+			if err := s.dispatch(line, strings.Fields(line)); err != nil {
+				return fmt.Errorf("%s: %v", line, err)
+			}
+		}
+		return nil
+	})
+	s.out, s.in, s.storage = out, in, st
+
+	if err != nil {
+		s.user = user
+		return errors.New("Transaction rolled back: " + err.Error())
+	}
+	if _, err := buffered.WriteTo(s.out); err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "Transaction committed (%d commands)\n", len(lines))
+	return nil
+}
+
+func (s *Session) rollback(args []string) error {
+	if len(args) != 1 {
+		return usageError("rollback")
+	}
+	if !s.inTx {
+		return errors.New("No transaction in progress.")
+	}
+	fmt.Fprintf(s.out, "Transaction rolled back (%d commands discarded)\n", len(s.pending))
+	s.inTx, s.pending = false, nil
+	return nil
+}
+
+func (s *Session) watch(args []string) error {
+	const usage = "watch [~username] [folderprefix]"
+	actor, username, rest, err := s.namespace(args, 0, usage)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 1 {
+		return usageError(usage)
+	}
+	prefix := strings.Join(rest, "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := s.storage.Watch(ctx, actor, username, prefix)
+	if err != nil {
+		cancel()
+		return err
+	}
+	if s.stopWatch != nil {
+		s.stopWatch()
+	}
+	s.events, s.stopWatch = events, cancel
+	fmt.Fprintf(s.out, "Watching %s/%s* until unwatch\n", username, prefix)
+	return nil
+}
+
+func (s *Session) unwatch(args []string) error {
+	if len(args) != 1 {
+		return usageError("unwatch")
+	}
+	if s.stopWatch == nil {
+		return errors.New("Not watching.")
+	}
+	s.stopWatch()
+	s.events, s.stopWatch = nil, nil
+	fmt.Fprintln(s.out, "Stopped watching")
+	return nil
+}
+
+func (s *Session) audit(args []string) error {
+	const usage = "audit verify | audit query [--user <username>] [--since <time|duration>] [--op <operation>]"
+	if len(args) < 2 {
+		return usageError(usage)
+	}
+	if err := s.loggedIn(); err != nil {
+		return err
+	}
+
+	switch strings.ToLower(args[1]) {
+	case "verify":
+		if len(args) != 2 {
+			return usageError(usage)
+		}
+		n, err := s.storage.VerifyAudit(s.user)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(s.out, "Audit log verified (%d records)\n", n)
+	case "query":
+		var filter audit.Filter
+		rest := args[2:]
+		if len(rest)%2 != 0 {
+			return usageError(usage)
+		}
+		for i := 0; i < len(rest); i += 2 {
+			switch value := rest[i+1]; rest[i] {
+			case "--user":
+				filter.Actor = value
+			case "--op":
+				filter.Op = value
+			case "--since":
+				since, err := parseTime(value)
+				if err != nil {
+					return err
+				}
+				filter.Since = since
+			default:
+				return usageError(usage)
+			}
+		}
+		records, err := s.storage.QueryAudit(s.user, filter)
+		if err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			fmt.Fprintln(s.out, "No audit records found")
+			return nil
+		}
+		for _, r := range records {
+			fmt.Fprintf(s.out, "- %s\n", r.Format())
+		}
+	default:
+		return usageError(usage)
+	}
+	return nil
+}
+
+// parseTime reads a point in time given as a duration before now, an RFC 3339 time or a date
+func parseTime(value string) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("The " + value + " is not a valid time or duration.")
+}
+
+// printEvents prints the changes seen by watch since the last command
+func (s *Session) printEvents() {
+	for {
+		select {
+		case e, ok := <-s.events:
+			if !ok {
+				s.events = nil
+				return
+			}
+			fmt.Fprintf(s.out, "Event: %s\n", e.Format())
+		default:
+			return
+		}
+	}
+}
+
+func (s *Session) help(args []string) error {
+	fmt.Fprintln(s.out, "Commands:")
+	fmt.Fprintln(s.out, "  register <username> <password>")
+	fmt.Fprintln(s.out, "  delete <username> [--dry-run] [--force] [--transfer-to <username>]")
+	fmt.Fprintln(s.out, "  login <username> <password|token>")
+	fmt.Fprintln(s.out, "  passwd [~username] <new-password>")
+	fmt.Fprintln(s.out, "  token create [name] | token list | token revoke <id>")
+	fmt.Fprintln(s.out, "  logout")
+	fmt.Fprintln(s.out, "  whoami")
+	fmt.Fprintln(s.out, "  set-role <username> <user|admin>")
+	fmt.Fprintln(s.out, "  set-quota <username> <folders|files|bytes> <limit|unlimited>")
+	fmt.Fprintln(s.out, "  quota [~username]")
+	fmt.Fprintln(s.out, "  create-group <groupname>")
+	fmt.Fprintln(s.out, "  delete-group <groupname>")
+	fmt.Fprintln(s.out, "  add-member <groupname> <username>")
+	fmt.Fprintln(s.out, "  remove-member <groupname> <username>")
+	fmt.Fprintln(s.out, "  list-groups")
+	fmt.Fprintln(s.out, "  create-folder [~username] <foldername> [description]")
+	fmt.Fprintln(s.out, "  delete-folder [~username] <foldername> [--if-version N]")
+	fmt.Fprintln(s.out, "  list-folders [~username] [--sort <field[:asc|desc],...>|--sort-name|--sort-created|--sort-modified [asc|desc]] [filters]")
+	fmt.Fprintln(s.out, "  share-folder [~owner] <foldername> <grantee> <read|write>")
+	fmt.Fprintln(s.out, "  create-file [~username] <foldername> <filename> [description]")
+	fmt.Fprintln(s.out, "  delete-file [~username] <foldername> <filename> [--if-version N]")
+	fmt.Fprintln(s.out, "  list-files [~username] <foldername> [--sort <field[:asc|desc],...>|--sort-name|--sort-created|--sort-modified [asc|desc]] [filters]")
+	fmt.Fprintln(s.out, "  share-file [~owner] <foldername> <filename> <grantee> <read|write>")
+	fmt.Fprintln(s.out, "  stat [~username] <foldername> [filename]")
+	fmt.Fprintln(s.out, "  write [~username] <foldername> <filename> <content>")
+	fmt.Fprintln(s.out, "  cat [~username] <foldername> <filename> [--rev N]")
+	fmt.Fprintln(s.out, "  history [~username] <foldername> <filename>")
+	fmt.Fprintln(s.out, "  revert [~username] <foldername> <filename> <revision>")
+	fmt.Fprintln(s.out, "  set-revision-limit [~username] <foldername> <limit|unlimited>")
+	fmt.Fprintln(s.out, "  set-description folder [~username] <foldername> <description> [--if-version N]")
+	fmt.Fprintln(s.out, "  set-description file [~username] <foldername> <filename> <description> [--if-version N]")
+	fmt.Fprintln(s.out, "  tag folder [~username] <foldername> <key=value>... | tag file [~username] <foldername> <filename> <key=value>...")
+	fmt.Fprintln(s.out, "  untag folder [~username] <foldername> <key>... | untag file [~username] <foldername> <filename> <key>...")
+	fmt.Fprintln(s.out, "  find-tags [~username] <selector>")
+	fmt.Fprintln(s.out, `  search [~username] <words and "quoted phrases">`)
+	fmt.Fprintln(s.out, "  trash list [~username] | trash empty [~username]")
+	fmt.Fprintln(s.out, "  restore [~username] <id>")
+	fmt.Fprintln(s.out, "  snapshot create [~username] [name] | snapshot list [~username]")
+	fmt.Fprintln(s.out, "  snapshot delete [~username] <name> | snapshot restore [~username] <name>")
+	fmt.Fprintln(s.out, "  begin | commit | rollback")
+	fmt.Fprintln(s.out, "  watch [~username] [folderprefix] | unwatch")
+	fmt.Fprintln(s.out, "  audit verify | audit query [--user <username>] [--since <time|duration>] [--op <operation>]")
+	fmt.Fprintln(s.out, "  help")
+	fmt.Fprintln(s.out, "  exit")
+	fmt.Fprintln(s.out, "The username may be omitted after login; it then means the logged-in user.")
+	fmt.Fprintln(s.out, "share-folder accepts @<groupname> as the grantee to share with a group.")
+	fmt.Fprintln(s.out, "Commands between begin and commit take effect together, or not at all if one fails.")
+	fmt.Fprintln(s.out, "While watching, changes to the watched folders are printed after each command.")
+	fmt.Fprintln(s.out, "Sort fields: name, created, modified, description, size and files (folders only), e.g. --sort created:desc,name.")
+	fmt.Fprintln(s.out, "Listing filters: --since <time|duration> --until <time|duration> --prefix <prefix> --match <regexp> --description <word> --limit N")
+	fmt.Fprintln(s.out, "A selector is a comma-separated list of key=value, key!=value, key and !key; all must hold.")
+	fmt.Fprintln(s.out, "--if-version refuses to change anything changed since stat showed that version.")
+	return nil
+}
+
+// formatTags prints tags in brackets after a space, or nothing when there are none
+func formatTags(tags tag.Tags) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	return " [" + tags.String() + "]"
+}
+
+// parseIfVersion strips a trailing --if-version N from args. The version is 0 when absent.
+func parseIfVersion(args []string) ([]string, uint64, error) {
+	n := len(args)
+	if n < 2 || args[n-2] != "--if-version" {
+		return args, 0, nil
+	}
+	version, err := strconv.ParseUint(args[n-1], 10, 64)
+	if err != nil || version == 0 {
+		return nil, 0, errors.New("The " + args[n-1] + " is not a valid version.")
+	}
+	return args[:n-2], version, nil
+}
+
+// parseListFilter strips the listing filter flags and their values from args
+func parseListFilter(args []string, usage string) ([]string, storage.ListFilter, error) {
+	var filter storage.ListFilter
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--since", "--until", "--prefix", "--match", "--description", "--limit":
+		default:
+			rest = append(rest, args[i])
+			continue
+		}
+		if i+1 == len(args) {
+			return nil, filter, usageError(usage)
+		}
+		flag, value := args[i], args[i+1]
+		i++
+
+		var err error
+		switch flag {
+		case "--since":
+			filter.Since, err = parseTime(value)
+		case "--until":
+			filter.Until, err = parseTime(value)
+		case "--prefix":
+			filter.Prefix = value
+		case "--match":
+			if filter.Match, err = regexp.Compile(value); err != nil {
+				err = errors.New("The " + value + " is not a valid regular expression.")
+			}
+		case "--description":
+			filter.Description = value
+		case "--limit":
+			if filter.Limit, err = strconv.Atoi(value); err != nil || filter.Limit <= 0 {
+				err = errors.New("The " + value + " is not a valid limit.")
+			}
+		}
+		if err != nil {
+			return nil, filter, err
+		}
+	}
+	return rest, filter, nil
+}
+
+// parseSort reads the optional sort arguments: --sort <field[:asc|desc],...>,
+// or one of --sort-name, --sort-created and --sort-modified followed by an
+// optional asc or desc
+func parseSort(args []string, usage string) (storage.SortSpec, error) {
+	if len(args) == 0 {
+		return nil, nil
+	}
+	if args[0] == "--sort" {
+		if len(args) != 2 {
+			return nil, usageError(usage)
+		}
+		return storage.ParseSortSpec(args[1])
+	}
+
+	if len(args) > 2 || (args[0] != "--sort-name" && args[0] != "--sort-created" && args[0] != "--sort-modified") {
+		return nil, usageError(usage)
+	}
+	key := storage.SortKey{Field: storage.SortField(strings.TrimPrefix(args[0], "--sort-"))}
+	if len(args) > 1 {
+		if args[1] != "asc" && args[1] != "desc" {
+			return nil, usageError(usage)
+		}
+		key.Desc = args[1] == "desc"
+	}
+	return storage.SortSpec{key}, nil
+}
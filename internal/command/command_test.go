@@ -0,0 +1,592 @@
+package command
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/fatbrother/virtual-file-system/internal/storage"
+)
+
+// run executes each line in a fresh session and returns what was written to stdout and stderr
+func run(t *testing.T, s *Session, lines ...string) (string, string) {
+	t.Helper()
+
+	var out, errOut bytes.Buffer
+	s.out, s.errOut = &out, &errOut
+	for _, line := range lines {
+		s.Execute(line)
+	}
+	return out.String(), errOut.String()
+}
+
+func TestSession_Login(t *testing.T) {
+	s := NewSession(storage.NewStorage(), nil, nil)
+
+	out, errOut := run(t, s, "register Alice s3cret-pass", "whoami", "login nobody s3cret-pass", "login alice wrong-pass", "login alice s3cret-pass", "whoami")
+	if !strings.Contains(errOut, "Not logged in.") || strings.Count(errOut, "Invalid username or credentials.") != 2 {
+		t.Errorf("unexpected errors: %q", errOut)
+	}
+	if !strings.HasSuffix(out, "Logged in as Alice\nAlice\n") {
+		t.Errorf("unexpected output: %q", out)
+	}
+	if s.User() != "Alice" || s.Prompt() != "Alice> " {
+		t.Errorf("User() = %q, Prompt() = %q", s.User(), s.Prompt())
+	}
+
+	out, _ = run(t, s, "logout")
+	if out != "Logged out Alice\n" || s.User() != "" || s.Prompt() != "> " {
+		t.Errorf("logout: output %q, User() = %q", out, s.User())
+	}
+}
+
+func TestSession_DefaultUser(t *testing.T) {
+	st := storage.NewStorage()
+	s := NewSession(st, nil, nil)
+	run(t, s, "register alice alice-pass", "register bob bob-pass", "login alice alice-pass")
+
+	tests := []struct {
+		name    string
+		line    string
+		wantOut string
+		wantErr string
+	}{
+		{"Create folder", "create-folder docs My documents", "Create docs successfully.\n", ""},
+		{"Create file", "create-file docs a.txt Notes", "Create a.txt in alice/docs successfully.\n", ""},
+		{"List folders", "list-folders --sort-name asc", "Folders for user alice:\n", ""},
+		{"List files", "list-files docs", "Files in folder docs for user alice:\n", ""},
+		{"Share folder", "share-folder docs bob read", "Share alice/docs with bob (read) successfully.\n", ""},
+		{"Explicit form acts as session user", "create-folder ~bob stolen", "", "Permission denied"},
+		{"Folder named like a user", "create-folder bob notes", "Create bob successfully.\n", ""},
+		{"List folder named like a user", "list-files bob", "No files found in folder bob for user alice\n", ""},
+		{"Missing arguments", "delete-file docs", "", "Usage: delete-file"},
+		{"Delete file", "delete-file docs a.txt", "Delete a.txt in alice/docs successfully.\n", ""},
+		{"Delete folder", "delete-folder docs", "Delete docs successfully for user alice\n", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, errOut := run(t, s, tt.line)
+			if !strings.HasPrefix(out, tt.wantOut) || (tt.wantOut == "" && out != "") {
+				t.Errorf("output = %q, want prefix %q", out, tt.wantOut)
+			}
+			if !strings.Contains(errOut, tt.wantErr) || (tt.wantErr == "" && errOut != "") {
+				t.Errorf("errors = %q, want %q", errOut, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSession_ExplicitUsername(t *testing.T) {
+	s := NewSession(storage.NewStorage(), nil, nil)
+
+	run(t, s, "register bob bob-password", "register amy amy-password", "login bob bob-password", "create-folder docs Shared docs", "share-folder docs amy write", "logout")
+
+	// Logged out, nobody acts as bob, even though the namespace is given
+	out, errOut := run(t, s,
+		"create-folder ~bob more",
+		"create-folder docs",
+		"login amy amy-password",
+		"create-file ~bob docs a.txt",
+		"list-files ~bob docs --sort-created desc",
+	)
+	if errOut != "Error: Not logged in.\nError: Not logged in.\n" {
+		t.Errorf("errors = %q", errOut)
+	}
+	if !strings.Contains(out, "Files in folder docs for user bob:\n- a.txt") {
+		t.Errorf("output = %q", out)
+	}
+}
+
+func TestSession_SharedAccess(t *testing.T) {
+	s := NewSession(storage.NewStorage(), nil, nil)
+	run(t, s, "register bob bob-password", "register amy amy-password", "login bob bob-password", "create-folder docs", "share-folder docs amy write", "login amy amy-password")
+
+	out, errOut := run(t, s, "create-file ~bob docs from-amy.txt", "list-files ~bob docs", "delete-folder ~bob docs")
+	if !strings.Contains(out, "- from-amy.txt") {
+		t.Errorf("output = %q", out)
+	}
+	if !strings.Contains(errOut, "Permission denied: amy cannot delete bob/docs.") {
+		t.Errorf("errors = %q", errOut)
+	}
+}
+
+func TestSession_Run(t *testing.T) {
+	var out bytes.Buffer
+	s := NewSession(storage.NewStorage(), &out, &out)
+	s.Run(strings.NewReader("register bob password\nlogin bob password\nbogus\n"))
+
+	want := "> User 'bob' registered successfully\n> Logged in as bob\nbob> Unknown command\nbob> Goodbye!\n"
+	if out.String() != want {
+		t.Errorf("Run() output = %q, want %q", out.String(), want)
+	}
+}
+
+func TestSession_Credentials(t *testing.T) {
+	s := NewSession(storage.NewStorage(), nil, nil)
+	if _, errOut := run(t, s, "register bob short"); errOut != "Error: The password must be at least 8 characters long.\n" {
+		t.Errorf("errors = %q", errOut)
+	}
+
+	// Every user registers with a password, and nobody logged out may set one
+	if _, errOut := run(t, s, "register amy", "passwd ~amy correct-horse"); errOut != "Usage: register <username> <password>\nError: Not logged in.\n" {
+		t.Errorf("errors = %q", errOut)
+	}
+
+	run(t, s, "register bob correct-horse")
+	if _, errOut := run(t, s, "create-folder ~bob more"); errOut != "Error: Not logged in.\n" {
+		t.Errorf("errors = %q, want not logged in", errOut)
+	}
+
+	out, _ := run(t, s, "login bob correct-horse", "token create ci")
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	secret := lines[len(lines)-1]
+	if !strings.HasPrefix(secret, "vfs_") {
+		t.Fatalf("token create output = %q", out)
+	}
+	id := strings.Fields(lines[1])[1]
+
+	out, _ = run(t, s, "token list")
+	if !strings.Contains(out, "- "+id+" ci ") || strings.Contains(out, secret) {
+		t.Errorf("token list output = %q", out)
+	}
+
+	run(t, s, "logout")
+	if out, errOut := run(t, s, "login bob "+secret); out != "Logged in as bob\n" {
+		t.Errorf("login with token: output %q, errors %q", out, errOut)
+	}
+
+	run(t, s, "token revoke "+id, "logout")
+	if _, errOut := run(t, s, "login bob "+secret); errOut != "Error: Invalid username or credentials.\n" {
+		t.Errorf("login with revoked token: errors %q", errOut)
+	}
+	if _, errOut := run(t, s, "token list"); errOut != "Error: Not logged in.\n" {
+		t.Errorf("token list when logged out: errors %q", errOut)
+	}
+}
+
+func TestSession_Admin(t *testing.T) {
+	s := NewSession(storage.NewStorage(), nil, nil)
+	run(t, s, "register root root-password", "register bob bob-password", "register amy amy-password")
+
+	if _, errOut := run(t, s, "login bob bob-password", "delete amy --force", "set-role bob admin", "passwd ~root takeover-pass", "logout"); strings.Count(errOut, "Permission denied") != 3 {
+		t.Errorf("errors = %q, want three permission errors", errOut)
+	}
+
+	out, errOut := run(t, s, "login root root-password", "passwd ~amy new-amy-password", "delete amy --force", "set-role bob admin", "delete root --force")
+	if !strings.Contains(out, "Password for amy updated successfully\nUser amy deleted successfully\nRole of bob set to admin\n") {
+		t.Errorf("output = %q", out)
+	}
+	if errOut != "" || s.User() != "" {
+		t.Errorf("errors = %q, User() = %q", errOut, s.User())
+	}
+}
+
+func TestSession_Groups(t *testing.T) {
+	s := NewSession(storage.NewStorage(), nil, nil)
+	run(t, s, "register alice alice-pass", "register bob bob-pass")
+
+	if _, errOut := run(t, s, "create-group devs"); errOut != "Error: Not logged in.\n" {
+		t.Errorf("errors = %q", errOut)
+	}
+
+	out, errOut := run(t, s, "login alice alice-pass", "create-folder docs", "create-group devs", "add-member devs bob", "share-folder docs @devs write", "list-groups", "logout")
+	if errOut != "" {
+		t.Fatalf("errors = %q", errOut)
+	}
+	if !strings.Contains(out, "Share alice/docs with @devs (write) successfully.\n") || !strings.Contains(out, "members: alice, bob\n") {
+		t.Errorf("output = %q", out)
+	}
+
+	out, errOut = run(t, s, "login bob bob-pass", "create-file ~alice docs plan.txt", "remove-member devs bob", "create-file ~alice docs late.txt")
+	if !strings.Contains(out, "Create plan.txt in alice/docs successfully.\nRemove bob from group devs successfully.\n") {
+		t.Errorf("output = %q", out)
+	}
+	if !strings.Contains(errOut, "Permission denied: bob cannot write to alice/docs.") {
+		t.Errorf("errors = %q", errOut)
+	}
+}
+
+func TestSession_Quota(t *testing.T) {
+	s := NewSession(storage.NewStorage(), nil, nil)
+	run(t, s, "register root root-password", "register bob bob-password")
+
+	out, errOut := run(t, s, "login root root-password", "set-quota bob folders 1", "set-quota bob bytes ten", "logout")
+	if out != "Logged in as root\nQuota of folders for bob set to 1\nLogged out root\n" {
+		t.Errorf("output = %q", out)
+	}
+	if errOut != "Error: The ten is not a valid quota limit.\n" {
+		t.Errorf("errors = %q", errOut)
+	}
+
+	_, errOut = run(t, s, "login bob bob-password", "create-folder ~bob docs Documents", "create-folder ~bob more")
+	if errOut != "Error: Quota exceeded: bob may store at most 1 folders.\n" {
+		t.Errorf("errors = %q", errOut)
+	}
+
+	out, _ = run(t, s, "quota ~bob")
+	if out != "Quota for user bob:\n- folders: 1/1\n- files: 0/unlimited\n- bytes: 9/unlimited\n" {
+		t.Errorf("quota output = %q", out)
+	}
+}
+
+func TestSession_Trash(t *testing.T) {
+	s := NewSession(storage.NewStorage(), nil, nil)
+	run(t, s, "register bob bob-password", "login bob bob-password", "create-folder ~bob docs", "create-file ~bob docs a.txt", "delete-folder ~bob docs")
+
+	out, _ := run(t, s, "trash list ~bob")
+	if !strings.HasPrefix(out, "Trash for user bob:\n- 1 folder docs ") {
+		t.Errorf("trash list output = %q", out)
+	}
+
+	out, errOut := run(t, s, "restore ~bob 1", "list-files ~bob docs", "restore ~bob 1", "trash")
+	if !strings.HasPrefix(out, "Restore docs for user bob successfully.\nFiles in folder docs for user bob:\n- a.txt") {
+		t.Errorf("output = %q", out)
+	}
+	if errOut != "Error: The trash item 1 not found.\nUsage: trash list [~username] | trash empty [~username]\n" {
+		t.Errorf("errors = %q", errOut)
+	}
+
+	out, _ = run(t, s, "delete-file ~bob docs a.txt", "trash empty ~bob", "trash list ~bob")
+	if !strings.HasSuffix(out, "Deleted 1 items from the trash of user bob\nTrash is empty for user bob\n") {
+		t.Errorf("output = %q", out)
+	}
+}
+
+func TestSession_DeleteUser(t *testing.T) {
+	s := NewSession(storage.NewStorage(), nil, nil)
+	run(t, s, "register root root-password", "register bob bob-password", "register amy amy-password",
+		"login bob bob-password", "create-folder ~bob docs Notes", "create-file ~bob docs a.txt", "login root root-password")
+
+	out, _ := run(t, s, "delete bob --dry-run")
+	if out != "Deleting user bob removes 1 folders, 1 files and 5 bytes, and 0 trashed items.\n" {
+		t.Errorf("dry run output = %q", out)
+	}
+
+	// Without input nothing is confirmed
+	out, _ = run(t, s, "delete bob")
+	if !strings.HasSuffix(out, "Delete user bob? [y/N] \nDeletion cancelled\n") || !s.isUser("bob") {
+		t.Errorf("unconfirmed output = %q", out)
+	}
+
+	s.in = bufio.NewScanner(strings.NewReader("yes\n"))
+	out, _ = run(t, s, "delete bob --transfer-to amy")
+	if !strings.Contains(out, "transfers 1 folders, 1 files and 5 bytes to amy") || !strings.Contains(out, "User bob deleted successfully\n") {
+		t.Errorf("confirmed output = %q", out)
+	}
+	if s.isUser("bob") {
+		t.Errorf("bob still exists after confirmed deletion")
+	}
+
+	if _, errOut := run(t, s, "delete amy --transfer-to", "delete --force"); strings.Count(errOut, "Usage: delete") != 2 {
+		t.Errorf("errors = %q", errOut)
+	}
+}
+
+func TestSession_Versions(t *testing.T) {
+	s := NewSession(storage.NewStorage(), nil, nil)
+	run(t, s, "register bob bob-password", "login bob bob-password", "create-folder ~bob docs", "create-file ~bob docs notes.txt")
+
+	out, errOut := run(t, s,
+		"write ~bob docs notes.txt hello world",
+		"write ~bob docs notes.txt goodbye",
+		"cat ~bob docs notes.txt",
+		"cat ~bob docs notes.txt --rev 1",
+		"revert ~bob docs notes.txt 1",
+		"cat ~bob docs notes.txt --rev x",
+	)
+	want := "Write notes.txt in bob/docs successfully (revision 1).\n" +
+		"Write notes.txt in bob/docs successfully (revision 2).\n" +
+		"goodbye\n" +
+		"hello world\n" +
+		"Revert notes.txt in bob/docs to revision 1 successfully (revision 3).\n"
+	if out != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+	if errOut != "Error: The x is not a valid revision.\n" {
+		t.Errorf("errors = %q", errOut)
+	}
+
+	out, _ = run(t, s, "set-revision-limit ~bob docs 2", "history ~bob docs notes.txt")
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 4 || lines[1] != "History of notes.txt in bob/docs:" || !strings.HasPrefix(lines[2], "- 2 ") || !strings.HasSuffix(lines[3], " bob 11 bytes") {
+		t.Errorf("history output = %q", out)
+	}
+}
+
+func TestSession_Snapshots(t *testing.T) {
+	s := NewSession(storage.NewStorage(), nil, nil)
+	run(t, s, "register bob bob-password", "login bob bob-password", "create-folder ~bob docs")
+
+	out, errOut := run(t, s,
+		"snapshot create ~bob before",
+		"create-folder ~bob scratch",
+		"snapshot restore ~bob before",
+		"list-folders ~bob",
+		"snapshot create ~bob",
+		"snapshot restore ~bob",
+	)
+	if !strings.HasPrefix(out, "Create snapshot before for user bob successfully.\nCreate scratch successfully.\nRestore snapshot before for user bob successfully.\nFolders for user bob:\n- docs ") {
+		t.Errorf("output = %q", out)
+	}
+	if !strings.Contains(out, "Create snapshot snapshot-") || !strings.HasPrefix(errOut, "Usage: snapshot create") {
+		t.Errorf("output = %q, errors = %q", out, errOut)
+	}
+
+	out, _ = run(t, s, "snapshot delete ~bob before", "snapshot list ~bob")
+	if !strings.HasPrefix(out, "Delete snapshot before for user bob successfully.\nSnapshots for user bob:\n- snapshot-") || strings.Count(out, "\n- ") != 1 {
+		t.Errorf("output = %q", out)
+	}
+}
+
+func TestSession_Transaction(t *testing.T) {
+	st := storage.NewStorage()
+	s := NewSession(st, nil, nil)
+
+	run(t, s, "register amy amy-password", "login amy amy-password")
+
+	out, errOut := run(t, s, "begin", "register bob bob-password", "create-folder docs", "create-folder docs")
+	if out != "" || errOut != "" || s.Prompt() != "amy (tx)> " {
+		t.Errorf("queued commands produced output %q, errors %q, prompt %q", out, errOut, s.Prompt())
+	}
+
+	out, errOut = run(t, s, "commit")
+	if out != "" || errOut != "Error: Transaction rolled back: create-folder docs: The docs has already existed.\n" {
+		t.Errorf("failed commit: output %q, errors %q", out, errOut)
+	}
+	if _, err := st.GetUser("bob"); err == nil {
+		t.Errorf("user from a rolled back transaction exists")
+	}
+
+	out, errOut = run(t, s, "begin", "register bob bob-password", "create-folder docs", "commit")
+	if out != "User 'bob' registered successfully\nCreate docs successfully.\nTransaction committed (2 commands)\n" || errOut != "" {
+		t.Errorf("commit: output %q, errors %q", out, errOut)
+	}
+
+	out, errOut = run(t, s, "begin", "delete-folder docs", "rollback", "rollback", "list-folders")
+	if !strings.HasPrefix(out, "Transaction rolled back (1 commands discarded)\nFolders for user amy:\n- docs ") {
+		t.Errorf("rollback: output %q", out)
+	}
+	if errOut != "Error: No transaction in progress.\n" {
+		t.Errorf("rollback: errors %q", errOut)
+	}
+
+	out, errOut = run(t, s, "begin", "watch ~amy", "login bob bob-password", "begin", "delete bob", "create-folder more", "commit")
+	if errOut != "Error: The watch command cannot be used in a transaction.\nError: The login command cannot be used in a transaction.\n"+
+		"Error: A transaction is already in progress.\nError: The delete command needs --force in a transaction.\n" {
+		t.Errorf("unqueueable commands: errors %q", errOut)
+	}
+	if !strings.HasSuffix(out, "Transaction committed (1 commands)\n") {
+		t.Errorf("unqueueable commands: output %q", out)
+	}
+}
+
+func TestSession_RunTransaction(t *testing.T) {
+	var out bytes.Buffer
+	s := NewSession(storage.NewStorage(), &out, &out)
+	s.Run(strings.NewReader("begin\nregister bob password\n"))
+
+	if !strings.HasSuffix(out.String(), "Transaction rolled back: not committed.\nGoodbye!\n") || s.isUser("bob") {
+		t.Errorf("Run() output = %q", out.String())
+	}
+}
+
+func TestSession_IfVersion(t *testing.T) {
+	s := NewSession(storage.NewStorage(), nil, nil)
+	run(t, s, "register bob bob-password", "login bob bob-password", "create-folder ~bob docs", "create-file ~bob docs a.txt")
+
+	out, _ := run(t, s, "stat ~bob docs", "stat ~bob docs a.txt")
+	if !strings.HasPrefix(out, "docs  ") || !strings.Contains(out, " (version 5)\na.txt  ") || !strings.HasSuffix(out, " (version 4)\n") {
+		t.Errorf("stat output = %q", out)
+	}
+
+	out, errOut := run(t, s,
+		"delete-file ~bob docs a.txt --if-version 2",
+		"delete-file ~bob docs a.txt --if-version x",
+		"delete-file ~bob docs a.txt --if-version 4",
+		"delete-folder ~bob docs --if-version 6",
+	)
+	if out != "Delete a.txt in bob/docs successfully.\nDelete docs successfully for user bob\n" {
+		t.Errorf("output = %q", out)
+	}
+	if errOut != "Error: Conflict: bob/docs/a.txt is at version 4, not 2.\nError: The x is not a valid version.\n" {
+		t.Errorf("errors = %q", errOut)
+	}
+}
+
+func TestSession_SetDescription(t *testing.T) {
+	st := storage.NewStorage()
+	s := NewSession(st, nil, nil)
+	run(t, s, "register bob bob-password", "login bob bob-password", "create-folder ~bob docs", "create-file ~bob docs a.txt")
+
+	out, errOut := run(t, s,
+		"set-description folder ~bob docs My documents --if-version 5",
+		"set-description file ~bob docs a.txt Meeting notes",
+		"set-description folder ~bob docs Stale --if-version 5",
+		"set-description folder docs",
+		"set-description dir bob docs Notes",
+	)
+	if out != "Update description of bob/docs successfully (version 6)\nUpdate description of bob/docs/a.txt successfully (version 7)\n" {
+		t.Errorf("output = %q", out)
+	}
+	if !strings.HasPrefix(errOut, "Error: Conflict: bob/docs is at version 6, not 5.\nUsage: set-description folder ") ||
+		strings.Count(errOut, "Usage: ") != 2 {
+		t.Errorf("errors = %q", errOut)
+	}
+
+	out, _ = run(t, s, "set-description folder docs Notes", "stat docs a.txt")
+	if !strings.Contains(out, "Update description of bob/docs successfully") || !strings.Contains(out, "a.txt Meeting notes ") {
+		t.Errorf("output with the username left out = %q", out)
+	}
+}
+
+func TestSession_Tags(t *testing.T) {
+	s := NewSession(storage.NewStorage(), nil, nil)
+	run(t, s, "register bob bob-password", "login bob bob-password", "create-folder ~bob apollo", "create-folder ~bob gemini", "create-file ~bob apollo plan.txt")
+
+	out, errOut := run(t, s,
+		"tag folder ~bob apollo project=apollo env=prod",
+		"tag file ~bob apollo plan.txt project=apollo env=dev",
+		"tag folder ~bob gemini project=gemini owner=bob",
+		"untag folder ~bob gemini owner",
+		"untag folder ~bob gemini project",
+		"tag folder ~bob gemini project",
+		"find-tags ~bob project=apollo, env!=prod",
+		"find-tags ~bob env",
+		"find-tags ~bob team",
+		"stat ~bob apollo",
+	)
+	want := "Tags of bob/apollo: env=prod,project=apollo\n" +
+		"Tags of bob/apollo/plan.txt: env=dev,project=apollo\n" +
+		"Tags of bob/gemini: owner=bob,project=gemini\n" +
+		"Tags of bob/gemini: project=gemini\n" +
+		"No tags left on bob/gemini\n" +
+		"bob/apollo/plan.txt env=dev,project=apollo\n" +
+		"bob/apollo env=prod,project=apollo\n" +
+		"bob/apollo/plan.txt env=dev,project=apollo\n" +
+		"No folders or files of user bob match team\n"
+	if !strings.HasPrefix(out, want) || !strings.HasSuffix(out, " [env=prod,project=apollo]\n") {
+		t.Errorf("output = %q", out)
+	}
+	if errOut != "Error: The tag project is not in key=value form.\n" {
+		t.Errorf("errors = %q", errOut)
+	}
+}
+
+func TestSession_Search(t *testing.T) {
+	s := NewSession(storage.NewStorage(), nil, nil)
+	run(t, s, "register bob bob-password", "login bob bob-password", "create-folder ~bob apollo Launch plans", "create-file ~bob apollo plan.txt", "write ~bob apollo plan.txt The launch plan")
+
+	out, errOut := run(t, s, `search ~bob "launch plan"`, "search ~bob launch", "search ~bob budget", `search ~bob "launch`)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "bob/apollo/plan.txt ") ||
+		!strings.HasPrefix(lines[1], "bob/apollo ") || !strings.HasPrefix(lines[2], "bob/apollo/plan.txt ") ||
+		lines[3] != "No folders or files of user bob match budget" {
+		t.Errorf("output = %q", out)
+	}
+	if errOut != "Error: The query has an unterminated quote.\n" {
+		t.Errorf("errors = %q", errOut)
+	}
+}
+
+func TestSession_ListFilters(t *testing.T) {
+	s := NewSession(storage.NewStorage(), nil, nil)
+	run(t, s, "register bob bob-password", "login bob bob-password", "create-folder ~bob reports Quarterly reports", "create-folder ~bob recipes", "create-folder ~bob photos",
+		"create-file ~bob reports q1.txt", "create-file ~bob reports q2.txt", "create-file ~bob reports summary.txt")
+
+	out, errOut := run(t, s,
+		"list-folders ~bob --prefix re --sort-created desc --limit 1",
+		"list-folders ~bob --match ^p --since 1h",
+		"list-folders ~bob --description quarterly",
+		"list-files ~bob reports --match ^q[0-9] --sort-name desc",
+		"list-files ~bob reports --until 2000-01-01",
+		"list-folders ~bob --limit 0",
+		"list-folders ~bob --match (",
+		"list-folders ~bob --prefix",
+	)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	want := []string{"Folders for user bob:", "- recipes ", "Folders for user bob:", "- photos ", "Folders for user bob:", "- reports Quarterly reports ",
+		"Files in folder reports for user bob:", "- q2.txt ", "- q1.txt ", "No files found in folder reports for user bob"}
+	if len(lines) != len(want) {
+		t.Fatalf("output = %q", out)
+	}
+	for i := range want {
+		if !strings.HasPrefix(lines[i], want[i]) {
+			t.Errorf("line %d = %q, want prefix %q", i, lines[i], want[i])
+		}
+	}
+	if !strings.HasPrefix(errOut, "Error: The 0 is not a valid limit.\nError: The ( is not a valid regular expression.\nUsage: list-folders ") {
+		t.Errorf("errors = %q", errOut)
+	}
+}
+
+func TestSession_ListSortSpec(t *testing.T) {
+	s := NewSession(storage.NewStorage(), nil, nil)
+	run(t, s, "register bob bob-password", "login bob bob-password", "create-folder ~bob b", "create-folder ~bob a", "create-folder ~bob c",
+		"create-file ~bob c one.txt", "create-file ~bob c two.txt", "create-file ~bob a x.txt")
+
+	out, errOut := run(t, s,
+		"list-folders ~bob --sort files:desc,name --limit 2",
+		"list-files ~bob c --sort name:desc",
+		"list-folders ~bob --sort owner",
+		"list-files ~bob c --sort files",
+	)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	want := []string{"Folders for user bob:", "- c ", "- a ", "Files in folder c for user bob:", "- two.txt ", "- one.txt "}
+	if len(lines) != len(want) {
+		t.Fatalf("output = %q", out)
+	}
+	for i := range want {
+		if !strings.HasPrefix(lines[i], want[i]) {
+			t.Errorf("line %d = %q, want prefix %q", i, lines[i], want[i])
+		}
+	}
+	if strings.Count(errOut, "Error: ") != 2 || !strings.Contains(errOut, "owner") {
+		t.Errorf("errors = %q", errOut)
+	}
+}
+
+func TestSession_Watch(t *testing.T) {
+	s := NewSession(storage.NewStorage(), nil, nil)
+	run(t, s, "register bob bob-password", "login bob bob-password")
+
+	out, errOut := run(t, s, "unwatch", "watch ~bob do", "create-folder ~bob docs", "create-folder ~bob pics", "create-file ~bob docs a.txt")
+	if errOut != "Error: Not watching.\n" {
+		t.Errorf("errors = %q", errOut)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 6 || lines[0] != "Watching bob/do* until unwatch" ||
+		!strings.HasPrefix(lines[2], "Event: ") || !strings.HasSuffix(lines[2], " created bob/docs by bob") ||
+		lines[3] != "Create pics successfully." || !strings.HasSuffix(lines[5], " created bob/docs/a.txt by bob") {
+		t.Errorf("output = %q", out)
+	}
+
+	out, _ = run(t, s, "unwatch", "delete-file ~bob docs a.txt")
+	if out != "Stopped watching\nDelete a.txt in bob/docs successfully.\n" {
+		t.Errorf("output after unwatch = %q", out)
+	}
+}
+
+func TestSession_Audit(t *testing.T) {
+	st := storage.NewStorage()
+	s := NewSession(st, nil, nil)
+	run(t, s, "register admin admin-password", "register bob bob-password", "login bob bob-password", "create-folder docs", "logout")
+
+	out, errOut := run(t, s, "login admin x", "audit query")
+	if out != "" || errOut != "Error: Invalid username or credentials.\nError: Not logged in.\n" {
+		t.Errorf("output = %q, errors = %q", out, errOut)
+	}
+
+	s.user = "admin"
+	out, errOut = run(t, s, "delete-folder ~bob docs", "audit query --user bob --op createfolder", "audit query --since 1h --op deletefolder", "audit query --since soon", "audit verify")
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 || !strings.HasSuffix(lines[0], " bob CreateFolder bob/docs ok") ||
+		!strings.HasSuffix(lines[1], " admin DeleteFolder bob/docs denied: Permission denied: admin cannot delete bob/docs.") ||
+		lines[2] != "Audit log verified (8 records)" {
+		t.Errorf("output = %q", out)
+	}
+	if errOut != "Error: Permission denied: admin cannot delete bob/docs.\nError: The soon is not a valid time or duration.\n" {
+		t.Errorf("errors = %q", errOut)
+	}
+}
@@ -1,50 +1,76 @@
 package file
 
 import (
-	"errors"
-	"strings"
 	"time"
 
-	"github.com/fatbrother/virtual-file-system/pkg/validator"
+	"github.com/fatbrother/virtual-file-system/internal/acl"
+	"github.com/fatbrother/virtual-file-system/internal/naming"
+	"github.com/fatbrother/virtual-file-system/internal/tag"
 )
 
-// File represents a file in the virtual file system
+// File represents a file in the virtual file system. Its contents are kept
+// as a list of revisions, the last being the current one.
 type File struct {
 	Name        string
 	Description string
-	CreatedAt   time.Time
+	// Tags are labels such as project=apollo; they are replaced, never changed in place
+	Tags      tag.Tags
+	CreatedAt time.Time
+	// ModifiedAt is when the file's description, access or contents last changed
+	ModifiedAt time.Time
+	ACL        *acl.ACL
+	// Version changes whenever the file's description, access or contents change
+	Version uint64
+
+	revisions []Revision
 }
 
-// NewFile creates a new File instance
-func NewFile(name, description string) (*File, error) {
+// NewFile creates a new File instance owned by owner
+func NewFile(name, description, owner string) (*File, error) {
 	if err := ValidateFileName(name); err != nil {
 		return nil, err
 	}
 
+	now := time.Now()
 	return &File{
-		Name:        strings.ToLower(name),
+		Name:        naming.Normalize(name),
 		Description: description,
-		CreatedAt:   time.Now(),
+		CreatedAt:   now,
+		ModifiedAt:  now,
+		ACL:         acl.New(owner),
 	}, nil
 }
 
 // ValidateFileName checks if the file name is valid
 func ValidateFileName(name string) error {
-	validators := []validator.Validator{
-		validator.NewLengthValidator(1, 50),
-		validator.NewPatternValidator("^[a-zA-Z0-9_\\-\\.]+$"),
-	}
-
-	for _, v := range validators {
-		if pass := v.Validate(name); !pass {
-			return errors.New("The " + name + " is invalid.")
-		}
-	}
-
-	return nil
+	return naming.CheckFileName(name)
 }
 
 // Format prints the file details
 func (f *File) Format() string {
 	return f.Name + " " + f.Description + " " + f.CreatedAt.Format(time.RFC3339)
-}
\ No newline at end of file
+}
+
+// Key returns the case-insensitive lookup key for the file
+func (f *File) Key() string {
+	return naming.Key(f.Name)
+}
+
+// Size returns the number of bytes the file counts against its owner's quota:
+// its description, tags and every retained revision
+func (f *File) Size() int64 {
+	size := int64(len(f.Description)) + f.Tags.Size()
+	for _, rev := range f.revisions {
+		size += rev.Size
+	}
+	return size
+}
+
+// Clone returns a copy of the file that can be changed without affecting the
+// original. Revision contents are never modified, so they are shared.
+func (f *File) Clone() *File {
+	c := *f
+	c.ACL = f.ACL.Clone()
+	c.revisions = append([]Revision(nil), f.revisions...)
+	return &c
+}
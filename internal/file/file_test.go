@@ -6,10 +6,10 @@ import (
 
 func TestNewFile(t *testing.T) {
 	tests := []struct {
-		name		string
-		fileName	string
-		description	string
-		wantErr		bool
+		name        string
+		fileName    string
+		description string
+		wantErr     bool
 	}{
 		{"Valid file name", "validfile.txt", "A valid file", false},
 		{"Empty file name", "", "Empty file", true},
@@ -22,7 +22,7 @@ func TestNewFile(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := NewFile(tt.fileName, tt.description)
+			_, err := NewFile(tt.fileName, tt.description, "owner")
 			if (err != nil) != tt.wantErr {
 				t.Errorf("NewFile() error = %v, wantErr %v", err, tt.wantErr)
 			}
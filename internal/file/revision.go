@@ -0,0 +1,86 @@
+package file
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// Revision is one version of a file's contents
+type Revision struct {
+	Number    int
+	CreatedAt time.Time
+	Author    string
+	Size      int64
+
+	data []byte
+}
+
+// Content returns a copy of the revision's contents
+func (r Revision) Content() []byte {
+	return append([]byte(nil), r.data...)
+}
+
+// Format prints the revision details
+func (r Revision) Format() string {
+	return strconv.Itoa(r.Number) + " " + r.CreatedAt.Format(time.RFC3339) + " " + r.Author + " " + strconv.FormatInt(r.Size, 10) + " bytes"
+}
+
+// Write replaces the file's contents, keeping the previous contents as an
+// older revision. With keep > 0, only the newest keep revisions are retained.
+func (f *File) Write(data []byte, author string, keep int) Revision {
+	number := 1
+	if n := len(f.revisions); n > 0 {
+		number = f.revisions[n-1].Number + 1
+	}
+
+	rev := Revision{
+		Number:    number,
+		CreatedAt: time.Now(),
+		Author:    author,
+		Size:      int64(len(data)),
+		data:      append([]byte(nil), data...),
+	}
+	f.revisions = append(f.revisions, rev)
+	f.Prune(keep)
+	return rev
+}
+
+// Revert writes the contents of an earlier revision as a new revision
+func (f *File) Revert(number int, author string, keep int) (Revision, error) {
+	rev, err := f.Revision(number)
+	if err != nil {
+		return Revision{}, err
+	}
+	return f.Write(rev.data, author, keep), nil
+}
+
+// Prune drops the oldest revisions so at most keep remain. A keep of 0 retains all.
+func (f *File) Prune(keep int) {
+	if keep > 0 && len(f.revisions) > keep {
+		f.revisions = append([]Revision(nil), f.revisions[len(f.revisions)-keep:]...)
+	}
+}
+
+// Current returns the latest revision, or false if nothing has been written
+func (f *File) Current() (Revision, bool) {
+	if len(f.revisions) == 0 {
+		return Revision{}, false
+	}
+	return f.revisions[len(f.revisions)-1], true
+}
+
+// Revision returns the revision with the given number
+func (f *File) Revision(number int) (Revision, error) {
+	for _, rev := range f.revisions {
+		if rev.Number == number {
+			return rev, nil
+		}
+	}
+	return Revision{}, errors.New("The revision " + strconv.Itoa(number) + " of " + f.Name + " not found.")
+}
+
+// Revisions returns the retained revisions, oldest first
+func (f *File) Revisions() []Revision {
+	return append([]Revision(nil), f.revisions...)
+}
@@ -0,0 +1,69 @@
+package file
+
+import (
+	"testing"
+)
+
+func TestFile_Write(t *testing.T) {
+	f, _ := NewFile("notes.txt", "", "owner")
+	if _, ok := f.Current(); ok {
+		t.Errorf("Current() of a new file reported contents")
+	}
+
+	f.Write([]byte("one"), "alice", 0)
+	f.Write([]byte("three"), "bob", 0)
+
+	current, ok := f.Current()
+	if !ok || current.Number != 2 || string(current.Content()) != "three" || current.Author != "bob" || current.Size != 5 {
+		t.Errorf("Current() = %+v", current)
+	}
+	if f.Size() != 8 {
+		t.Errorf("Size() = %d, want 8", f.Size())
+	}
+
+	rev, err := f.Revert(1, "carol", 0)
+	if err != nil || rev.Number != 3 || string(rev.Content()) != "one" {
+		t.Errorf("Revert(1) = %+v, %v", rev, err)
+	}
+	if len(f.Revisions()) != 3 {
+		t.Errorf("Revert() should keep the history, got %d revisions", len(f.Revisions()))
+	}
+
+	// Returned contents do not alias the stored revision
+	rev.Content()[0] = 'X'
+	if got, _ := f.Revision(3); string(got.Content()) != "one" {
+		t.Errorf("Revision(3) changed through a returned copy: %q", got.Content())
+	}
+}
+
+func TestFile_Prune(t *testing.T) {
+	f, _ := NewFile("notes.txt", "", "owner")
+	for _, data := range []string{"a", "bb", "ccc", "dddd"} {
+		f.Write([]byte(data), "owner", 3)
+	}
+
+	revisions := f.Revisions()
+	if len(revisions) != 3 || revisions[0].Number != 2 || revisions[2].Number != 4 {
+		t.Errorf("Revisions() after pruning = %v", revisions)
+	}
+	if _, err := f.Revert(1, "owner", 3); err == nil {
+		t.Errorf("Revert() to a pruned revision succeeded")
+	}
+
+	f.Prune(1)
+	if revisions := f.Revisions(); len(revisions) != 1 || revisions[0].Number != 4 || f.Size() != 4 {
+		t.Errorf("Prune(1) left %v", revisions)
+	}
+}
+
+func TestFile_Clone(t *testing.T) {
+	f, _ := NewFile("notes.txt", "", "owner")
+	f.Write([]byte("one"), "owner", 0)
+
+	c := f.Clone()
+	c.Write([]byte("two"), "owner", 0)
+
+	if len(f.Revisions()) != 1 || len(c.Revisions()) != 2 {
+		t.Errorf("writing a clone changed the original: %d and %d revisions", len(f.Revisions()), len(c.Revisions()))
+	}
+}
@@ -1,52 +1,76 @@
 package folder
 
 import (
-	"errors"
-	"strings"
 	"time"
 
+	"github.com/fatbrother/virtual-file-system/internal/acl"
+	"github.com/fatbrother/virtual-file-system/internal/naming"
+	"github.com/fatbrother/virtual-file-system/internal/tag"
 	"github.com/fatbrother/virtual-file-system/pkg/trie"
-	"github.com/fatbrother/virtual-file-system/pkg/validator"
 )
 
 // Folder represents a folder in the virtual file system
 type Folder struct {
 	Name        string
 	Description string
-	CreatedAt   time.Time
-	Files       *trie.Trie
+	// Tags are labels such as project=apollo; they are replaced, never changed in place
+	Tags      tag.Tags
+	CreatedAt time.Time
+	// ModifiedAt is when the folder or its list of files last changed
+	ModifiedAt time.Time
+	Files      *trie.Trie
+	ACL        *acl.ACL
+	// MaxRevisions is how many revisions each file keeps; 0 keeps all
+	MaxRevisions int
+	// Version changes whenever the folder or its list of files change
+	Version uint64
 }
 
-// NewFolder creates a new Folder with the given name and description
-func NewFolder(name, description string) (*Folder, error) {
+// NewFolder creates a new Folder with the given name and description, owned by owner
+func NewFolder(name, description, owner string) (*Folder, error) {
 	if err := validateFolderName(name); err != nil {
 		return nil, err
 	}
+	now := time.Now()
 	return &Folder{
-		Name:        strings.ToLower(name),
+		Name:        naming.Normalize(name),
 		Description: description,
-		CreatedAt:   time.Now(),
+		CreatedAt:   now,
+		ModifiedAt:  now,
 		Files:       trie.NewTrie(),
+		ACL:         acl.New(owner),
 	}, nil
 }
 
 // validateFolderName checks if the folder name is valid
 func validateFolderName(name string) error {
-	validators := []validator.Validator{
-		validator.NewLengthValidator(1, 50),
-		validator.NewPatternValidator("^[a-zA-Z0-9_-]+$"),
-	}
-
-	for _, v := range validators {
-		if pass := v.Validate(name); !pass {
-			return errors.New("The " + name + " is invalid.")
-		}
-	}
-
-	return nil
+	return naming.CheckFolderName(name)
 }
 
 // Format prints the folder details
 func (f *Folder) Format() string {
 	return f.Name + " " + f.Description + " " + f.CreatedAt.Format(time.RFC3339)
-}
\ No newline at end of file
+}
+
+// Key returns the case-insensitive lookup key for the folder
+func (f *Folder) Key() string {
+	return naming.Key(f.Name)
+}
+
+// Size returns the number of bytes the folder counts against its owner's
+// quota: its description and tags
+func (f *Folder) Size() int64 {
+	return int64(len(f.Description)) + f.Tags.Size()
+}
+
+// Clone returns a copy of the folder that can be changed without affecting
+// the original. The files themselves are shared, not copied.
+func (f *Folder) Clone() *Folder {
+	c := *f
+	c.ACL = f.ACL.Clone()
+	c.Files = trie.NewTrie()
+	for key, value := range f.Files.PrefixSearch("") {
+		c.Files.Insert(key, value)
+	}
+	return &c
+}
@@ -2,6 +2,8 @@ package folder
 
 import (
 	"testing"
+
+	"github.com/fatbrother/virtual-file-system/internal/acl"
 )
 
 func TestNewFolder(t *testing.T) {
@@ -22,10 +24,27 @@ func TestNewFolder(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := NewFolder(tt.folderName, tt.description)
+			_, err := NewFolder(tt.folderName, tt.description, "owner")
 			if (err != nil) != tt.wantErr {
 				t.Errorf("NewFolder() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
 }
+
+func TestFolder_Clone(t *testing.T) {
+	f, _ := NewFolder("docs", "Documents", "owner")
+	f.Files.Insert("a.txt", "a")
+
+	c := f.Clone()
+	c.Files.Insert("b.txt", "b")
+	c.ACL.Grant("reader", acl.Read)
+	c.Description = "Changed"
+
+	if _, ok := f.Files.Search("b.txt"); ok || f.ACL.Allows("reader", acl.Read) || f.Description != "Documents" {
+		t.Errorf("changing a clone changed the original")
+	}
+	if v, ok := c.Files.Search("a.txt"); !ok || v != "a" {
+		t.Errorf("Clone() lost the original files")
+	}
+}
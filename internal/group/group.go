@@ -0,0 +1,108 @@
+package group
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fatbrother/virtual-file-system/internal/naming"
+)
+
+// principalPrefix marks group principals in ACLs so they cannot be confused
+// with users; it is not allowed in group or user names by default
+const principalPrefix = "@"
+
+// Group is a named set of users that can be granted access together.
+// Members and Owner are user lookup keys.
+type Group struct {
+	Name      string
+	CreatedAt time.Time
+	Owner     string
+	Members   map[string]bool
+}
+
+// NewGroup creates a new Group with the given name, owned by owner who is also its first member
+func NewGroup(name, owner string) (*Group, error) {
+	if err := validateGroupName(name); err != nil {
+		return nil, err
+	}
+	return &Group{
+		Name:      naming.Normalize(name),
+		CreatedAt: time.Now(),
+		Owner:     owner,
+		Members:   map[string]bool{owner: true},
+	}, nil
+}
+
+// validateGroupName checks if the group name is valid
+func validateGroupName(name string) error {
+	return naming.CheckGroupName(name)
+}
+
+// Key returns the case-insensitive lookup key for the group
+func (g *Group) Key() string {
+	return naming.Key(g.Name)
+}
+
+// Principal returns the identifier under which the group appears in ACLs
+func (g *Group) Principal() string {
+	return Principal(g.Name)
+}
+
+// Principal returns the ACL identifier of the group with the given name
+func Principal(name string) string {
+	return principalPrefix + naming.Key(name)
+}
+
+// IsPrincipal reports whether an ACL identifier refers to a group
+func IsPrincipal(principal string) bool {
+	return len(principal) > len(principalPrefix) && strings.HasPrefix(principal, principalPrefix)
+}
+
+// AddMember adds a user to the group and reports whether they were not a member yet
+func (g *Group) AddMember(member string) bool {
+	if g.Members[member] {
+		return false
+	}
+	g.Members[member] = true
+	return true
+}
+
+// RemoveMember removes a user from the group and reports whether they were a member
+func (g *Group) RemoveMember(member string) bool {
+	if !g.Members[member] {
+		return false
+	}
+	delete(g.Members, member)
+	return true
+}
+
+// HasMember reports whether a user belongs to the group
+func (g *Group) HasMember(member string) bool {
+	return g.Members[member]
+}
+
+// MemberKeys returns the members' lookup keys, sorted
+func (g *Group) MemberKeys() []string {
+	members := make([]string, 0, len(g.Members))
+	for member := range g.Members {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members
+}
+
+// Format prints the group details
+func (g *Group) Format() string {
+	return g.Name + " " + g.CreatedAt.Format(time.RFC3339)
+}
+
+// Clone returns a copy of the group with its own member set
+func (g *Group) Clone() *Group {
+	c := *g
+	c.Members = make(map[string]bool, len(g.Members))
+	for member := range g.Members {
+		c.Members[member] = true
+	}
+	return &c
+}
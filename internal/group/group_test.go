@@ -0,0 +1,56 @@
+package group
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewGroup(t *testing.T) {
+	tests := []struct {
+		name      string
+		groupName string
+		wantErr   bool
+	}{
+		{"Valid group name", "Developers", false},
+		{"Empty group name", "", true},
+		{"Invalid characters", "dev team", true},
+		{"Principal prefix", "@devs", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewGroup(tt.groupName, "owner")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewGroup() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && (got.Name != tt.groupName || !got.HasMember("owner")) {
+				t.Errorf("NewGroup() = %+v", got)
+			}
+		})
+	}
+}
+
+func TestGroup_Members(t *testing.T) {
+	g, _ := NewGroup("devs", "owner")
+
+	if !g.AddMember("bob") || g.AddMember("bob") {
+		t.Errorf("AddMember() should only report new members")
+	}
+	if got := g.MemberKeys(); !reflect.DeepEqual(got, []string{"bob", "owner"}) {
+		t.Errorf("MemberKeys() = %v", got)
+	}
+	if !g.RemoveMember("bob") || g.RemoveMember("bob") || g.HasMember("bob") {
+		t.Errorf("RemoveMember() should only report existing members")
+	}
+}
+
+func TestPrincipal(t *testing.T) {
+	g, _ := NewGroup("DevOps", "owner")
+	if g.Principal() != "@devops" || Principal("DEVOPS") != g.Principal() {
+		t.Errorf("Principal() = %q", g.Principal())
+	}
+	if !IsPrincipal(g.Principal()) || IsPrincipal("devops") || IsPrincipal("@") {
+		t.Errorf("IsPrincipal() misclassified a principal")
+	}
+}
@@ -0,0 +1,229 @@
+package naming
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sync"
+
+	"github.com/fatbrother/virtual-file-system/pkg/validator"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Rule describes the constraints on one kind of name. Lengths count
+// user-perceived characters (grapheme clusters) of the NFC form.
+type Rule struct {
+	MinLength         int      `json:"min_length"`
+	MaxLength         int      `json:"max_length"`
+	MaxBytes          int      `json:"max_bytes,omitempty"`
+	Pattern           string   `json:"pattern"`
+	PatternRule       string   `json:"pattern_rule,omitempty"`
+	Reserved          []string `json:"reserved,omitempty"`
+	ForbiddenPrefixes []string `json:"forbidden_prefixes,omitempty"`
+	// AllowMixedScripts permits names mixing scripts, such as a Cyrillic letter in a Latin name
+	AllowMixedScripts bool `json:"allow_mixed_scripts,omitempty"`
+	// AllowCompatibility permits fullwidth forms, ligatures and similar lookalikes
+	AllowCompatibility bool `json:"allow_compatibility,omitempty"`
+}
+
+// Policy holds the naming rules for users, groups, folders and files
+type Policy struct {
+	User   Rule `json:"user"`
+	Group  Rule `json:"group"`
+	Folder Rule `json:"folder"`
+	File   Rule `json:"file"`
+}
+
+// compiled holds the validators built from a Policy
+type compiled struct {
+	user   validator.Validator
+	group  validator.Validator
+	folder validator.Validator
+	file   validator.Validator
+}
+
+var (
+	mu      sync.RWMutex
+	current *compiled
+)
+
+func init() {
+	c, err := compile(DefaultPolicy())
+	if err != nil {
+		panic(err)
+	}
+	current = c
+}
+
+// DefaultPolicy returns the built-in naming rules
+func DefaultPolicy() *Policy {
+	return &Policy{
+		User: Rule{
+			MinLength:   1,
+			MaxLength:   50,
+			Pattern:     `^[\p{L}\p{M}\p{N}_-]+$`,
+			PatternRule: "may only contain letters, digits, '_' and '-'",
+		},
+		Group: Rule{
+			MinLength:   1,
+			MaxLength:   50,
+			Pattern:     `^[\p{L}\p{M}\p{N}_-]+$`,
+			PatternRule: "may only contain letters, digits, '_' and '-'",
+		},
+		Folder: Rule{
+			MinLength:   1,
+			MaxLength:   50,
+			Pattern:     `^[\p{L}\p{M}\p{N}_-]+$`,
+			PatternRule: "may only contain letters, digits, '_' and '-'",
+		},
+		File: Rule{
+			MinLength:   1,
+			MaxLength:   50,
+			Pattern:     `^[\p{L}\p{M}\p{N}_.-]+$`,
+			PatternRule: "may only contain letters, digits, '_', '-' and '.'",
+		},
+	}
+}
+
+// Load reads a JSON policy file. Rules or fields missing from the file keep their defaults.
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("naming policy: %w", err)
+	}
+
+	policy := DefaultPolicy()
+	if err := json.Unmarshal(data, policy); err != nil {
+		return nil, fmt.Errorf("naming policy %s: %w", path, err)
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, fmt.Errorf("naming policy %s: %w", path, err)
+	}
+	return policy, nil
+}
+
+// Validate checks that every rule in the policy is usable
+func (p *Policy) Validate() error {
+	_, err := compile(p)
+	return err
+}
+
+// Set makes p the policy consulted by CheckUsername, CheckGroupName, CheckFolderName and CheckFileName
+func Set(p *Policy) error {
+	c, err := compile(p)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	current = c
+	return nil
+}
+
+// Normalize returns the canonical (NFC) form in which names are validated and stored
+func Normalize(name string) string {
+	return norm.NFC.String(name)
+}
+
+// Key returns the lookup key for a name. Names that differ only in case or
+// in Unicode normalization form share a key, so they are treated as duplicates.
+func Key(name string) string {
+	return norm.NFC.String(cases.Fold().String(norm.NFD.String(name)))
+}
+
+// CheckUsername validates a username against the current policy
+func CheckUsername(name string) error {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return validator.Check(current.user, Normalize(name))
+}
+
+// CheckGroupName validates a group name against the current policy
+func CheckGroupName(name string) error {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return validator.Check(current.group, Normalize(name))
+}
+
+// CheckFolderName validates a folder name against the current policy
+func CheckFolderName(name string) error {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return validator.Check(current.folder, Normalize(name))
+}
+
+// CheckFileName validates a file name against the current policy
+func CheckFileName(name string) error {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return validator.Check(current.file, Normalize(name))
+}
+
+func compile(p *Policy) (*compiled, error) {
+	user, err := p.User.validator()
+	if err != nil {
+		return nil, fmt.Errorf("user: %w", err)
+	}
+	group, err := p.Group.validator()
+	if err != nil {
+		return nil, fmt.Errorf("group: %w", err)
+	}
+	folder, err := p.Folder.validator()
+	if err != nil {
+		return nil, fmt.Errorf("folder: %w", err)
+	}
+	file, err := p.File.validator()
+	if err != nil {
+		return nil, fmt.Errorf("file: %w", err)
+	}
+	return &compiled{user: user, group: group, folder: folder, file: file}, nil
+}
+
+// validator builds the validator enforcing r
+func (r Rule) validator() (validator.Validator, error) {
+	if r.MinLength < 0 || r.MaxLength < r.MinLength || r.MaxLength == 0 {
+		return nil, fmt.Errorf("invalid length range %d-%d", r.MinLength, r.MaxLength)
+	}
+	if r.MaxBytes < 0 {
+		return nil, fmt.Errorf("invalid max bytes %d", r.MaxBytes)
+	}
+	if _, err := regexp.Compile(r.Pattern); err != nil {
+		return nil, err
+	}
+
+	validators := []validator.Validator{
+		validator.NewGraphemeLengthValidator(r.MinLength, r.MaxLength),
+		validator.NewControlCharacterValidator(),
+	}
+	if !r.AllowCompatibility {
+		validators = append(validators, validator.NewCompatibilityCharacterValidator())
+	}
+	if !r.AllowMixedScripts {
+		validators = append(validators, validator.NewMixedScriptValidator())
+	}
+	if r.MaxBytes > 0 {
+		validators = append(validators, validator.NewByteLengthValidator(r.MaxBytes))
+	}
+	if len(r.ForbiddenPrefixes) > 0 {
+		validators = append(validators, validator.NewForbiddenPrefixValidator(r.ForbiddenPrefixes...))
+	}
+	if len(r.Reserved) > 0 {
+		validators = append(validators, validator.NewReservedNameValidator(r.Reserved...))
+	}
+
+	pattern := validator.NewPatternValidator(r.Pattern)
+	if r.PatternRule != "" {
+		pattern.WithRule(r.PatternRule)
+	}
+	validators = append(validators, pattern)
+
+	return validator.All(validators...), nil
+}
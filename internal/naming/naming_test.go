@@ -0,0 +1,162 @@
+package naming
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDefaultPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		check   func(string) error
+		input   string
+		wantErr bool
+	}{
+		{"Valid username", CheckUsername, "valid_user", false},
+		{"Username with dot", CheckUsername, "invalid.user", true},
+		{"Valid group name", CheckGroupName, "dev-team", false},
+		{"Group name with at sign", CheckGroupName, "@devs", true},
+		{"Valid folder name", CheckFolderName, "valid-folder", false},
+		{"Too long folder name", CheckFolderName, strings.Repeat("a", 51), true},
+		{"Valid file name", CheckFileName, "file.txt", false},
+		{"Empty file name", CheckFileName, "", true},
+		{"Accented username", CheckUsername, "jos\u00e9", false},
+		{"Decomposed folder name", CheckFolderName, "cafe\u0301", false},
+		{"Japanese file name", CheckFileName, "日本語のメモ_2024", false},
+		{"Folder name with space", CheckFolderName, "my folder", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.check(tt.input); (err != nil) != tt.wantErr {
+				t.Errorf("check(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "naming.json")
+	config := `{"file": {"max_length": 100, "pattern": "^[\\p{L}\\p{N}_\\-\\.]+$", "reserved": [".", ".."]}}`
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if policy.File.MaxLength != 100 || policy.File.MinLength != 1 {
+		t.Errorf("Load() file rule = %+v, want max 100 and default min 1", policy.File)
+	}
+	if !reflect.DeepEqual(policy.User, DefaultPolicy().User) {
+		t.Errorf("Load() user rule = %+v, want default", policy.User)
+	}
+
+	if err := Set(policy); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	defer Set(DefaultPolicy())
+
+	tests := []struct {
+		input   string
+		wantErr bool
+	}{
+		{strings.Repeat("a", 100), false},
+		{strings.Repeat("a", 101), true},
+		{"résumé.txt", false},
+		{"..", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if err := CheckFileName(tt.input); (err != nil) != tt.wantErr {
+				t.Errorf("CheckFileName(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{"Malformed JSON", `{"file": `},
+		{"Bad pattern", `{"folder": {"pattern": "["}}`},
+		{"Bad length range", `{"user": {"min_length": 10, "max_length": 5}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "naming.json")
+			if err := os.WriteFile(path, []byte(tt.config), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := Load(path); err == nil {
+				t.Errorf("Load() expected error for %s", tt.config)
+			}
+		})
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Errorf("Load() expected error for missing file")
+	}
+}
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		same bool
+	}{
+		{"Case", "Report", "rEPORT", true},
+		{"NFC and NFD", "caf\u00e9", "cafe\u0301", true},
+		{"Full case folding", "STRASSE", "straße", true},
+		{"Greek final sigma", "ΟΔΟΣ", "οδος", true},
+		{"Different names", "report", "reports", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Key(tt.a) == Key(tt.b); got != tt.same {
+				t.Errorf("Key(%q) == Key(%q) = %v, want %v", tt.a, tt.b, got, tt.same)
+			}
+		})
+	}
+}
+
+func TestUnicodeRules(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.File.MaxLength = 5
+	policy.File.Pattern = `^[\p{L}\p{M}\p{N}\p{So}\x{200d}_\-\.]+$`
+	if err := Set(policy); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	defer Set(DefaultPolicy())
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{"Decomposed accents count per character", "e\u0301e\u0301e\u0301e\u0301e\u0301", false},
+		{"Too many characters", "abcdef", true},
+		{"Control character", "a\tb", true},
+		{"Mixed scripts", "p\u0430y", true},
+		{"Fullwidth letters", "ａｂｃ", true},
+		{"Emoji sequence", "\U0001F469\u200d\U0001F4BB", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckFileName(tt.input); (err != nil) != tt.wantErr {
+				t.Errorf("CheckFileName(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+		})
+	}
+}
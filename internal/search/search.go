@@ -0,0 +1,227 @@
+package search
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/text/cases"
+)
+
+// Tokenize splits text into case-folded words: runs of letters and digits
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(cases.Fold().String(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Query is a search: documents must contain every phrase. A phrase of one
+// word is a plain term.
+type Query struct {
+	Phrases [][]string
+}
+
+// ParseQuery reads words and "quoted phrases"
+func ParseQuery(s string) (Query, error) {
+	if strings.Count(s, `"`)%2 != 0 {
+		return Query{}, errors.New("The query has an unterminated quote.")
+	}
+	var q Query
+	for i, part := range strings.Split(s, `"`) {
+		words := Tokenize(part)
+		if i%2 == 1 {
+			// Inside quotes
+			if len(words) > 0 {
+				q.Phrases = append(q.Phrases, words)
+			}
+			continue
+		}
+		for _, word := range words {
+			q.Phrases = append(q.Phrases, []string{word})
+		}
+	}
+	if len(q.Phrases) == 0 {
+		return Query{}, errors.New("The query has no words to search for.")
+	}
+	return q, nil
+}
+
+// String prints the query in the form ParseQuery reads
+func (q Query) String() string {
+	parts := make([]string, len(q.Phrases))
+	for i, phrase := range q.Phrases {
+		parts[i] = strings.Join(phrase, " ")
+		if len(phrase) > 1 {
+			parts[i] = `"` + parts[i] + `"`
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Hit is a document matching a query
+type Hit struct {
+	ID    string
+	Score float64
+}
+
+// Index is an inverted index from words to the documents containing them,
+// kept up to date one document at a time. It is safe for concurrent use.
+type Index struct {
+	mu sync.RWMutex
+	// postings maps each word to the positions where it occurs in each document
+	postings map[string]map[string][]int
+	// docs maps each document to its distinct words, so it can be removed
+	docs map[string][]string
+}
+
+// NewIndex creates an empty index
+func NewIndex() *Index {
+	return &Index{
+		postings: make(map[string]map[string][]int),
+		docs:     make(map[string][]string),
+	}
+}
+
+// Add indexes text as the document id, replacing what was indexed for it before
+func (ix *Index) Add(id, text string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.removeLocked(id)
+	words := Tokenize(text)
+	if len(words) == 0 {
+		return
+	}
+	for pos, word := range words {
+		docs, ok := ix.postings[word]
+		if !ok {
+			docs = make(map[string][]int)
+			ix.postings[word] = docs
+		}
+		if _, seen := docs[id]; !seen {
+			ix.docs[id] = append(ix.docs[id], word)
+		}
+		docs[id] = append(docs[id], pos)
+	}
+}
+
+// Remove drops a document from the index
+func (ix *Index) Remove(id string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.removeLocked(id)
+}
+
+// RemovePrefix drops every document whose id starts with prefix
+func (ix *Index) RemovePrefix(prefix string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	for id := range ix.docs {
+		if strings.HasPrefix(id, prefix) {
+			ix.removeLocked(id)
+		}
+	}
+}
+
+// removeLocked drops a document, and the words no other document contains
+func (ix *Index) removeLocked(id string) {
+	for _, word := range ix.docs[id] {
+		delete(ix.postings[word], id)
+		if len(ix.postings[word]) == 0 {
+			delete(ix.postings, word)
+		}
+	}
+	delete(ix.docs, id)
+}
+
+// IDs returns the ids of the indexed documents starting with prefix, sorted
+func (ix *Index) IDs(prefix string) []string {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	var ids []string
+	for id := range ix.docs {
+		if strings.HasPrefix(id, prefix) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Search returns the documents containing every phrase of the query, best
+// first. A document scores the TF-IDF of each phrase: how often the phrase
+// occurs in it, times the inverse document frequency of the phrase's words.
+// Documents with equal scores are sorted by id.
+func (ix *Index) Search(q Query) []Hit {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	scores := make(map[string]float64)
+	for i, phrase := range q.Phrases {
+		counts := ix.phraseCountsLocked(phrase)
+		var idf float64
+		for _, word := range phrase {
+			idf += ix.idfLocked(word)
+		}
+		next := make(map[string]float64, len(counts))
+		for id, count := range counts {
+			if score, ok := scores[id]; ok || i == 0 {
+				next[id] = score + float64(count)*idf
+			}
+		}
+		scores = next
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, Hit{ID: id, Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	return hits
+}
+
+// idfLocked returns the inverse document frequency of a word. One is added
+// so words found in every document still count.
+func (ix *Index) idfLocked(word string) float64 {
+	n := len(ix.postings[word])
+	if n == 0 {
+		return 0
+	}
+	return 1 + math.Log(float64(len(ix.docs))/float64(n))
+}
+
+// phraseCountsLocked returns how often the phrase occurs in each document containing it
+func (ix *Index) phraseCountsLocked(phrase []string) map[string]int {
+	counts := make(map[string]int)
+	for id, starts := range ix.postings[phrase[0]] {
+		for _, start := range starts {
+			if ix.followedLocked(id, phrase[1:], start+1) {
+				counts[id]++
+			}
+		}
+	}
+	return counts
+}
+
+// followedLocked reports whether the words occur in document id one after another from position pos
+func (ix *Index) followedLocked(id string, words []string, pos int) bool {
+	for i, word := range words {
+		positions := ix.postings[word][id]
+		j := sort.SearchInts(positions, pos+i)
+		if j == len(positions) || positions[j] != pos+i {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	got := Tokenize("Launch-plan for APOLLO 11, ÜBER straße!")
+	want := []string{"launch", "plan", "for", "apollo", "11", "über", "strasse"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Tokenize() = %q, want %q", got, want)
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	q, err := ParseQuery(`apollo "Launch  Plan" budget`)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	want := [][]string{{"apollo"}, {"launch", "plan"}, {"budget"}}
+	if !reflect.DeepEqual(q.Phrases, want) {
+		t.Errorf("ParseQuery() = %q, want %q", q.Phrases, want)
+	}
+	if q.String() != `apollo "launch plan" budget` {
+		t.Errorf("String() = %q", q.String())
+	}
+
+	for _, s := range []string{`"apollo`, ``, `" "`, `!?`} {
+		if _, err := ParseQuery(s); err == nil {
+			t.Errorf("ParseQuery(%q) succeeded", s)
+		}
+	}
+}
+
+func TestIndex_Search(t *testing.T) {
+	ix := NewIndex()
+	ix.Add("a", "Apollo launch plan")
+	ix.Add("b", "Plan the launch of Apollo; apollo apollo")
+	ix.Add("c", "Gemini launch plan")
+	ix.Add("d", "Budget")
+
+	ids := func(query string) []string {
+		t.Helper()
+		q, err := ParseQuery(query)
+		if err != nil {
+			t.Fatalf("ParseQuery(%q) error = %v", query, err)
+		}
+		var got []string
+		for _, hit := range ix.Search(q) {
+			got = append(got, hit.ID)
+		}
+		return got
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		// b mentions apollo most often
+		{"apollo", []string{"b", "a"}},
+		// launch is everywhere but d, so gemini decides
+		{"launch gemini", []string{"c"}},
+		{`"launch plan"`, []string{"a", "c"}},
+		{`"plan launch"`, nil},
+		{"APOLLO budget", nil},
+		{"missing", nil},
+	}
+	for _, tt := range tests {
+		if got := ids(tt.query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	// Documents are replaced and removed incrementally
+	ix.Add("a", "Budget review")
+	ix.RemovePrefix("c")
+	if got := ids("launch"); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Errorf("Search() after updates = %v", got)
+	}
+	ix.Remove("d")
+	if got := ids("budget"); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("Search() after removal = %v", got)
+	}
+	if got := ix.IDs(""); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("IDs() = %v", got)
+	}
+}
@@ -0,0 +1,102 @@
+package snapshot
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/fatbrother/virtual-file-system/internal/file"
+	"github.com/fatbrother/virtual-file-system/internal/folder"
+	"github.com/fatbrother/virtual-file-system/internal/naming"
+)
+
+// Snapshot is a named, read-only view of a user's folders at one point in
+// time. It holds the same folder and file values as the live tree; whoever
+// changes a shared folder or file must replace it with a clone first.
+type Snapshot struct {
+	Name      string
+	CreatedAt time.Time
+
+	folders map[string]*folder.Folder
+}
+
+// New creates a snapshot of the given folders. Snapshot names follow the folder naming rules.
+func New(name string, folders []*folder.Folder) (*Snapshot, error) {
+	if err := validateSnapshotName(name); err != nil {
+		return nil, err
+	}
+
+	snap := &Snapshot{
+		Name:      naming.Normalize(name),
+		CreatedAt: time.Now(),
+		folders:   make(map[string]*folder.Folder, len(folders)),
+	}
+	for _, f := range folders {
+		snap.folders[f.Key()] = f
+	}
+	return snap, nil
+}
+
+// validateSnapshotName checks if the snapshot name is valid
+func validateSnapshotName(name string) error {
+	return naming.CheckFolderName(name)
+}
+
+// Key returns the case-insensitive lookup key for the snapshot
+func (s *Snapshot) Key() string {
+	return naming.Key(s.Name)
+}
+
+// Folders returns the folders in the snapshot, sorted by key
+func (s *Snapshot) Folders() []*folder.Folder {
+	folders := make([]*folder.Folder, 0, len(s.folders))
+	for _, f := range s.folders {
+		folders = append(folders, f)
+	}
+	sort.Slice(folders, func(i, j int) bool {
+		return folders[i].Key() < folders[j].Key()
+	})
+	return folders
+}
+
+// SharesFolder reports whether f itself, not a copy, is part of the snapshot
+func (s *Snapshot) SharesFolder(f *folder.Folder) bool {
+	return s.folders[f.Key()] == f
+}
+
+// SharesFile reports whether fl itself is part of the snapshot, in the folder with the given key
+func (s *Snapshot) SharesFile(folderKey string, fl *file.File) bool {
+	f, ok := s.folders[folderKey]
+	if !ok {
+		return false
+	}
+	value, ok := f.Files.Search(fl.Key())
+	return ok && value == fl
+}
+
+// Counts returns the number of folders and files in the snapshot
+func (s *Snapshot) Counts() (int, int) {
+	files := 0
+	for _, f := range s.folders {
+		files += len(f.Files.PrefixSearch(""))
+	}
+	return len(s.folders), files
+}
+
+// Format prints the snapshot details
+func (s *Snapshot) Format() string {
+	folders, files := s.Counts()
+	return s.Name + " " + s.CreatedAt.Format(time.RFC3339) + " " + strconv.Itoa(folders) + " folders " + strconv.Itoa(files) + " files"
+}
+
+// Clone returns a copy of the snapshot holding the folders that mapFolder
+// returns for its folders, so that sharing between snapshots and the live
+// tree can be preserved in a copy of the whole tree
+func (s *Snapshot) Clone(mapFolder func(*folder.Folder) *folder.Folder) *Snapshot {
+	c := *s
+	c.folders = make(map[string]*folder.Folder, len(s.folders))
+	for key, f := range s.folders {
+		c.folders[key] = mapFolder(f)
+	}
+	return &c
+}
@@ -0,0 +1,51 @@
+package snapshot
+
+import (
+	"testing"
+
+	"github.com/fatbrother/virtual-file-system/internal/file"
+	"github.com/fatbrother/virtual-file-system/internal/folder"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name         string
+		snapshotName string
+		wantErr      bool
+	}{
+		{"Valid name", "before-migration", false},
+		{"Empty name", "", true},
+		{"Invalid characters", "before migration", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.snapshotName, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSnapshot_Shares(t *testing.T) {
+	docs, _ := folder.NewFolder("Docs", "", "owner")
+	notes, _ := file.NewFile("notes.txt", "", "owner")
+	docs.Files.Insert(notes.Key(), notes)
+	pics, _ := folder.NewFolder("pics", "", "owner")
+
+	snap, _ := New("nightly", []*folder.Folder{pics, docs})
+
+	if !snap.SharesFolder(docs) || snap.SharesFolder(docs.Clone()) {
+		t.Errorf("SharesFolder() should compare identity")
+	}
+	if !snap.SharesFile(docs.Key(), notes) || snap.SharesFile(docs.Key(), notes.Clone()) || snap.SharesFile(pics.Key(), notes) {
+		t.Errorf("SharesFile() should compare identity within the folder")
+	}
+	if folders := snap.Folders(); len(folders) != 2 || folders[0] != docs {
+		t.Errorf("Folders() = %v", folders)
+	}
+	if folders, files := snap.Counts(); folders != 2 || files != 1 {
+		t.Errorf("Counts() = %d, %d", folders, files)
+	}
+}
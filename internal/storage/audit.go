@@ -0,0 +1,86 @@
+package storage
+
+import (
+    "errors"
+
+    "github.com/fatbrother/virtual-file-system/internal/audit"
+)
+
+// SetAuditLog makes the storage record its operations in log from now on
+func (s *Storage) SetAuditLog(log *audit.Log) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    s.audit = log
+}
+
+// QueryAudit returns the audit records passing the filter. Only admins may read the audit log.
+func (s *Storage) QueryAudit(actor string, filter audit.Filter) (_ []audit.Record, err error) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    defer s.record(actor, "QueryAudit", "audit", &err)
+
+    if err := s.checkAdminNoLock(actor, "read"); err != nil {
+        return nil, err
+    }
+    return s.audit.Query(filter), nil
+}
+
+// VerifyAudit checks that the audit log has not been tampered with and
+// returns how many records it checked. Only admins may verify the audit log.
+func (s *Storage) VerifyAudit(actor string) (_ int, err error) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    defer s.record(actor, "VerifyAudit", "audit", &err)
+
+    if err := s.checkAdminNoLock(actor, "verify"); err != nil {
+        return 0, err
+    }
+    return s.audit.Verify()
+}
+
+// checkAdminNoLock fails unless actor is an admin
+func (s *Storage) checkAdminNoLock(actor, action string) error {
+    actorUser, err := s.getUserNoLock(actor)
+    if err != nil {
+        return err
+    }
+    if !actorUser.IsAdmin() {
+        return &PermissionError{Actor: actor, Action: action, Target: "the audit log"}
+    }
+    return nil
+}
+
+// record adds an operation to the audit log. It is deferred by each operation
+// while the operation still holds its locks, with a pointer to the error the
+// operation returns; a nil pointer records success. Records are only posted
+// to the log, so operations of different users do not wait on each other or
+// on the log's file.
+func (s *Storage) record(actor, op, target string, err *error) {
+    result, text := audit.ResultOK, ""
+    if err != nil && *err != nil {
+        result, text = audit.ResultError, (*err).Error()
+        if errors.Is(*err, ErrPermissionDenied) || errors.Is(*err, ErrAuthenticationFailed) {
+            result = audit.ResultDenied
+        }
+    }
+    r := pendingRecord{actor: actor, op: op, target: target, result: result, errText: text}
+    if s.inTx {
+        // Held back until the transaction ends, when it is known whether it committed
+        s.watchMu.Lock()
+        s.pendingAudit = append(s.pendingAudit, r)
+        s.watchMu.Unlock()
+        return
+    }
+    s.appendAudit(r)
+}
+
+// pendingRecord is an audit record not yet added to the log
+type pendingRecord struct {
+    actor, op, target, result, errText string
+}
+
+// appendAudit posts a record to the audit log
+func (s *Storage) appendAudit(r pendingRecord) {
+    s.audit.Post(r.actor, r.op, r.target, r.result, r.errText)
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+    "github.com/fatbrother/virtual-file-system/internal/user"
+)
+
+// Authenticate checks a password or API token and returns the user it belongs to
+func (s *Storage) Authenticate(username, secret string) (_ *user.User, err error) {
+    unlock := s.rlockUser(username)
+    defer unlock()
+    defer s.record(username, "Authenticate", username, &err)
+
+    u, err := s.getUserNoLock(username)
+    if err != nil || !u.Authenticate(secret) {
+        return nil, ErrAuthenticationFailed
+    }
+    return detachedUser(u), nil
+}
+
+// SetPassword sets a user's password. Users may set their own, and admins anyone's.
+func (s *Storage) SetPassword(actor, username, password string) (err error) {
+    unlock := s.lockUser(username)
+    defer unlock()
+    defer s.record(actor, "SetPassword", username, &err)
+
+    u, err := s.getManagedUserNoLock(actor, username, "change the password of")
+    if err != nil {
+        return err
+    }
+    if err := u.SetPassword(password); err != nil {
+        return err
+    }
+    u.Version = s.nextVersion()
+    return nil
+}
+
+// CreateToken issues an API token for a user and returns its secret, which cannot be retrieved later
+func (s *Storage) CreateToken(actor, username, name string) (_ string, _ user.Token, err error) {
+    unlock := s.lockUser(username)
+    defer unlock()
+    defer s.record(actor, "CreateToken", username, &err)
+
+    u, err := s.getSelfNoLock(actor, username, "create tokens for")
+    if err != nil {
+        return "", user.Token{}, err
+    }
+    secret, token, err := u.CreateToken(name)
+    if err != nil {
+        return "", user.Token{}, err
+    }
+    u.Version = s.nextVersion()
+    return secret, token, nil
+}
+
+// ListTokens returns a user's API tokens without their secrets
+func (s *Storage) ListTokens(actor, username string) (_ []user.Token, err error) {
+    unlock := s.rlockUser(username)
+    defer unlock()
+    defer s.record(actor, "ListTokens", username, &err)
+
+    u, err := s.getSelfNoLock(actor, username, "list tokens of")
+    if err != nil {
+        return nil, err
+    }
+    return u.Tokens(), nil
+}
+
+// RevokeToken deletes one of a user's API tokens
+func (s *Storage) RevokeToken(actor, username, id string) (err error) {
+    unlock := s.lockUser(username)
+    defer unlock()
+    defer s.record(actor, "RevokeToken", username+":"+id, &err)
+
+    u, err := s.getSelfNoLock(actor, username, "revoke tokens of")
+    if err != nil {
+        return err
+    }
+    if err := u.RevokeToken(id); err != nil {
+        return err
+    }
+    u.Version = s.nextVersion()
+    return nil
+}
+
+// getSelfNoLock retrieves username, requiring the actor to be that user
+func (s *Storage) getSelfNoLock(actor, username, action string) (*user.User, error) {
+    actorUser, err := s.getUserNoLock(actor)
+    if err != nil {
+        return nil, err
+    }
+
+    u, err := s.getUserNoLock(username)
+    if err != nil {
+        return nil, err
+    }
+
+    if actorUser != u {
+        return nil, &PermissionError{Actor: actor, Action: action, Target: username}
+    }
+    return u, nil
+}
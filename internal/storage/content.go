@@ -0,0 +1,136 @@
+package storage
+
+import (
+    "github.com/fatbrother/virtual-file-system/internal/acl"
+    "github.com/fatbrother/virtual-file-system/internal/file"
+    "github.com/fatbrother/virtual-file-system/internal/folder"
+    "github.com/fatbrother/virtual-file-system/internal/user"
+)
+
+// WriteFile replaces a file's contents, keeping the previous contents as a
+// revision. The actor needs write access, and the new revision counts against
+// the quota of the user owning the folder.
+func (s *Storage) WriteFile(actor, username, folderName, fileName string, data []byte) (_ file.Revision, err error) {
+    unlock := s.lockUser(username)
+    defer unlock()
+    defer s.record(actor, "WriteFile", username+"/"+folderName+"/"+fileName, &err)
+
+    actorUser, u, f, fl, err := s.getFileForNoLock(actor, username, folderName, fileName, acl.Write, "write to")
+    if err != nil {
+        return file.Revision{}, err
+    }
+    if err := checkQuotaNoLock(u, 0, 0, int64(len(data))); err != nil {
+        return file.Revision{}, err
+    }
+    hook := &HookContext{Op: OpWriteFile, Actor: actorUser, User: u, Folder: f, File: fl, Data: data}
+    if err := s.beforeNoLock(hook); err != nil {
+        return file.Revision{}, err
+    }
+    f, fl = writableFileNoLock(u, f, fl)
+    rev := fl.Write(data, actorUser.Username, f.MaxRevisions)
+    s.touchFile(fl)
+    s.publishNoLock(EventUpdated, actorUser, u, f, fl)
+    hook.Folder, hook.File = f, fl
+    s.afterNoLock(hook)
+    return rev, nil
+}
+
+// ReadFile returns a revision of a file, or the current one if number is 0.
+// A file that has never been written has an empty current revision.
+func (s *Storage) ReadFile(actor, username, folderName, fileName string, number int) (_ file.Revision, err error) {
+    unlock := s.rlockUser(username)
+    defer unlock()
+    defer s.record(actor, "ReadFile", username+"/"+folderName+"/"+fileName, &err)
+
+    _, _, _, fl, err := s.getFileForNoLock(actor, username, folderName, fileName, acl.Read, "read")
+    if err != nil {
+        return file.Revision{}, err
+    }
+    if number == 0 {
+        current, _ := fl.Current()
+        return current, nil
+    }
+    return fl.Revision(number)
+}
+
+// FileHistory returns the retained revisions of a file, oldest first
+func (s *Storage) FileHistory(actor, username, folderName, fileName string) (_ []file.Revision, err error) {
+    unlock := s.rlockUser(username)
+    defer unlock()
+    defer s.record(actor, "FileHistory", username+"/"+folderName+"/"+fileName, &err)
+
+    _, _, _, fl, err := s.getFileForNoLock(actor, username, folderName, fileName, acl.Read, "read")
+    if err != nil {
+        return nil, err
+    }
+    return fl.Revisions(), nil
+}
+
+// RevertFile restores the contents of an earlier revision as a new revision
+func (s *Storage) RevertFile(actor, username, folderName, fileName string, number int) (_ file.Revision, err error) {
+    unlock := s.lockUser(username)
+    defer unlock()
+    defer s.record(actor, "RevertFile", username+"/"+folderName+"/"+fileName, &err)
+
+    actorUser, u, f, fl, err := s.getFileForNoLock(actor, username, folderName, fileName, acl.Write, "write to")
+    if err != nil {
+        return file.Revision{}, err
+    }
+    rev, err := fl.Revision(number)
+    if err != nil {
+        return file.Revision{}, err
+    }
+    if err := checkQuotaNoLock(u, 0, 0, rev.Size); err != nil {
+        return file.Revision{}, err
+    }
+    hook := &HookContext{Op: OpRevertFile, Actor: actorUser, User: u, Folder: f, File: fl, Data: rev.Content()}
+    if err := s.beforeNoLock(hook); err != nil {
+        return file.Revision{}, err
+    }
+    f, fl = writableFileNoLock(u, f, fl)
+    rev, err = fl.Revert(number, actorUser.Username, f.MaxRevisions)
+    if err != nil {
+        return file.Revision{}, err
+    }
+    s.touchFile(fl)
+    s.publishNoLock(EventUpdated, actorUser, u, f, fl)
+    hook.Folder, hook.File = f, fl
+    s.afterNoLock(hook)
+    return rev, nil
+}
+
+// SetRevisionLimit sets how many revisions the files in a folder keep, 0
+// meaning all, and prunes older revisions. Only the folder's owner may set it.
+func (s *Storage) SetRevisionLimit(actor, username, folderName string, limit int) error {
+    _, err := s.UpdateFolder(actor, username, folderName, FolderUpdate{MaxRevisions: &limit}, 0)
+    return err
+}
+
+// getFileForNoLock retrieves a file together with the acting user, the user
+// owning the folder and the folder, requiring the actor to hold permission p
+func (s *Storage) getFileForNoLock(actor, username, folderName, fileName string, p acl.Permission, action string) (*user.User, *user.User, *folder.Folder, *file.File, error) {
+    actorUser, err := s.getUserNoLock(actor)
+    if err != nil {
+        return nil, nil, nil, nil, err
+    }
+
+    u, err := s.getUserNoLock(username)
+    if err != nil {
+        return nil, nil, nil, nil, err
+    }
+
+    f, err := s.getFolderNoLock(u, folderName)
+    if err != nil {
+        return nil, nil, nil, nil, err
+    }
+
+    fl, err := s.getFileNoLock(f, fileName)
+    if err != nil {
+        return nil, nil, nil, nil, err
+    }
+
+    if !canAccessFile(s.principalsNoLock(actorUser), f, fl, p) {
+        return nil, nil, nil, nil, &PermissionError{Actor: actor, Action: action, Target: username + "/" + folderName + "/" + fileName}
+    }
+    return actorUser, u, f, fl, nil
+}
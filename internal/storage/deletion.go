@@ -0,0 +1,171 @@
+package storage
+
+import (
+    "errors"
+
+    "github.com/fatbrother/virtual-file-system/internal/file"
+    "github.com/fatbrother/virtual-file-system/internal/folder"
+    "github.com/fatbrother/virtual-file-system/internal/user"
+)
+
+// DeleteUserOptions controls how a user is deleted
+type DeleteUserOptions struct {
+    // DryRun reports what would happen without changing anything
+    DryRun bool
+    // TransferTo names a user who receives the deleted user's folders instead of them being destroyed
+    TransferTo string
+}
+
+// DeletionReport describes what deleting a user removes or transfers
+type DeletionReport struct {
+    Username string
+    Folders  int
+    Files    int
+    Bytes    int64
+    // TrashedItems are always destroyed, even when the folders are transferred
+    TrashedItems int
+    // TransferredTo is the user receiving the folders, or "" if they are destroyed
+    TransferredTo string
+}
+
+// DeleteUserWithOptions deletes a user and reports what was removed, or with
+// DryRun only what would be. Only admins may delete users, and the last admin
+// cannot be deleted. With TransferTo, the user's folders move to that user's
+// namespace and ownership of everything the deleted user owned, including
+// groups, passes to them.
+func (s *Storage) DeleteUserWithOptions(actor, username string, opts DeleteUserOptions) (_ DeletionReport, err error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    op := "DeleteUser"
+    if opts.DryRun {
+        op = "DeleteUserDryRun"
+    }
+    defer s.record(actor, op, username, &err)
+
+    actorUser, err := s.getUserNoLock(actor)
+    if err != nil {
+        return DeletionReport{}, err
+    }
+
+    u, err := s.getUserNoLock(username)
+    if err != nil {
+        return DeletionReport{}, err
+    }
+
+    if !actorUser.IsAdmin() {
+        return DeletionReport{}, &PermissionError{Actor: actor, Action: "delete", Target: username}
+    }
+    if u.IsAdmin() && s.adminCountNoLock() == 1 {
+        return DeletionReport{}, errors.New("The " + username + " is the last admin.")
+    }
+
+    usage := usageNoLock(u)
+    trashed := u.Trash.Items()
+    for _, item := range trashed {
+        usage.Bytes -= item.Size()
+    }
+    report := DeletionReport{
+        Username:     u.Username,
+        Folders:      usage.Folders,
+        Files:        usage.Files,
+        Bytes:        usage.Bytes,
+        TrashedItems: len(trashed),
+    }
+
+    var heir *user.User
+    if opts.TransferTo != "" {
+        if heir, err = s.getUserNoLock(opts.TransferTo); err != nil {
+            return DeletionReport{}, err
+        }
+        if heir == u {
+            return DeletionReport{}, errors.New("Cannot transfer the folders of " + username + " to themselves.")
+        }
+        if err := checkTransferNoLock(u, heir, usage); err != nil {
+            return DeletionReport{}, err
+        }
+        report.TransferredTo = heir.Username
+    }
+
+    if opts.DryRun {
+        return report, nil
+    }
+
+    if deleted := s.users.Delete(u.Key()); !deleted {
+        return DeletionReport{}, errors.New("The " + username + " not found.")
+    }
+    heirKey := ""
+    if heir != nil {
+        heirKey = heir.Key()
+        s.transferFoldersNoLock(u, heir)
+    }
+    s.reassignFilesNoLock(u.Key(), heir)
+    s.revokeAllNoLock(u.Key())
+    s.leaveGroupsNoLock(u.Key(), heirKey)
+    for _, value := range u.Folders.PrefixSearch("") {
+        if f, ok := value.(*folder.Folder); ok {
+            s.publishNoLock(EventDeleted, actorUser, u, f, nil)
+            if heir != nil {
+                s.publishNoLock(EventCreated, actorUser, heir, f, nil)
+            }
+        }
+    }
+    return report, nil
+}
+
+// checkTransferNoLock verifies that heir can take over the folders of u
+// without name clashes or going over their quota
+func checkTransferNoLock(u, heir *user.User, usage user.Usage) error {
+    for _, value := range u.Folders.PrefixSearch("") {
+        if f, ok := value.(*folder.Folder); ok {
+            if _, exists := heir.Folders.Search(f.Key()); exists {
+                return errors.New("The " + heir.Username + " already has a folder named " + f.Name + ".")
+            }
+        }
+    }
+    return checkQuotaNoLock(heir, usage.Folders, usage.Files, usage.Bytes)
+}
+
+// transferFoldersNoLock moves the folders of u into the namespace of heir
+func (s *Storage) transferFoldersNoLock(u, heir *user.User) {
+    for _, value := range u.Folders.PrefixSearch("") {
+        if f, ok := value.(*folder.Folder); ok {
+            f.ACL.Owner = heir.Key()
+            f.ACL.Revoke(heir.Key())
+            s.touchFolder(f)
+            heir.Folders.Insert(f.Key(), f)
+        }
+    }
+    heir.Version = s.nextVersion()
+}
+
+// reassignFilesNoLock hands the files a deleted user owned in other users'
+// folders, including in their snapshots, to heir, or to each folder's owner
+// if there is no heir, so that a user registered later under the same name
+// does not own them. Snapshots are changed in place on purpose.
+func (s *Storage) reassignFilesNoLock(userKey string, heir *user.User) {
+    for _, owner := range s.usersNoLock() {
+        for _, folderValue := range owner.Folders.PrefixSearch("") {
+            if f, ok := folderValue.(*folder.Folder); ok {
+                reassignFolderFiles(f, userKey, heir)
+            }
+        }
+        for _, f := range snapshotFolders(owner) {
+            reassignFolderFiles(f, userKey, heir)
+        }
+    }
+}
+
+// reassignFolderFiles hands the files userKey owns in f to heir, or to the
+// folder's owner if heir is nil
+func reassignFolderFiles(f *folder.Folder, userKey string, heir *user.User) {
+    newOwner := f.ACL.Owner
+    if heir != nil {
+        newOwner = heir.Key()
+    }
+    for _, fileValue := range f.Files.PrefixSearch("") {
+        if fl, ok := fileValue.(*file.File); ok && fl.ACL.Owner == userKey {
+            fl.ACL.Owner = newOwner
+            fl.ACL.Revoke(newOwner)
+        }
+    }
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+    "github.com/fatbrother/virtual-file-system/internal/file"
+    "github.com/fatbrother/virtual-file-system/internal/folder"
+    "github.com/fatbrother/virtual-file-system/internal/group"
+    "github.com/fatbrother/virtual-file-system/internal/snapshot"
+    "github.com/fatbrother/virtual-file-system/internal/trash"
+    "github.com/fatbrother/virtual-file-system/internal/user"
+)
+
+// The storage changes users, folders and files in place while holding their
+// locks, so what it returns to callers must not share anything with them
+// once the locks are released. The functions below make such copies.
+
+// detachedUser returns a user's account details. Their folders, trash and
+// snapshots are left out; they are read through the storage's other operations.
+func detachedUser(u *user.User) *user.User {
+    c := u.Clone()
+    c.Folders, c.Trash, c.Snapshots = nil, nil, nil
+    return c
+}
+
+// detachedFolder returns a folder with its own ACL and without its files,
+// which ListFiles returns
+func detachedFolder(f *folder.Folder) folder.Folder {
+    c := *f
+    c.ACL = f.ACL.Clone()
+    c.Files = nil
+    return c
+}
+
+// detachedFile returns a file with its own ACL and revision list
+func detachedFile(fl *file.File) file.File {
+    return *fl.Clone()
+}
+
+// detachedGroup returns a group with its own member set
+func detachedGroup(g *group.Group) group.Group {
+    return *g.Clone()
+}
+
+// detachedItem returns a trashed item with its own copy of the folder and files or file
+func detachedItem(item *trash.Item) trash.Item {
+    c := *item
+    if item.Folder != nil {
+        c.Folder = newCloner().folder(item.Folder)
+    } else {
+        c.File = item.File.Clone()
+    }
+    return c
+}
+
+// detachedSnapshot returns a snapshot with its own copies of its folders and files
+func detachedSnapshot(snap *snapshot.Snapshot) snapshot.Snapshot {
+    return *snap.Clone(newCloner().folder)
+}
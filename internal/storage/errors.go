@@ -0,0 +1,67 @@
+package storage
+
+import (
+    "errors"
+    "strconv"
+)
+
+var (
+    // ErrPermissionDenied is matched by every PermissionError
+    ErrPermissionDenied = errors.New("permission denied")
+    // ErrAuthenticationFailed is returned when a password or token does not match.
+    // It does not reveal whether the user exists.
+    ErrAuthenticationFailed = errors.New("Invalid username or credentials.")
+    // ErrQuotaExceeded is matched by every QuotaError
+    ErrQuotaExceeded = errors.New("quota exceeded")
+    // ErrConflict is matched by every ConflictError
+    ErrConflict = errors.New("version conflict")
+)
+
+// PermissionError reports an operation the actor is not allowed to perform
+type PermissionError struct {
+    Actor  string
+    Action string
+    Target string
+}
+
+func (e *PermissionError) Error() string {
+    return "Permission denied: " + e.Actor + " cannot " + e.Action + " " + e.Target + "."
+}
+
+// Unwrap allows errors.Is(err, ErrPermissionDenied)
+func (e *PermissionError) Unwrap() error {
+    return ErrPermissionDenied
+}
+
+// QuotaError reports an operation that would take a user over their quota
+type QuotaError struct {
+    Username string
+    Resource string
+    Limit    int64
+}
+
+func (e *QuotaError) Error() string {
+    return "Quota exceeded: " + e.Username + " may store at most " + strconv.FormatInt(e.Limit, 10) + " " + e.Resource + "."
+}
+
+// Unwrap allows errors.Is(err, ErrQuotaExceeded)
+func (e *QuotaError) Unwrap() error {
+    return ErrQuotaExceeded
+}
+
+// ConflictError reports a conditional operation whose target has changed
+// since the caller last read it
+type ConflictError struct {
+    Target   string
+    Expected uint64
+    Actual   uint64
+}
+
+func (e *ConflictError) Error() string {
+    return "Conflict: " + e.Target + " is at version " + strconv.FormatUint(e.Actual, 10) + ", not " + strconv.FormatUint(e.Expected, 10) + "."
+}
+
+// Unwrap allows errors.Is(err, ErrConflict)
+func (e *ConflictError) Unwrap() error {
+    return ErrConflict
+}
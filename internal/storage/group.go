@@ -0,0 +1,246 @@
+package storage
+
+import (
+    "errors"
+    "sort"
+
+    "github.com/fatbrother/virtual-file-system/internal/acl"
+    "github.com/fatbrother/virtual-file-system/internal/group"
+    "github.com/fatbrother/virtual-file-system/internal/naming"
+    "github.com/fatbrother/virtual-file-system/internal/user"
+)
+
+// CreateGroup creates a new group owned by the actor, who becomes its first member
+func (s *Storage) CreateGroup(actor, groupName string) (err error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    defer s.record(actor, "CreateGroup", "@"+groupName, &err)
+
+    actorUser, err := s.getUserNoLock(actor)
+    if err != nil {
+        return err
+    }
+
+    groupKey := naming.Key(groupName)
+    if _, exists := s.groups.Search(groupKey); exists {
+        return errors.New("The " + groupName + " has already existed.")
+    }
+
+    newGroup, err := group.NewGroup(groupName, actorUser.Key())
+    if err != nil {
+        return err
+    }
+
+    s.groups.Insert(groupKey, newGroup)
+    return nil
+}
+
+// DeleteGroup deletes a group and every grant made to it. The group's owner and admins may delete it.
+func (s *Storage) DeleteGroup(actor, groupName string) (err error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    defer s.record(actor, "DeleteGroup", "@"+groupName, &err)
+
+    g, err := s.getManagedGroupNoLock(actor, groupName, "delete")
+    if err != nil {
+        return err
+    }
+
+    if deleted := s.groups.Delete(g.Key()); !deleted {
+        return errors.New("The " + groupName + " not found.")
+    }
+    s.revokeAllNoLock(g.Principal())
+    return nil
+}
+
+// AddGroupMember adds a user to a group. The group's owner and admins may add members.
+func (s *Storage) AddGroupMember(actor, groupName, username string) (err error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    defer s.record(actor, "AddGroupMember", "@"+groupName+":"+username, &err)
+
+    g, err := s.getManagedGroupNoLock(actor, groupName, "add members to")
+    if err != nil {
+        return err
+    }
+
+    member, err := s.getUserNoLock(username)
+    if err != nil {
+        return err
+    }
+
+    if !g.AddMember(member.Key()) {
+        return errors.New("The " + username + " is already a member of " + groupName + ".")
+    }
+    return nil
+}
+
+// RemoveGroupMember removes a user from a group. The group's owner and admins
+// may remove anyone; members may remove themselves.
+func (s *Storage) RemoveGroupMember(actor, groupName, username string) (err error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    defer s.record(actor, "RemoveGroupMember", "@"+groupName+":"+username, &err)
+
+    actorUser, err := s.getUserNoLock(actor)
+    if err != nil {
+        return err
+    }
+
+    g, err := s.getGroupNoLock(groupName)
+    if err != nil {
+        return err
+    }
+
+    member, err := s.getUserNoLock(username)
+    if err != nil {
+        return err
+    }
+
+    if actorUser != member && !canManageGroup(actorUser, g) {
+        return &PermissionError{Actor: actor, Action: "remove members from", Target: groupName}
+    }
+
+    if !g.RemoveMember(member.Key()) {
+        return errors.New("The " + username + " is not a member of " + groupName + ".")
+    }
+    return nil
+}
+
+// ListGroups returns every group, sorted by name
+func (s *Storage) ListGroups() (_ []group.Group, err error) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    defer s.record("", "ListGroups", "", &err)
+
+    results := s.groups.PrefixSearch("")
+    groups := make([]group.Group, 0, len(results))
+    for _, value := range results {
+        if g, ok := value.(*group.Group); ok {
+            groups = append(groups, detachedGroup(g))
+        } else {
+            return nil, errors.New("invalid group data")
+        }
+    }
+
+    sort.Slice(groups, func(i, j int) bool {
+        return lessName(groups[i].Key(), groups[i].Name, groups[j].Key(), groups[j].Name)
+    })
+
+    return groups, nil
+}
+
+// ListGroupMembers returns the usernames of a group's members, sorted
+func (s *Storage) ListGroupMembers(groupName string) (_ []string, err error) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    defer s.record("", "ListGroupMembers", "@"+groupName, &err)
+
+    g, err := s.getGroupNoLock(groupName)
+    if err != nil {
+        return nil, err
+    }
+
+    members := make([]string, 0, len(g.Members))
+    for _, key := range g.MemberKeys() {
+        if u, err := s.getUserNoLock(key); err == nil {
+            members = append(members, u.Username)
+        }
+    }
+    return members, nil
+}
+
+// ShareFolderWithGroup grants every member of a group read or write access to
+// a folder. Only the folder's owner may share it.
+func (s *Storage) ShareFolderWithGroup(actor, username, folderName, groupName string, permission acl.Permission) (err error) {
+    unlock := s.lockUser(username)
+    defer unlock()
+    defer s.record(actor, "ShareFolderWithGroup", username+"/"+folderName, &err)
+
+    actorUser, err := s.getUserNoLock(actor)
+    if err != nil {
+        return err
+    }
+
+    user, err := s.getUserNoLock(username)
+    if err != nil {
+        return err
+    }
+
+    folder, err := s.getFolderNoLock(user, folderName)
+    if err != nil {
+        return err
+    }
+
+    if folder.ACL.Owner != actorUser.Key() {
+        return &PermissionError{Actor: actor, Action: "share", Target: username + "/" + folderName}
+    }
+
+    g, err := s.getGroupNoLock(groupName)
+    if err != nil {
+        return err
+    }
+    hook := &HookContext{Op: OpShareFolder, Actor: actorUser, User: user, Folder: folder, Grantee: "@" + g.Name, Permission: permission}
+    if err := s.beforeNoLock(hook); err != nil {
+        return err
+    }
+
+    folder = writableFolderNoLock(user, folder)
+    folder.ACL.Grant(g.Principal(), permission)
+    s.touchFolder(folder)
+    s.publishNoLock(EventUpdated, actorUser, user, folder, nil)
+    hook.Folder = folder
+    s.afterNoLock(hook)
+    return nil
+}
+
+// leaveGroupsNoLock removes a deleted user from every group. Groups they
+// owned pass to heirKey, or are left without an owner, to be managed by
+// admins, if heirKey is "".
+func (s *Storage) leaveGroupsNoLock(userKey, heirKey string) {
+    for _, value := range s.groups.PrefixSearch("") {
+        g, ok := value.(*group.Group)
+        if !ok {
+            continue
+        }
+        g.RemoveMember(userKey)
+        if g.Owner == userKey {
+            g.Owner = heirKey
+        }
+    }
+}
+
+// getManagedGroupNoLock retrieves a group, requiring the actor to be its owner or an admin
+func (s *Storage) getManagedGroupNoLock(actor, groupName, action string) (*group.Group, error) {
+    actorUser, err := s.getUserNoLock(actor)
+    if err != nil {
+        return nil, err
+    }
+
+    g, err := s.getGroupNoLock(groupName)
+    if err != nil {
+        return nil, err
+    }
+
+    if !canManageGroup(actorUser, g) {
+        return nil, &PermissionError{Actor: actor, Action: action, Target: groupName}
+    }
+    return g, nil
+}
+
+// getGroupNoLock retrieves a group
+func (s *Storage) getGroupNoLock(groupName string) (*group.Group, error) {
+    groupKey := naming.Key(groupName)
+    if value, exists := s.groups.Search(groupKey); exists {
+        if g, ok := value.(*group.Group); ok {
+            return g, nil
+        }
+        return nil, errors.New("invalid group data")
+    }
+    return nil, errors.New("The " + groupName + " not found.")
+}
+
+// canManageGroup reports whether a user may change a group's membership or delete it
+func canManageGroup(u *user.User, g *group.Group) bool {
+    return u.IsAdmin() || g.Owner == u.Key()
+}
@@ -0,0 +1,156 @@
+package storage
+
+import (
+    "sync"
+
+    "github.com/fatbrother/virtual-file-system/internal/acl"
+    "github.com/fatbrother/virtual-file-system/internal/file"
+    "github.com/fatbrother/virtual-file-system/internal/folder"
+    "github.com/fatbrother/virtual-file-system/internal/user"
+)
+
+// Op identifies an operation that hooks can be registered for
+type Op string
+
+// Operations with hooks
+const (
+    OpCreateFolder Op = "CreateFolder"
+    OpDeleteFolder Op = "DeleteFolder"
+    OpShareFolder  Op = "ShareFolder"
+    OpUpdateFolder Op = "UpdateFolder"
+    OpCreateFile   Op = "CreateFile"
+    OpDeleteFile   Op = "DeleteFile"
+    OpShareFile    Op = "ShareFile"
+    OpUpdateFile   Op = "UpdateFile"
+    OpWriteFile    Op = "WriteFile"
+    OpRevertFile   Op = "RevertFile"
+)
+
+// HookContext describes an operation to its hooks. Before hooks see the
+// folder and file as they are before the operation; a folder or file being
+// created is passed as it will be inserted. After hooks see them as the
+// operation left them. Hooks are given copies sharing nothing with the
+// storage, so they may keep them.
+type HookContext struct {
+    Op    Op
+    Actor *user.User
+    // User owns the namespace the operation works in
+    User   *user.User
+    Folder *folder.Folder
+    // File is nil for operations on a folder
+    File *file.File
+    // Grantee and Permission describe a share; Grantee is @<group> for a group
+    Grantee    string
+    Permission acl.Permission
+    // FolderUpdate and FileUpdate are the changes an update makes
+    FolderUpdate *FolderUpdate
+    FileUpdate   *FileUpdate
+    // Data is the new contents of a write
+    Data []byte
+}
+
+// detached returns a copy of ctx for hooks. Users, folders and files are
+// copied as the storage returns them to callers.
+func (ctx *HookContext) detached() *HookContext {
+    c := *ctx
+    if ctx.Actor != nil {
+        c.Actor = detachedUser(ctx.Actor)
+    }
+    if ctx.User != nil {
+        c.User = detachedUser(ctx.User)
+    }
+    if ctx.Folder != nil {
+        f := detachedFolder(ctx.Folder)
+        c.Folder = &f
+    }
+    if ctx.File != nil {
+        fl := detachedFile(ctx.File)
+        c.File = &fl
+    }
+    if ctx.Data != nil {
+        c.Data = append([]byte(nil), ctx.Data...)
+    }
+    return &c
+}
+
+// BeforeHook runs before an operation and vetoes it by returning an error,
+// which the operation then returns
+type BeforeHook func(ctx *HookContext) error
+
+// AfterHook runs once an operation has succeeded
+type AfterHook func(ctx *HookContext)
+
+// hooks holds the registered hooks. It is shared with transaction copies of the storage.
+type hooks struct {
+    mu     sync.RWMutex
+    before map[Op][]BeforeHook
+    after  map[Op][]AfterHook
+}
+
+// Before registers a hook to run before every op. Hooks run in the order
+// they were registered, while the storage is locked, so they must not call
+// back into the storage.
+func (s *Storage) Before(op Op, hook BeforeHook) {
+    s.hooks.mu.Lock()
+    defer s.hooks.mu.Unlock()
+
+    if s.hooks.before == nil {
+        s.hooks.before = make(map[Op][]BeforeHook)
+    }
+    s.hooks.before[op] = append(s.hooks.before[op], hook)
+}
+
+// After registers a hook to run after every successful op. Inside a
+// transaction, after hooks run once it commits. Like before hooks they run
+// while the storage is locked.
+func (s *Storage) After(op Op, hook AfterHook) {
+    s.hooks.mu.Lock()
+    defer s.hooks.mu.Unlock()
+
+    if s.hooks.after == nil {
+        s.hooks.after = make(map[Op][]AfterHook)
+    }
+    s.hooks.after[op] = append(s.hooks.after[op], hook)
+}
+
+// beforeNoLock runs the before hooks of ctx.Op, stopping at the first veto
+func (s *Storage) beforeNoLock(ctx *HookContext) error {
+    s.hooks.mu.RLock()
+    before := s.hooks.before[ctx.Op]
+    s.hooks.mu.RUnlock()
+    if len(before) == 0 {
+        return nil
+    }
+
+    ctx = ctx.detached()
+    for _, hook := range before {
+        if err := hook(ctx); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// afterNoLock runs the after hooks of ctx.Op, or inside a transaction keeps
+// them for the commit with a copy of ctx as the operation left it
+func (s *Storage) afterNoLock(ctx *HookContext) {
+    s.watchMu.Lock()
+    if s.inTx {
+        s.pendingHooks = append(s.pendingHooks, ctx.detached())
+        s.watchMu.Unlock()
+        return
+    }
+    s.watchMu.Unlock()
+
+    s.hooks.mu.RLock()
+    after := s.hooks.after[ctx.Op]
+    s.hooks.mu.RUnlock()
+    if len(after) == 0 {
+        return
+    }
+
+    ctx = ctx.detached()
+    for _, hook := range after {
+        hook(ctx)
+    }
+}
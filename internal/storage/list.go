@@ -0,0 +1,260 @@
+package storage
+
+import (
+    "errors"
+    "regexp"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/fatbrother/virtual-file-system/internal/file"
+    "github.com/fatbrother/virtual-file-system/internal/folder"
+)
+
+// ListFilter narrows a listing of folders or files. Zero fields let everything through.
+type ListFilter struct {
+    // Since and Until bound the creation time; Since is inclusive and Until exclusive
+    Since time.Time
+    Until time.Time
+    // Prefix keeps names starting with it, compared case-insensitively
+    Prefix string
+    // Match keeps names the regular expression matches
+    Match *regexp.Regexp
+    // Description keeps entries whose description contains it, compared case-insensitively
+    Description string
+    // Limit is how many entries to return at most, counted after sorting
+    Limit int
+}
+
+// check rejects filters that cannot be applied
+func (lf ListFilter) check() error {
+    if lf.Limit < 0 {
+        return errors.New("The limit must not be negative.")
+    }
+    return nil
+}
+
+// matches reports whether an entry passes every condition but the prefix,
+// which listings apply while searching the trie
+func (lf ListFilter) matches(name, description string, createdAt time.Time) bool {
+    if !lf.Since.IsZero() && createdAt.Before(lf.Since) {
+        return false
+    }
+    if !lf.Until.IsZero() && !createdAt.Before(lf.Until) {
+        return false
+    }
+    if lf.Match != nil && !lf.Match.MatchString(name) {
+        return false
+    }
+    return lf.Description == "" || strings.Contains(strings.ToLower(description), strings.ToLower(lf.Description))
+}
+
+// limit returns how many of n sorted entries to keep
+func (lf ListFilter) limit(n int) int {
+    if lf.Limit > 0 && lf.Limit < n {
+        return lf.Limit
+    }
+    return n
+}
+
+// SortField is what a listing can be sorted by
+type SortField string
+
+// Sort fields
+const (
+    SortName        SortField = "name"
+    SortCreated     SortField = "created"
+    SortModified    SortField = "modified"
+    SortDescription SortField = "description"
+    // SortSize orders by bytes stored: a file's size, or a folder's together with its files
+    SortSize SortField = "size"
+    // SortFiles orders folders by how many files they hold
+    SortFiles SortField = "files"
+)
+
+// SortKey is one field of a sort spec and its direction
+type SortKey struct {
+    Field SortField
+    Desc  bool
+}
+
+// SortSpec orders a listing by its first key, then by the next one for
+// entries that compare equal, and so on. Entries equal on every key are
+// ordered by name, so listings are always in the same order. An empty spec
+// sorts by name.
+type SortSpec []SortKey
+
+// ParseSortSpec reads a comma-separated list of field[:asc|desc], such as
+// created:desc,name. Fields sort ascending unless given desc.
+func ParseSortSpec(s string) (SortSpec, error) {
+    var spec SortSpec
+    for _, part := range strings.Split(s, ",") {
+        field, order, _ := strings.Cut(strings.TrimSpace(part), ":")
+        key := SortKey{Field: SortField(strings.ToLower(field))}
+        switch strings.ToLower(order) {
+        case "", "asc":
+        case "desc":
+            key.Desc = true
+        default:
+            return nil, errors.New("The sort order " + order + " is not asc or desc.")
+        }
+        spec = append(spec, key)
+    }
+    if err := spec.check(false); err != nil {
+        return nil, err
+    }
+    return spec, nil
+}
+
+// String prints the spec in the form ParseSortSpec reads
+func (spec SortSpec) String() string {
+    parts := make([]string, len(spec))
+    for i, key := range spec {
+        parts[i] = string(key.Field) + ":asc"
+        if key.Desc {
+            parts[i] = string(key.Field) + ":desc"
+        }
+    }
+    return strings.Join(parts, ",")
+}
+
+// check rejects unknown fields, and the number of files when sorting files
+func (spec SortSpec) check(files bool) error {
+    for _, key := range spec {
+        switch key.Field {
+        case SortName, SortCreated, SortModified, SortDescription, SortSize:
+        case SortFiles:
+            if files {
+                return errors.New("Files cannot be sorted by their number of files.")
+            }
+        default:
+            return errors.New("The sort field " + string(key.Field) + " is not one of name, created, modified, description, size and files.")
+        }
+    }
+    return nil
+}
+
+// sortEntry holds what sorting compares of a folder or file
+type sortEntry struct {
+    key         string
+    name        string
+    description string
+    createdAt   time.Time
+    modifiedAt  time.Time
+    size        int64
+    files       int
+}
+
+// sortStable orders a listing by the spec. entries describes each entry of
+// the listing and is sorted along with it; swap exchanges two entries of the
+// listing. Entries that compare equal keep their order.
+func (spec SortSpec) sortStable(entries []sortEntry, swap func(i, j int)) {
+    sort.Stable(&entrySorter{spec: spec, entries: entries, swap: swap})
+}
+
+// entrySorter sorts a listing together with its entries
+type entrySorter struct {
+    spec    SortSpec
+    entries []sortEntry
+    swap    func(i, j int)
+}
+
+func (es *entrySorter) Len() int {
+    return len(es.entries)
+}
+
+func (es *entrySorter) Less(i, j int) bool {
+    return es.spec.less(es.entries[i], es.entries[j])
+}
+
+func (es *entrySorter) Swap(i, j int) {
+    es.entries[i], es.entries[j] = es.entries[j], es.entries[i]
+    es.swap(i, j)
+}
+
+// less reports whether a sorts before b
+func (spec SortSpec) less(a, b sortEntry) bool {
+    for _, key := range spec {
+        c := compareEntries(key.Field, a, b)
+        if key.Desc {
+            c = -c
+        }
+        if c != 0 {
+            return c < 0
+        }
+    }
+    return lessName(a.key, a.name, b.key, b.name)
+}
+
+// compareEntries returns -1, 0 or 1 as a is before, level with or after b in one field
+func compareEntries(field SortField, a, b sortEntry) int {
+    switch field {
+    case SortName:
+        return strings.Compare(a.key, b.key)
+    case SortCreated:
+        return compareTimes(a.createdAt, b.createdAt)
+    case SortModified:
+        return compareTimes(a.modifiedAt, b.modifiedAt)
+    case SortDescription:
+        if c := strings.Compare(strings.ToLower(a.description), strings.ToLower(b.description)); c != 0 {
+            return c
+        }
+        return strings.Compare(a.description, b.description)
+    case SortSize:
+        return compareInts(a.size, b.size)
+    case SortFiles:
+        return compareInts(int64(a.files), int64(b.files))
+    }
+    return 0
+}
+
+func compareTimes(a, b time.Time) int {
+    switch {
+    case a.Before(b):
+        return -1
+    case b.Before(a):
+        return 1
+    }
+    return 0
+}
+
+func compareInts(a, b int64) int {
+    switch {
+    case a < b:
+        return -1
+    case a > b:
+        return 1
+    }
+    return 0
+}
+
+// folderSortEntry describes a folder for sorting
+func folderSortEntry(f *folder.Folder) sortEntry {
+    entry := sortEntry{
+        key:         f.Key(),
+        name:        f.Name,
+        description: f.Description,
+        createdAt:   f.CreatedAt,
+        modifiedAt:  f.ModifiedAt,
+        size:        f.Size(),
+    }
+    for _, value := range f.Files.PrefixSearch("") {
+        if fl, ok := value.(*file.File); ok {
+            entry.size += fl.Size()
+            entry.files++
+        }
+    }
+    return entry
+}
+
+// fileSortEntry describes a file for sorting
+func fileSortEntry(fl *file.File) sortEntry {
+    return sortEntry{
+        key:         fl.Key(),
+        name:        fl.Name,
+        description: fl.Description,
+        createdAt:   fl.CreatedAt,
+        modifiedAt:  fl.ModifiedAt,
+        size:        fl.Size(),
+    }
+}
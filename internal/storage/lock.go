@@ -0,0 +1,43 @@
+package storage
+
+import (
+    "hash/fnv"
+    "sync"
+
+    "github.com/fatbrother/virtual-file-system/internal/naming"
+)
+
+// userLockStripes is the number of per-user locks. Users are spread over
+// them by name, so two users may share a lock but a user always gets the same one.
+const userLockStripes = 64
+
+// lockUser locks the namespace of username for writing and returns the
+// function that releases it
+func (s *Storage) lockUser(username string) func() {
+    s.mu.RLock()
+    l := s.userLock(username)
+    l.Lock()
+    return func() {
+        l.Unlock()
+        s.mu.RUnlock()
+    }
+}
+
+// rlockUser locks the namespace of username for reading and returns the
+// function that releases it
+func (s *Storage) rlockUser(username string) func() {
+    s.mu.RLock()
+    l := s.userLock(username)
+    l.RLock()
+    return func() {
+        l.RUnlock()
+        s.mu.RUnlock()
+    }
+}
+
+// userLock returns the lock guarding the namespace of username
+func (s *Storage) userLock(username string) *sync.RWMutex {
+    h := fnv.New32a()
+    h.Write([]byte(naming.Key(username)))
+    return &s.userLocks[h.Sum32()%userLockStripes]
+}
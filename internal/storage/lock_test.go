@@ -0,0 +1,225 @@
+package storage
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/fatbrother/virtual-file-system/internal/acl"
+	"github.com/fatbrother/virtual-file-system/internal/file"
+	"github.com/fatbrother/virtual-file-system/internal/folder"
+	"github.com/fatbrother/virtual-file-system/internal/search"
+	"github.com/fatbrother/virtual-file-system/internal/user"
+)
+
+// Run with -race: the stress test is only meaningful under the race detector
+func TestStorage_ConcurrentUsers(t *testing.T) {
+	const users, rounds = 8, 50
+
+	s := NewStorage()
+	_ = s.AddUser("admin")
+	_ = s.CreateGroup("admin", "everyone")
+	for i := 0; i < users; i++ {
+		name := fmt.Sprintf("user%d", i)
+		_ = s.AddUser(name)
+		_ = s.AddGroupMember("admin", "everyone", name)
+		_ = s.CreateFolder(name, name, "shared", "")
+		_ = s.ShareFolderWithGroup(name, name, "shared", "everyone", acl.Write)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < users; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("user%d", i)
+			neighbor := fmt.Sprintf("user%d", (i+1)%users)
+			for r := 0; r < rounds; r++ {
+				fileName := fmt.Sprintf("%s-%d.txt", name, r)
+				if err := s.CreateFile(name, name, "shared", fileName, "own"); err != nil {
+					t.Errorf("Storage.CreateFile() error = %v", err)
+					return
+				}
+				if _, err := s.WriteFile(name, name, "shared", fileName, []byte(fileName)); err != nil {
+					t.Errorf("Storage.WriteFile() error = %v", err)
+				}
+				// Work in a neighbor's folder while its owner does too
+				if err := s.CreateFile(name, neighbor, "shared", fileName, "guest"); err != nil {
+					t.Errorf("Storage.CreateFile() in %s error = %v", neighbor, err)
+				}
+				if _, err := s.ListFiles(name, neighbor, "shared", nil, ListFilter{}); err != nil {
+					t.Errorf("Storage.ListFiles() error = %v", err)
+				}
+				if r%10 == 0 {
+					if _, err := s.CreateSnapshot(name, name, fmt.Sprintf("s%d", r)); err != nil {
+						t.Errorf("Storage.CreateSnapshot() error = %v", err)
+					}
+					if _, _, err := s.CreateToken(name, name, fmt.Sprintf("t%d", r)); err != nil {
+						t.Errorf("Storage.CreateToken() error = %v", err)
+					}
+				}
+				// Read the account details of a neighbor changing its own
+				if _, err := s.GetUser(neighbor); err != nil {
+					t.Errorf("Storage.GetUser() error = %v", err)
+				}
+				if r%2 == 1 {
+					if err := s.DeleteFile(name, name, "shared", fileName); err != nil {
+						t.Errorf("Storage.DeleteFile() error = %v", err)
+					}
+				}
+				_, _, _ = s.GetQuota(name, name)
+			}
+		}(i)
+	}
+
+	// Operations spanning every user run alongside
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for r := 0; r < rounds; r++ {
+			s.PurgeTrash()
+			_, _ = s.ListGroups()
+			_ = s.SetQuota("admin", "user0", user.Quota{MaxFiles: 10 * users * rounds})
+			_ = s.Tx(func(tx *Tx) error {
+				return tx.CreateFolder("admin", "admin", fmt.Sprintf("f%d", r), "")
+			})
+		}
+	}()
+	wg.Wait()
+
+	for i := 0; i < users; i++ {
+		name := fmt.Sprintf("user%d", i)
+		files, err := s.ListFiles(name, name, "shared", nil, ListFilter{})
+		if err != nil || len(files) != rounds+rounds/2 {
+			t.Errorf("%s has %d files, want %d (error %v)", name, len(files), rounds+rounds/2, err)
+		}
+	}
+	if folders, _ := s.ListFolders("admin", "admin", nil, ListFilter{}); len(folders) != rounds {
+		t.Errorf("admin has %d folders, want %d", len(folders), rounds)
+	}
+}
+
+// Run with -race: values returned by the storage must not share anything it
+// goes on changing once the locks are released
+func TestStorage_ReturnedValuesAreDetached(t *testing.T) {
+	const rounds = 100
+
+	s := NewStorage()
+	_ = s.AddUser("alice")
+	_ = s.AddUser("bob")
+	_ = s.CreateGroup("alice", "team")
+	_ = s.CreateFolder("alice", "alice", "docs", "shared notes")
+	_ = s.CreateFile("alice", "alice", "docs", "seed.txt", "notes")
+	_, _ = s.CreateSnapshot("alice", "alice", "start")
+	_ = s.CreateFile("alice", "alice", "docs", "trashed.txt", "")
+	_ = s.DeleteFile("alice", "alice", "docs", "trashed.txt")
+	var hooked *HookContext
+	s.After(OpUpdateFolder, func(ctx *HookContext) {
+		hooked = ctx
+	})
+
+	folders, _ := s.ListFolders("alice", "alice", nil, ListFilter{})
+	files, _ := s.ListFiles("alice", "alice", "docs", nil, ListFilter{})
+	docs, _ := s.GetFolder("alice", "alice", "docs")
+	description := "shared notes"
+	updated, _ := s.UpdateFolder("alice", "alice", "docs", FolderUpdate{Description: &description}, 0)
+	alice, _ := s.GetUser("alice")
+	groups, _ := s.ListGroups()
+	items, _ := s.ListTrash("alice", "alice")
+	snapshots, _ := s.ListSnapshots("alice", "alice")
+	tagged, _ := s.FindByTags("alice", "alice", nil)
+	found, _ := s.Search("alice", "alice", search.Query{Phrases: [][]string{{"notes"}}})
+	if hooked == nil || updated.Name == "" || len(folders) != 1 || len(files) != 1 || len(groups) != 1 || len(items) != 1 || len(snapshots) != 1 || len(tagged) != 2 || len(found) != 2 {
+		t.Fatalf("setup returned %d folders, %d files, %d groups, %d trashed items, %d snapshots, %d tag and %d search matches",
+			len(folders), len(files), len(groups), len(items), len(snapshots), len(tagged), len(found))
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for r := 0; r < rounds; r++ {
+			name := fmt.Sprintf("f%d.txt", r)
+			_ = s.CreateFile("alice", "alice", "docs", name, "")
+			_, _ = s.WriteFile("alice", "alice", "docs", "seed.txt", []byte(name))
+			_ = s.ShareFolder("alice", "alice", "docs", "bob", acl.Read)
+			_ = s.ShareFile("alice", "alice", "docs", "seed.txt", "bob", acl.Write)
+			_, _, _ = s.CreateToken("alice", "alice", name)
+			_ = s.AddGroupMember("alice", "team", "bob")
+			_ = s.RemoveGroupMember("alice", "team", "bob")
+			_ = s.DeleteFile("alice", "alice", "docs", name)
+		}
+	}()
+
+	principals := []string{"bob"}
+	for r := 0; r < rounds; r++ {
+		for _, f := range []folder.Folder{folders[0], docs, updated, tagged[0].Folder, found[0].Folder, *hooked.Folder} {
+			if f.Files != nil || f.ACL.AllowsAny(principals, acl.Read) {
+				t.Fatalf("returned folder %s changed or kept its files", f.Name)
+			}
+		}
+		for _, fl := range []file.File{files[0], *tagged[1].File} {
+			if (fl.ACL != nil && fl.ACL.AllowsAny(principals, acl.Write)) || len(fl.Revisions()) != 0 {
+				t.Fatalf("returned file %s changed", fl.Name)
+			}
+		}
+		if alice.HasCredentials() || hooked.User.HasCredentials() || groups[0].HasMember("bob") {
+			t.Fatalf("returned user or group changed")
+		}
+		_ = items[0].Size()
+		_ = snapshots[0].Format()
+	}
+	wg.Wait()
+}
+
+func BenchmarkStorage_CreateFile(b *testing.B) {
+	s := NewStorage()
+	for i := 0; i < 64; i++ {
+		name := fmt.Sprintf("user%d", i)
+		_ = s.AddUser(name)
+		_ = s.CreateFolder(name, name, "docs", "")
+	}
+
+	var next int64
+	var mu sync.Mutex
+	b.RunParallel(func(pb *testing.PB) {
+		mu.Lock()
+		name := fmt.Sprintf("user%d", next%64)
+		next++
+		mu.Unlock()
+		for n := 0; pb.Next(); n++ {
+			_ = s.CreateFile(name, name, "docs", fmt.Sprintf("f%d-%p.txt", n, pb), "")
+		}
+	})
+}
+
+func BenchmarkStorage_ListFilesWhileWriting(b *testing.B) {
+	s := NewStorage()
+	_ = s.AddUser("reader")
+	_ = s.AddUser("writer")
+	_ = s.CreateFolder("reader", "reader", "docs", "")
+	_ = s.CreateFolder("writer", "writer", "docs", "")
+	for i := 0; i < 100; i++ {
+		_ = s.CreateFile("reader", "reader", "docs", fmt.Sprintf("f%d.txt", i), "")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for n := 0; ; n++ {
+			select {
+			case <-done:
+				return
+			default:
+				_ = s.CreateFile("writer", "writer", "docs", fmt.Sprintf("f%d.txt", n), "")
+			}
+		}
+	}()
+	defer close(done)
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, _ = s.ListFiles("reader", "reader", "docs", nil, ListFilter{})
+		}
+	})
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+    "github.com/fatbrother/virtual-file-system/internal/file"
+    "github.com/fatbrother/virtual-file-system/internal/folder"
+    "github.com/fatbrother/virtual-file-system/internal/user"
+)
+
+// SetQuota replaces a user's quota. Only admins may set quotas.
+func (s *Storage) SetQuota(actor, username string, quota user.Quota) (err error) {
+    unlock := s.lockUser(username)
+    defer unlock()
+    defer s.record(actor, "SetQuota", username, &err)
+
+    actorUser, err := s.getUserNoLock(actor)
+    if err != nil {
+        return err
+    }
+
+    u, err := s.getUserNoLock(username)
+    if err != nil {
+        return err
+    }
+
+    if !actorUser.IsAdmin() {
+        return &PermissionError{Actor: actor, Action: "set the quota of", Target: username}
+    }
+
+    u.Quota = quota
+    u.Version = s.nextVersion()
+    return nil
+}
+
+// GetQuota returns a user's quota and current usage. Users may view their own; admins may view anyone's.
+func (s *Storage) GetQuota(actor, username string) (_ user.Quota, _ user.Usage, err error) {
+    unlock := s.rlockUser(username)
+    defer unlock()
+    defer s.record(actor, "GetQuota", username, &err)
+
+    actorUser, err := s.getUserNoLock(actor)
+    if err != nil {
+        return user.Quota{}, user.Usage{}, err
+    }
+
+    u, err := s.getUserNoLock(username)
+    if err != nil {
+        return user.Quota{}, user.Usage{}, err
+    }
+
+    if actorUser != u && !actorUser.IsAdmin() {
+        return user.Quota{}, user.Usage{}, &PermissionError{Actor: actor, Action: "view the quota of", Target: username}
+    }
+
+    return u.Quota, usageNoLock(u), nil
+}
+
+// checkQuotaNoLock fails with a QuotaError if storing the given number of
+// additional folders, files and bytes would take the user over their quota
+func checkQuotaNoLock(u *user.User, folders, files int, bytes int64) error {
+    if u.Quota == (user.Quota{}) {
+        return nil
+    }
+    delta := user.Usage{Folders: folders, Files: files, Bytes: bytes}
+    if resource := u.Quota.Exceeded(usageNoLock(u).Add(delta)); resource != "" {
+        return &QuotaError{Username: u.Username, Resource: resource, Limit: u.Quota.Limit(resource)}
+    }
+    return nil
+}
+
+// usageNoLock adds up what is stored in a user's namespace. Trashed items
+// count toward bytes until they are purged, but not toward folders or files.
+func usageNoLock(u *user.User) user.Usage {
+    var usage user.Usage
+    for _, value := range u.Folders.PrefixSearch("") {
+        f, ok := value.(*folder.Folder)
+        if !ok {
+            continue
+        }
+        usage.Folders++
+        usage.Bytes += f.Size()
+        for _, fileValue := range f.Files.PrefixSearch("") {
+            if fl, ok := fileValue.(*file.File); ok {
+                usage.Files++
+                usage.Bytes += fl.Size()
+            }
+        }
+    }
+    for _, item := range u.Trash.Items() {
+        usage.Bytes += item.Size()
+    }
+    return usage
+}
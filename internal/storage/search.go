@@ -0,0 +1,143 @@
+package storage
+
+import (
+    "strings"
+    "sync"
+    "unicode/utf8"
+
+    "github.com/fatbrother/virtual-file-system/internal/acl"
+    "github.com/fatbrother/virtual-file-system/internal/file"
+    "github.com/fatbrother/virtual-file-system/internal/folder"
+    "github.com/fatbrother/virtual-file-system/internal/naming"
+    "github.com/fatbrother/virtual-file-system/internal/search"
+)
+
+// SearchResult is a folder or file found by Search. File is nil when the
+// folder itself matched.
+type SearchResult struct {
+    Folder folder.Folder
+    File   *file.File
+    Score  float64
+}
+
+// Path returns the folder or file path within its owner's namespace
+func (r SearchResult) Path() string {
+    if r.File == nil {
+        return r.Folder.Name
+    }
+    return r.Folder.Name + "/" + r.File.Name
+}
+
+// Search finds the folders and files in a user's namespace whose
+// descriptions or contents contain every word and phrase of the query,
+// among those the actor can read. Results are ranked by TF-IDF, best first.
+func (s *Storage) Search(actor, username string, query search.Query) (_ []SearchResult, err error) {
+    unlock := s.rlockUser(username)
+    defer unlock()
+    defer s.record(actor, "Search", username, &err)
+
+    actorUser, err := s.getUserNoLock(actor)
+    if err != nil {
+        return nil, err
+    }
+
+    u, err := s.getUserNoLock(username)
+    if err != nil {
+        return nil, err
+    }
+
+    principals := s.principalsNoLock(actorUser)
+    var results []SearchResult
+    for _, hit := range s.index.namespace(u.Key()).Search(query) {
+        folderKey, fileKey, _ := strings.Cut(hit.ID, idSeparator)
+        f, err := s.getFolderNoLock(u, folderKey)
+        if err != nil {
+            continue
+        }
+        if fileKey == "" {
+            if f.ACL.AllowsAny(principals, acl.Read) {
+                results = append(results, SearchResult{Folder: detachedFolder(f), Score: hit.Score})
+            }
+            continue
+        }
+        fl, err := s.getFileNoLock(f, fileKey)
+        if err == nil && canAccessFile(principals, f, fl, acl.Read) {
+            c := detachedFile(fl)
+            results = append(results, SearchResult{Folder: detachedFolder(f), File: &c, Score: hit.Score})
+        }
+    }
+    return results, nil
+}
+
+// searchIndex holds a full-text index of each namespace. It follows the
+// events the storage delivers, so changes made in a transaction are indexed
+// when it commits. It is shared with transaction copies of the storage.
+// Each index locks itself, and changes to a namespace are indexed while the
+// namespace is locked, so searches never see one half applied.
+type searchIndex struct {
+    mu    sync.Mutex
+    users map[string]*search.Index
+}
+
+// idSeparator joins folder and file keys in document IDs. Names cannot
+// contain control characters, so it cannot appear in a key.
+const idSeparator = "\x00"
+
+// namespace returns the index of the user with the given key
+func (x *searchIndex) namespace(userKey string) *search.Index {
+    x.mu.Lock()
+    defer x.mu.Unlock()
+
+    ix, ok := x.users[userKey]
+    if !ok {
+        if x.users == nil {
+            x.users = make(map[string]*search.Index)
+        }
+        ix = search.NewIndex()
+        x.users[userKey] = ix
+    }
+    return ix
+}
+
+// update indexes the folder or file an event is about. Documents are
+// identified by folder key, and files by folder key and file key joined by
+// idSeparator. A folder being created is indexed with all of its files, as
+// are the folders a snapshot restore replaced. Other folder updates only
+// change the folder itself.
+func (x *searchIndex) update(p pendingEvent) {
+    ix := x.namespace(naming.Key(p.event.Username))
+    folderID := p.folder.Key()
+    switch {
+    case p.file != nil && p.event.Kind == EventDeleted:
+        ix.Remove(folderID + idSeparator + p.file.Key())
+    case p.file != nil:
+        ix.Add(folderID+idSeparator+p.file.Key(), fileText(p.file))
+    case p.event.Kind == EventDeleted:
+        ix.Remove(folderID)
+        ix.RemovePrefix(folderID + idSeparator)
+    case p.event.Kind != EventCreated && !p.reindex:
+        ix.Add(folderID, p.folder.Description)
+    default:
+        ix.Add(folderID, p.folder.Description)
+        ix.RemovePrefix(folderID + idSeparator)
+        for _, value := range p.folder.Files.PrefixSearch("") {
+            if fl, ok := value.(*file.File); ok {
+                ix.Add(folderID+idSeparator+fl.Key(), fileText(fl))
+            }
+        }
+    }
+}
+
+// fileText returns what is indexed for a file: its description and, unless
+// they are binary, its current contents
+func fileText(fl *file.File) string {
+    rev, ok := fl.Current()
+    if !ok {
+        return fl.Description
+    }
+    content := rev.Content()
+    if !utf8.Valid(content) {
+        return fl.Description
+    }
+    return fl.Description + "\n" + string(content)
+}
@@ -0,0 +1,199 @@
+package storage
+
+import (
+    "errors"
+    "sort"
+    "time"
+
+    "github.com/fatbrother/virtual-file-system/internal/file"
+    "github.com/fatbrother/virtual-file-system/internal/folder"
+    "github.com/fatbrother/virtual-file-system/internal/naming"
+    "github.com/fatbrother/virtual-file-system/internal/snapshot"
+    "github.com/fatbrother/virtual-file-system/internal/user"
+    "github.com/fatbrother/virtual-file-system/pkg/trie"
+)
+
+// CreateSnapshot records the current state of a user's folders and files
+// under a name and returns it. Without a name, one is made from the current
+// time. Users may snapshot their own namespace; admins may snapshot anyone's.
+//
+// Snapshots share folders and files with the live tree instead of copying
+// them; a shared folder or file is copied only when it is next changed.
+func (s *Storage) CreateSnapshot(actor, username, name string) (_ string, err error) {
+    unlock := s.lockUser(username)
+    defer unlock()
+    defer s.record(actor, "CreateSnapshot", username, &err)
+
+    u, err := s.getManagedUserNoLock(actor, username, "snapshot")
+    if err != nil {
+        return "", err
+    }
+
+    if name == "" {
+        name = "snapshot-" + time.Now().Format("20060102-150405")
+    }
+    if _, exists := u.Snapshots[naming.Key(name)]; exists {
+        return "", errors.New("The snapshot " + name + " has already existed.")
+    }
+
+    folders := make([]*folder.Folder, 0)
+    for _, value := range u.Folders.PrefixSearch("") {
+        if f, ok := value.(*folder.Folder); ok {
+            folders = append(folders, f)
+        }
+    }
+
+    snap, err := snapshot.New(name, folders)
+    if err != nil {
+        return "", err
+    }
+    u.Snapshots[snap.Key()] = snap
+    return snap.Name, nil
+}
+
+// ListSnapshots returns a user's snapshots, oldest first
+func (s *Storage) ListSnapshots(actor, username string) (_ []snapshot.Snapshot, err error) {
+    unlock := s.rlockUser(username)
+    defer unlock()
+    defer s.record(actor, "ListSnapshots", username, &err)
+
+    u, err := s.getManagedUserNoLock(actor, username, "view the snapshots of")
+    if err != nil {
+        return nil, err
+    }
+
+    snapshots := make([]snapshot.Snapshot, 0, len(u.Snapshots))
+    for _, snap := range u.Snapshots {
+        snapshots = append(snapshots, detachedSnapshot(snap))
+    }
+    sort.Slice(snapshots, func(i, j int) bool {
+        if snapshots[i].CreatedAt.Equal(snapshots[j].CreatedAt) {
+            return snapshots[i].Key() < snapshots[j].Key()
+        }
+        return snapshots[i].CreatedAt.Before(snapshots[j].CreatedAt)
+    })
+    return snapshots, nil
+}
+
+// DeleteSnapshot deletes one of a user's snapshots. The live tree is not affected.
+func (s *Storage) DeleteSnapshot(actor, username, name string) (err error) {
+    unlock := s.lockUser(username)
+    defer unlock()
+    defer s.record(actor, "DeleteSnapshot", username+":"+name, &err)
+
+    u, err := s.getManagedUserNoLock(actor, username, "delete the snapshots of")
+    if err != nil {
+        return err
+    }
+
+    snap, err := getSnapshotNoLock(u, name)
+    if err != nil {
+        return err
+    }
+    delete(u.Snapshots, snap.Key())
+    return nil
+}
+
+// RestoreSnapshot replaces a user's folders and files with the ones recorded
+// in a snapshot. The restore happens in one step: the new tree is built
+// completely before it replaces the current one. Changes made since the
+// snapshot are lost; the trash and other snapshots are kept.
+func (s *Storage) RestoreSnapshot(actor, username, name string) (err error) {
+    unlock := s.lockUser(username)
+    defer unlock()
+    defer s.record(actor, "RestoreSnapshot", username+":"+name, &err)
+
+    u, err := s.getManagedUserNoLock(actor, username, "restore the snapshots of")
+    if err != nil {
+        return err
+    }
+    actorUser, err := s.getUserNoLock(actor)
+    if err != nil {
+        return err
+    }
+
+    snap, err := getSnapshotNoLock(u, name)
+    if err != nil {
+        return err
+    }
+
+    folders := trie.NewTrie()
+    for _, f := range snap.Folders() {
+        folders.Insert(f.Key(), f)
+    }
+    previous := u.Folders
+    u.Folders = folders
+    u.Version = s.nextVersion()
+    s.publishRestoreNoLock(actorUser, u, previous)
+    return nil
+}
+
+// publishRestoreNoLock reports how restoring a snapshot changed the folders
+// of u: folders that are gone, new and, if their contents differ, replaced
+func (s *Storage) publishRestoreNoLock(actor, u *user.User, previous *trie.Trie) {
+    for key, value := range previous.PrefixSearch("") {
+        if f, ok := value.(*folder.Folder); ok {
+            if _, exists := u.Folders.Search(key); !exists {
+                s.publishNoLock(EventDeleted, actor, u, f, nil)
+            }
+        }
+    }
+    for key, value := range u.Folders.PrefixSearch("") {
+        if f, ok := value.(*folder.Folder); ok {
+            old, exists := previous.Search(key)
+            if !exists {
+                s.publishNoLock(EventCreated, actor, u, f, nil)
+            } else if old != value {
+                p := newPendingEvent(EventUpdated, actor, u, f, nil)
+                p.reindex = true
+                s.deliverNoLock(p)
+            }
+        }
+    }
+}
+
+// getSnapshotNoLock retrieves one of a user's snapshots
+func getSnapshotNoLock(u *user.User, name string) (*snapshot.Snapshot, error) {
+    snap, ok := u.Snapshots[naming.Key(name)]
+    if !ok {
+        return nil, errors.New("The snapshot " + name + " not found.")
+    }
+    return snap, nil
+}
+
+// snapshotFolders returns the folders held by a user's snapshots
+func snapshotFolders(u *user.User) []*folder.Folder {
+    var folders []*folder.Folder
+    for _, snap := range u.Snapshots {
+        folders = append(folders, snap.Folders()...)
+    }
+    return folders
+}
+
+// writableFolderNoLock returns a live folder of u that may be changed in
+// place. If a snapshot shares the folder, it is first replaced by a copy.
+func writableFolderNoLock(u *user.User, f *folder.Folder) *folder.Folder {
+    for _, snap := range u.Snapshots {
+        if snap.SharesFolder(f) {
+            c := f.Clone()
+            u.Folders.Insert(c.Key(), c)
+            return c
+        }
+    }
+    return f
+}
+
+// writableFileNoLock returns a live file in folder f of u that may be changed
+// in place, replacing the file, and the folder holding it, by copies if a
+// snapshot shares the file. It also returns the folder now holding the file.
+func writableFileNoLock(u *user.User, f *folder.Folder, fl *file.File) (*folder.Folder, *file.File) {
+    for _, snap := range u.Snapshots {
+        if snap.SharesFile(f.Key(), fl) {
+            f = writableFolderNoLock(u, f)
+            c := fl.Clone()
+            f.Files.Insert(c.Key(), c)
+            return f, c
+        }
+    }
+    return f, fl
+}
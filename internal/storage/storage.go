@@ -2,157 +2,319 @@ package storage
 
 import (
     "errors"
-    "sort"
-    "strings"
     "sync"
+    "sync/atomic"
+    "time"
 
-    "github.com/fatbrother/virtual-file-system/internal/user"
-    "github.com/fatbrother/virtual-file-system/internal/folder"
+    "github.com/fatbrother/virtual-file-system/internal/acl"
+    "github.com/fatbrother/virtual-file-system/internal/audit"
     "github.com/fatbrother/virtual-file-system/internal/file"
+    "github.com/fatbrother/virtual-file-system/internal/folder"
+    "github.com/fatbrother/virtual-file-system/internal/group"
+    "github.com/fatbrother/virtual-file-system/internal/naming"
+    "github.com/fatbrother/virtual-file-system/internal/user"
     "github.com/fatbrother/virtual-file-system/pkg/trie"
 )
 
-// Storage represents the in-memory storage for the virtual file system
+// Storage represents the in-memory storage for the virtual file system.
+//
+// Locking has two levels. mu guards the set of users and groups, roles and
+// the trash retention: operations that change those, or that span several
+// users, hold it exclusively. Everything else holds mu shared plus the lock
+// of the one user whose namespace it reads or changes, so users working in
+// their own folders do not block each other.
 type Storage struct {
-    users *trie.Trie
-    mu    sync.RWMutex
+    // version is the last version handed out to a user, folder or file.
+    // It is first so it stays 64-bit aligned for atomic access.
+    version uint64
+    users   *trie.Trie
+    groups  *trie.Trie
+    // trashRetention is how long deleted items are kept; 0 keeps them until the trash is emptied
+    trashRetention time.Duration
+    mu             sync.RWMutex
+    userLocks      [userLockStripes]sync.RWMutex
+
+    // watchMu guards the watchers and, inside a transaction, the events,
+    // after hooks and audit records held back until it ends
+    watchMu      sync.Mutex
+    watchers     map[*watcher]struct{}
+    inTx         bool
+    pending      []pendingEvent
+    pendingHooks []*HookContext
+    pendingAudit []pendingRecord
+    hooks        *hooks
+    // index is the full-text index, updated as events are delivered
+    index *searchIndex
+    // cloner, inside a transaction, copies users from the live storage as they are first used
+    cloner *cloner
+
+    // audit records every operation; it is only replaced with mu held exclusively
+    audit *audit.Log
 }
 
 // NewStorage creates a new Storage instance
 func NewStorage() *Storage {
     return &Storage{
-        users: trie.NewTrie(),
+        users:          trie.NewTrie(),
+        groups:         trie.NewTrie(),
+        trashRetention: DefaultTrashRetention,
+        audit:          audit.NewLog(),
+        hooks:          &hooks{},
+        index:          &searchIndex{},
     }
 }
 
-// AddUser adds a new user to the storage
-func (s *Storage) AddUser(username string) error {
+// AddUser adds a new user to the storage. The first user registered becomes an admin.
+func (s *Storage) AddUser(username string) (err error) {
     s.mu.Lock()
     defer s.mu.Unlock()
+    defer s.record("", "AddUser", username, &err)
 
-    lowercaseUsername := strings.ToLower(username)
-    if _, exists := s.users.Search(lowercaseUsername); exists {
-        return errors.New("The " + username + " has already existed.")
+    newUser, err := s.newUserNoLock(username)
+    if err != nil {
+        return err
     }
+    s.insertUserNoLock(newUser)
+    return nil
+}
 
-    newUser, err := user.NewUser(username)
+// AddUserWithPassword adds a new user like AddUser, setting their password
+// in the same step so the account is never left without credentials
+func (s *Storage) AddUserWithPassword(username, password string) (err error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    defer s.record("", "AddUser", username, &err)
+
+    newUser, err := s.newUserNoLock(username)
     if err != nil {
         return err
     }
-
-    s.users.Insert(lowercaseUsername, newUser)
+    if err := newUser.SetPassword(password); err != nil {
+        return err
+    }
+    s.insertUserNoLock(newUser)
     return nil
 }
 
-// GetUser retrieves a user from the storage
+// newUserNoLock creates a user that is not registered yet
+func (s *Storage) newUserNoLock(username string) (*user.User, error) {
+    if _, exists := s.users.Search(naming.Key(username)); exists {
+        return nil, errors.New("The " + username + " has already existed.")
+    }
+    return user.NewUser(username)
+}
+
+// insertUserNoLock registers a new user, making the first one an admin
+func (s *Storage) insertUserNoLock(newUser *user.User) {
+    if len(s.users.PrefixSearch("")) == 0 {
+        newUser.Role = user.RoleAdmin
+    }
+    newUser.Version = s.nextVersion()
+    s.users.Insert(newUser.Key(), newUser)
+    if s.cloner != nil {
+        // A user added by a transaction is its own
+        s.cloner.users[newUser] = newUser
+    }
+}
+
+// GetUser retrieves a copy of a user's account details from the storage
 func (s *Storage) GetUser(username string) (*user.User, error) {
-    s.mu.RLock()
-    defer s.mu.RUnlock()
+    unlock := s.rlockUser(username)
+    defer unlock()
 
-    lowercaseUsername := strings.ToLower(username)
-    if value, exists := s.users.Search(lowercaseUsername); exists {
-        if user, ok := value.(*user.User); ok {
-            return user, nil
-        }
-        return nil, errors.New("invalid user data")
+    u, err := s.getUserNoLock(username)
+    if err != nil {
+        return nil, err
     }
-    return nil, errors.New("The " + username + " not found.")
+    return detachedUser(u), nil
 }
 
-// DeleteUser removes a user from the storage
-func (s *Storage) DeleteUser(username string) error {
+// DeleteUser removes a user together with their folders, files and trash.
+// Only admins may delete users, and the last admin cannot be deleted.
+func (s *Storage) DeleteUser(actor, username string) error {
+    _, err := s.DeleteUserWithOptions(actor, username, DeleteUserOptions{})
+    return err
+}
+
+// SetRole changes a user's role. Only admins may change roles, and the last
+// admin cannot be demoted.
+func (s *Storage) SetRole(actor, username string, role user.Role) (err error) {
     s.mu.Lock()
     defer s.mu.Unlock()
+    defer s.record(actor, "SetRole", username, &err)
 
-    lowercaseUsername := strings.ToLower(username)
-    if deleted := s.users.Delete(lowercaseUsername); !deleted {
-        return errors.New("The " + username + " not found.")
+    actorUser, err := s.getUserNoLock(actor)
+    if err != nil {
+        return err
+    }
+
+    u, err := s.getUserNoLock(username)
+    if err != nil {
+        return err
+    }
+
+    if !actorUser.IsAdmin() {
+        return &PermissionError{Actor: actor, Action: "change the role of", Target: username}
+    }
+    if u.IsAdmin() && role != user.RoleAdmin && s.adminCountNoLock() == 1 {
+        return errors.New("The " + username + " is the last admin.")
     }
+
+    u.Role = role
+    u.Version = s.nextVersion()
     return nil
 }
 
-// CreateFolder creates a new folder for a user
-func (s *Storage) CreateFolder(username, folderName, description string) error {
-    s.mu.Lock()
-    defer s.mu.Unlock()
+// CreateFolder creates a new folder for a user. Only the user may create folders in their namespace.
+func (s *Storage) CreateFolder(actor, username, folderName, description string) (err error) {
+    unlock := s.lockUser(username)
+    defer unlock()
+    defer s.record(actor, "CreateFolder", username+"/"+folderName, &err)
+
+    actorUser, err := s.getUserNoLock(actor)
+    if err != nil {
+        return err
+    }
 
     user, err := s.getUserNoLock(username)
     if err != nil {
         return err
     }
 
-    lowercaseFolderName := strings.ToLower(folderName)
-    if _, exists := user.Folders.Search(lowercaseFolderName); exists {
+    if actorUser != user {
+        return &PermissionError{Actor: actor, Action: "create folders for", Target: username}
+    }
+
+    folderKey := naming.Key(folderName)
+    if _, exists := user.Folders.Search(folderKey); exists {
         return errors.New("The " + folderName + " has already existed.")
     }
 
-    newFolder, err := folder.NewFolder(folderName, description)
+    newFolder, err := folder.NewFolder(folderName, description, user.Key())
     if err != nil {
         return err
     }
+    if err := checkQuotaNoLock(user, 1, 0, newFolder.Size()); err != nil {
+        return err
+    }
+    hook := &HookContext{Op: OpCreateFolder, Actor: actorUser, User: user, Folder: newFolder}
+    if err := s.beforeNoLock(hook); err != nil {
+        return err
+    }
 
-    user.Folders.Insert(lowercaseFolderName, newFolder)
+    newFolder.Version = s.nextVersion()
+    user.Folders.Insert(folderKey, newFolder)
+    user.Version = s.nextVersion()
+    s.publishNoLock(EventCreated, actorUser, user, newFolder, nil)
+    s.afterNoLock(hook)
     return nil
 }
 
-// DeleteFolder deletes a folder for a user
-func (s *Storage) DeleteFolder(username, folderName string) error {
-    s.mu.Lock()
-    defer s.mu.Unlock()
+// DeleteFolder moves a folder and its files to the user's trash. Only the folder's owner may delete it.
+func (s *Storage) DeleteFolder(actor, username, folderName string) (err error) {
+    unlock := s.lockUser(username)
+    defer unlock()
+    defer s.record(actor, "DeleteFolder", username+"/"+folderName, &err)
+
+    return s.deleteFolderNoLock(actor, username, folderName, 0)
+}
+
+// deleteFolderNoLock deletes a folder, failing with a ConflictError unless
+// ifVersion is 0 or the folder's current version
+func (s *Storage) deleteFolderNoLock(actor, username, folderName string, ifVersion uint64) error {
+    actorUser, err := s.getUserNoLock(actor)
+    if err != nil {
+        return err
+    }
 
     user, err := s.getUserNoLock(username)
     if err != nil {
         return err
     }
 
-    lowercaseFolderName := strings.ToLower(folderName)
-    if deleted := user.Folders.Delete(lowercaseFolderName); !deleted {
+    folder, err := s.getFolderNoLock(user, folderName)
+    if err != nil {
+        return err
+    }
+
+    if folder.ACL.Owner != actorUser.Key() {
+        return &PermissionError{Actor: actor, Action: "delete", Target: username + "/" + folderName}
+    }
+    if err := checkVersion(username+"/"+folderName, ifVersion, folder.Version); err != nil {
+        return err
+    }
+    hook := &HookContext{Op: OpDeleteFolder, Actor: actorUser, User: user, Folder: folder}
+    if err := s.beforeNoLock(hook); err != nil {
+        return err
+    }
+
+    folderKey := naming.Key(folderName)
+    if deleted := user.Folders.Delete(folderKey); !deleted {
         return errors.New("The " + folderName + " not found.")
     }
+    user.Version = s.nextVersion()
 
+    s.purgeExpiredNoLock(user)
+    user.Trash.AddFolder(folder, actorUser.Key())
+    s.publishNoLock(EventDeleted, actorUser, user, folder, nil)
+    s.afterNoLock(hook)
     return nil
 }
 
-// ListFolders returns a list of all folders for a user with sorting options
-func (s *Storage) ListFolders(username, sortField, sortOrder string) ([]folder.Folder, error) {
-    s.mu.RLock()
-    defer s.mu.RUnlock()
+// ListFolders returns a list of the folders of a user that the actor can read, with sorting and filtering options.
+// The folders are copies without their files, which ListFiles returns.
+func (s *Storage) ListFolders(actor, username string, spec SortSpec, filter ListFilter) (_ []folder.Folder, err error) {
+    unlock := s.rlockUser(username)
+    defer unlock()
+    defer s.record(actor, "ListFolders", username, &err)
+
+    if err := filter.check(); err != nil {
+        return nil, err
+    }
+    if err := spec.check(false); err != nil {
+        return nil, err
+    }
+
+    actorUser, err := s.getUserNoLock(actor)
+    if err != nil {
+        return nil, err
+    }
 
     user, err := s.getUserNoLock(username)
     if err != nil {
         return nil, err
     }
 
-    results := user.Folders.PrefixSearch("")
+    principals := s.principalsNoLock(actorUser)
+    results := user.Folders.PrefixSearch(naming.Key(filter.Prefix))
     folders := make([]folder.Folder, 0, len(results))
+    entries := make([]sortEntry, 0, len(results))
     for _, value := range results {
         if f, ok := value.(*folder.Folder); ok {
-            folders = append(folders, *f)
+            if f.ACL.AllowsAny(principals, acl.Read) && filter.matches(f.Name, f.Description, f.CreatedAt) {
+                folders = append(folders, detachedFolder(f))
+                entries = append(entries, folderSortEntry(f))
+            }
         } else {
             return nil, errors.New("invalid folder data")
         }
     }
 
-    sort.Slice(folders, func(i, j int) bool {
-        if sortField == "created" {
-            if sortOrder == "asc" {
-                return folders[i].CreatedAt.Before(folders[j].CreatedAt)
-            }
-            return folders[j].CreatedAt.Before(folders[i].CreatedAt)
-        }
-        if sortOrder == "asc" {
-            return folders[i].Name < folders[j].Name
-        }
-        return folders[i].Name > folders[j].Name
-    })
+    spec.sortStable(entries, func(i, j int) { folders[i], folders[j] = folders[j], folders[i] })
 
-    return folders, nil
+    return folders[:filter.limit(len(folders))], nil
 }
 
-// CreateFile creates a new file in a folder for a user
-func (s *Storage) CreateFile(username, folderName, fileName, description string) error {
-    s.mu.Lock()
-    defer s.mu.Unlock()
+// ShareFolder grants another user read or write access to a folder. Only the folder's owner may share it.
+func (s *Storage) ShareFolder(actor, username, folderName, grantee string, permission acl.Permission) (err error) {
+    unlock := s.lockUser(username)
+    defer unlock()
+    defer s.record(actor, "ShareFolder", username+"/"+folderName, &err)
+
+    actorUser, err := s.getUserNoLock(actor)
+    if err != nil {
+        return err
+    }
 
     user, err := s.getUserNoLock(username)
     if err != nil {
@@ -164,24 +326,101 @@ func (s *Storage) CreateFile(username, folderName, fileName, description string)
         return err
     }
 
-    lowercaseFileName := strings.ToLower(fileName)
-    if _, exists := folder.Files.Search(lowercaseFileName); exists {
+    if folder.ACL.Owner != actorUser.Key() {
+        return &PermissionError{Actor: actor, Action: "share", Target: username + "/" + folderName}
+    }
+
+    granteeUser, err := s.getUserNoLock(grantee)
+    if err != nil {
+        return err
+    }
+    if granteeUser.Key() == folder.ACL.Owner {
+        return errors.New("The " + grantee + " already owns " + folderName + ".")
+    }
+    hook := &HookContext{Op: OpShareFolder, Actor: actorUser, User: user, Folder: folder, Grantee: granteeUser.Username, Permission: permission}
+    if err := s.beforeNoLock(hook); err != nil {
+        return err
+    }
+
+    folder = writableFolderNoLock(user, folder)
+    folder.ACL.Grant(granteeUser.Key(), permission)
+    s.touchFolder(folder)
+    s.publishNoLock(EventUpdated, actorUser, user, folder, nil)
+    hook.Folder = folder
+    s.afterNoLock(hook)
+    return nil
+}
+
+// CreateFile creates a new file in a folder for a user. The actor needs write access
+// to the folder and becomes the owner of the file.
+func (s *Storage) CreateFile(actor, username, folderName, fileName, description string) (err error) {
+    unlock := s.lockUser(username)
+    defer unlock()
+    defer s.record(actor, "CreateFile", username+"/"+folderName+"/"+fileName, &err)
+
+    actorUser, err := s.getUserNoLock(actor)
+    if err != nil {
+        return err
+    }
+
+    user, err := s.getUserNoLock(username)
+    if err != nil {
+        return err
+    }
+
+    folder, err := s.getFolderNoLock(user, folderName)
+    if err != nil {
+        return err
+    }
+
+    if !folder.ACL.AllowsAny(s.principalsNoLock(actorUser), acl.Write) {
+        return &PermissionError{Actor: actor, Action: "write to", Target: username + "/" + folderName}
+    }
+
+    fileKey := naming.Key(fileName)
+    if _, exists := folder.Files.Search(fileKey); exists {
         return errors.New("The " + fileName + " has already existed.")
     }
 
-    newFile, err := file.NewFile(fileName, description)
+    newFile, err := file.NewFile(fileName, description, actorUser.Key())
     if err != nil {
         return err
     }
+    if err := checkQuotaNoLock(user, 0, 1, newFile.Size()); err != nil {
+        return err
+    }
+    hook := &HookContext{Op: OpCreateFile, Actor: actorUser, User: user, Folder: folder, File: newFile}
+    if err := s.beforeNoLock(hook); err != nil {
+        return err
+    }
 
-    folder.Files.Insert(lowercaseFileName, newFile)
+    newFile.Version = s.nextVersion()
+    folder = writableFolderNoLock(user, folder)
+    folder.Files.Insert(fileKey, newFile)
+    s.touchFolder(folder)
+    s.publishNoLock(EventCreated, actorUser, user, folder, newFile)
+    hook.Folder = folder
+    s.afterNoLock(hook)
     return nil
 }
 
-// DeleteFile deletes a file from a folder for a user
-func (s *Storage) DeleteFile(username, folderName, fileName string) error {
-    s.mu.Lock()
-    defer s.mu.Unlock()
+// DeleteFile moves a file to the trash of the user owning the folder. The actor
+// needs write access to the folder or to the file itself.
+func (s *Storage) DeleteFile(actor, username, folderName, fileName string) (err error) {
+    unlock := s.lockUser(username)
+    defer unlock()
+    defer s.record(actor, "DeleteFile", username+"/"+folderName+"/"+fileName, &err)
+
+    return s.deleteFileNoLock(actor, username, folderName, fileName, 0)
+}
+
+// deleteFileNoLock deletes a file, failing with a ConflictError unless
+// ifVersion is 0 or the file's current version
+func (s *Storage) deleteFileNoLock(actor, username, folderName, fileName string, ifVersion uint64) error {
+    actorUser, err := s.getUserNoLock(actor)
+    if err != nil {
+        return err
+    }
 
     user, err := s.getUserNoLock(username)
     if err != nil {
@@ -193,18 +432,54 @@ func (s *Storage) DeleteFile(username, folderName, fileName string) error {
         return err
     }
 
-    lowercaseFileName := strings.ToLower(fileName)
-    if deleted := folder.Files.Delete(lowercaseFileName); !deleted {
+    file, err := s.getFileNoLock(folder, fileName)
+    if err != nil {
+        return err
+    }
+
+    if !canAccessFile(s.principalsNoLock(actorUser), folder, file, acl.Write) {
+        return &PermissionError{Actor: actor, Action: "delete", Target: username + "/" + folderName + "/" + fileName}
+    }
+    if err := checkVersion(username+"/"+folderName+"/"+fileName, ifVersion, file.Version); err != nil {
+        return err
+    }
+    hook := &HookContext{Op: OpDeleteFile, Actor: actorUser, User: user, Folder: folder, File: file}
+    if err := s.beforeNoLock(hook); err != nil {
+        return err
+    }
+
+    fileKey := naming.Key(fileName)
+    folder = writableFolderNoLock(user, folder)
+    if deleted := folder.Files.Delete(fileKey); !deleted {
         return errors.New("The " + fileName + " not found.")
     }
+    s.touchFolder(folder)
 
+    s.purgeExpiredNoLock(user)
+    user.Trash.AddFile(folder.Name, file, actorUser.Key())
+    s.publishNoLock(EventDeleted, actorUser, user, folder, file)
+    hook.Folder = folder
+    s.afterNoLock(hook)
     return nil
 }
 
-// ListFiles returns a list of all files in a folder for a user with sorting options
-func (s *Storage) ListFiles(username, folderName, sortField, sortOrder string) ([]file.File, error) {
-    s.mu.RLock()
-    defer s.mu.RUnlock()
+// ListFiles returns a list of the files in a folder that the actor can read, with sorting and filtering options
+func (s *Storage) ListFiles(actor, username, folderName string, spec SortSpec, filter ListFilter) (_ []file.File, err error) {
+    unlock := s.rlockUser(username)
+    defer unlock()
+    defer s.record(actor, "ListFiles", username+"/"+folderName, &err)
+
+    if err := filter.check(); err != nil {
+        return nil, err
+    }
+    if err := spec.check(true); err != nil {
+        return nil, err
+    }
+
+    actorUser, err := s.getUserNoLock(actor)
+    if err != nil {
+        return nil, err
+    }
 
     user, err := s.getUserNoLock(username)
     if err != nil {
@@ -216,50 +491,234 @@ func (s *Storage) ListFiles(username, folderName, sortField, sortOrder string) (
         return nil, err
     }
 
-    results := folder.Files.PrefixSearch("")
+    principals := s.principalsNoLock(actorUser)
+    results := folder.Files.PrefixSearch(naming.Key(filter.Prefix))
     files := make([]file.File, 0, len(results))
+    entries := make([]sortEntry, 0, len(results))
     for _, value := range results {
         if f, ok := value.(*file.File); ok {
-            files = append(files, *f)
+            if canAccessFile(principals, folder, f, acl.Read) && filter.matches(f.Name, f.Description, f.CreatedAt) {
+                files = append(files, detachedFile(f))
+                entries = append(entries, fileSortEntry(f))
+            }
         }
     }
 
-    sort.Slice(files, func(i, j int) bool {
-        if sortField == "created" {
-            if sortOrder == "asc" {
-                return files[i].CreatedAt.Before(files[j].CreatedAt)
+    // Filtering out every file is not a reason to deny access
+    if len(files) == 0 && !folder.ACL.AllowsAny(principals, acl.Read) && !canAccessAnyFile(principals, folder) {
+        return nil, &PermissionError{Actor: actor, Action: "read", Target: username + "/" + folderName}
+    }
+
+    spec.sortStable(entries, func(i, j int) { files[i], files[j] = files[j], files[i] })
+
+    return files[:filter.limit(len(files))], nil
+}
+
+// ShareFile grants another user read or write access to a single file.
+// The file's owner and the folder's owner may share it.
+func (s *Storage) ShareFile(actor, username, folderName, fileName, grantee string, permission acl.Permission) (err error) {
+    unlock := s.lockUser(username)
+    defer unlock()
+    defer s.record(actor, "ShareFile", username+"/"+folderName+"/"+fileName, &err)
+
+    actorUser, err := s.getUserNoLock(actor)
+    if err != nil {
+        return err
+    }
+
+    user, err := s.getUserNoLock(username)
+    if err != nil {
+        return err
+    }
+
+    folder, err := s.getFolderNoLock(user, folderName)
+    if err != nil {
+        return err
+    }
+
+    file, err := s.getFileNoLock(folder, fileName)
+    if err != nil {
+        return err
+    }
+
+    if file.ACL.Owner != actorUser.Key() && folder.ACL.Owner != actorUser.Key() {
+        return &PermissionError{Actor: actor, Action: "share", Target: username + "/" + folderName + "/" + fileName}
+    }
+
+    granteeUser, err := s.getUserNoLock(grantee)
+    if err != nil {
+        return err
+    }
+    if granteeUser.Key() == file.ACL.Owner {
+        return errors.New("The " + grantee + " already owns " + fileName + ".")
+    }
+    hook := &HookContext{Op: OpShareFile, Actor: actorUser, User: user, Folder: folder, File: file, Grantee: granteeUser.Username, Permission: permission}
+    if err := s.beforeNoLock(hook); err != nil {
+        return err
+    }
+
+    folder, file = writableFileNoLock(user, folder, file)
+    file.ACL.Grant(granteeUser.Key(), permission)
+    s.touchFile(file)
+    s.publishNoLock(EventUpdated, actorUser, user, folder, file)
+    hook.Folder, hook.File = folder, file
+    s.afterNoLock(hook)
+    return nil
+}
+
+// revokeAllNoLock removes every grant held by a principal, including on
+// trashed items and in snapshots, so a user registered later under the same
+// name does not inherit them
+func (s *Storage) revokeAllNoLock(principal string) {
+    for _, u := range s.usersNoLock() {
+        for _, folderValue := range u.Folders.PrefixSearch("") {
+            if f, ok := folderValue.(*folder.Folder); ok {
+                revokeFolder(f, principal)
             }
-            return files[j].CreatedAt.Before(files[i].CreatedAt)
         }
-        if sortOrder == "asc" {
-            return files[i].Name < files[j].Name
+        for _, f := range snapshotFolders(u) {
+            revokeFolder(f, principal)
         }
-        return files[i].Name > files[j].Name
-    })
+        for _, item := range u.Trash.Items() {
+            if item.Folder != nil {
+                revokeFolder(item.Folder, principal)
+            } else {
+                item.File.ACL.Revoke(principal)
+            }
+        }
+    }
+}
+
+// revokeFolder removes a principal's grants on a folder and its files
+func revokeFolder(f *folder.Folder, principal string) {
+    f.ACL.Revoke(principal)
+    for _, fileValue := range f.Files.PrefixSearch("") {
+        if fl, ok := fileValue.(*file.File); ok {
+            fl.ACL.Revoke(principal)
+        }
+    }
+}
+
+// nextVersion returns a version higher than any handed out before
+func (s *Storage) nextVersion() uint64 {
+    return atomic.AddUint64(&s.version, 1)
+}
+
+// touchFolder gives a changed folder a new version and modification time
+func (s *Storage) touchFolder(f *folder.Folder) {
+    f.Version = s.nextVersion()
+    f.ModifiedAt = time.Now()
+}
+
+// touchFile gives a changed file a new version and modification time
+func (s *Storage) touchFile(fl *file.File) {
+    fl.Version = s.nextVersion()
+    fl.ModifiedAt = time.Now()
+}
+
+// adminCountNoLock returns the number of users with the admin role
+func (s *Storage) adminCountNoLock() int {
+    count := 0
+    for _, value := range s.users.PrefixSearch("") {
+        if u, ok := value.(*user.User); ok && u.IsAdmin() {
+            count++
+        }
+    }
+    return count
+}
 
-    return files, nil
+// principalsNoLock returns the ACL principals a user acts as: the user
+// and every group they belong to
+func (s *Storage) principalsNoLock(u *user.User) []string {
+    principals := []string{u.Key()}
+    for _, value := range s.groups.PrefixSearch("") {
+        if g, ok := value.(*group.Group); ok && g.HasMember(u.Key()) {
+            principals = append(principals, g.Principal())
+        }
+    }
+    return principals
 }
 
 // getUserNoLock retrieves a user without locking (assumes caller holds the lock)
 func (s *Storage) getUserNoLock(username string) (*user.User, error) {
-    lowercaseUsername := strings.ToLower(username)
-    if value, exists := s.users.Search(lowercaseUsername); exists {
+    if s.cloner != nil {
+        s.cloner.mu.Lock()
+        defer s.cloner.mu.Unlock()
+    }
+
+    usernameKey := naming.Key(username)
+    if value, exists := s.users.Search(usernameKey); exists {
         if user, ok := value.(*user.User); ok {
-            return user, nil
+            return s.ownUserNoLock(user), nil
         }
         return nil, errors.New("invalid user data")
     }
     return nil, errors.New("The " + username + " not found.")
 }
 
+// getManagedUserNoLock retrieves username, requiring the actor to be that user or an admin
+func (s *Storage) getManagedUserNoLock(actor, username, action string) (*user.User, error) {
+    actorUser, err := s.getUserNoLock(actor)
+    if err != nil {
+        return nil, err
+    }
+
+    u, err := s.getUserNoLock(username)
+    if err != nil {
+        return nil, err
+    }
+
+    if actorUser != u && !actorUser.IsAdmin() {
+        return nil, &PermissionError{Actor: actor, Action: action, Target: username}
+    }
+    return u, nil
+}
+
 // getFolderNoLock retrieves a folder
 func (s *Storage) getFolderNoLock(user *user.User, folderName string) (*folder.Folder, error) {
-    lowercaseFolderName := strings.ToLower(folderName)
-    if value, exists := user.Folders.Search(lowercaseFolderName); exists {
+    folderKey := naming.Key(folderName)
+    if value, exists := user.Folders.Search(folderKey); exists {
         if folder, ok := value.(*folder.Folder); ok {
             return folder, nil
         }
         return nil, errors.New("invalid folder data")
     }
     return nil, errors.New("The " + folderName + " not found.")
-}
\ No newline at end of file
+}
+
+// getFileNoLock retrieves a file
+func (s *Storage) getFileNoLock(folder *folder.Folder, fileName string) (*file.File, error) {
+    fileKey := naming.Key(fileName)
+    if value, exists := folder.Files.Search(fileKey); exists {
+        if file, ok := value.(*file.File); ok {
+            return file, nil
+        }
+        return nil, errors.New("invalid file data")
+    }
+    return nil, errors.New("The " + fileName + " not found.")
+}
+
+// canAccessFile reports whether any of the principals holds permission p on
+// a file, either through the folder's ACL or the file's own
+func canAccessFile(principals []string, folder *folder.Folder, file *file.File, p acl.Permission) bool {
+    return folder.ACL.AllowsAny(principals, p) || file.ACL.AllowsAny(principals, p)
+}
+
+// canAccessAnyFile reports whether any of the principals may read one of the files in a folder
+func canAccessAnyFile(principals []string, folder *folder.Folder) bool {
+    for _, value := range folder.Files.PrefixSearch("") {
+        if f, ok := value.(*file.File); ok && canAccessFile(principals, folder, f, acl.Read) {
+            return true
+        }
+    }
+    return false
+}
+
+// lessName orders names case-insensitively, falling back to the display
+// name so names differing only in case still sort deterministically
+func lessName(keyA, nameA, keyB, nameB string) bool {
+    if keyA != keyB {
+        return keyA < keyB
+    }
+    return nameA < nameB
+}
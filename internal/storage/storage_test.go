@@ -1,14 +1,23 @@
 package storage
 
 import (
+	"context"
+	"errors"
 	"reflect"
+	"regexp"
+	"sort"
+	"strings"
 	"testing"
 	"time"
-	"sort"
 
+	"github.com/fatbrother/virtual-file-system/internal/acl"
+	"github.com/fatbrother/virtual-file-system/internal/audit"
 	"github.com/fatbrother/virtual-file-system/internal/file"
-	"github.com/fatbrother/virtual-file-system/internal/user"
 	"github.com/fatbrother/virtual-file-system/internal/folder"
+	"github.com/fatbrother/virtual-file-system/internal/naming"
+	"github.com/fatbrother/virtual-file-system/internal/search"
+	"github.com/fatbrother/virtual-file-system/internal/tag"
+	"github.com/fatbrother/virtual-file-system/internal/user"
 )
 
 func TestStorage_AddUser(t *testing.T) {
@@ -60,21 +69,25 @@ func TestStorage_GetUser(t *testing.T) {
 
 func TestStorage_DeleteUser(t *testing.T) {
 	s := NewStorage()
+	_ = s.AddUser("admin")
 	_ = s.AddUser("testuser")
 
 	tests := []struct {
 		name     string
+		actor    string
 		username string
 		wantErr  bool
 	}{
-		{"Existing user", "testuser", false},
-		{"Case-insensitive", "TestUser", false},
-		{"Non-existent user", "nonexistent", true},
+		{"Existing user", "admin", "testuser", false},
+		{"Case-insensitive", "ADMIN", "TestUser", false},
+		{"Non-existent user", "admin", "nonexistent", true},
+		{"Non-admin", "testuser", "testuser", true},
+		{"Last admin", "admin", "admin", true},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := s.DeleteUser(tt.username)
+			err := s.DeleteUser(tt.actor, tt.username)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Storage.DeleteUser() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -103,7 +116,7 @@ func TestStorage_CreateFolder(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := s.CreateFolder(tt.username, tt.folderName, tt.description)
+			err := s.CreateFolder(tt.username, tt.username, tt.folderName, tt.description)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Storage.CreateFolder() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -114,7 +127,7 @@ func TestStorage_CreateFolder(t *testing.T) {
 func TestStorage_DeleteFolder(t *testing.T) {
 	s := NewStorage()
 	_ = s.AddUser("testuser")
-	_ = s.CreateFolder("testuser", "documents", "My documents")
+	_ = s.CreateFolder("testuser", "testuser", "documents", "My documents")
 
 	tests := []struct {
 		name       string
@@ -129,7 +142,7 @@ func TestStorage_DeleteFolder(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := s.DeleteFolder(tt.username, tt.folderName)
+			err := s.DeleteFolder(tt.username, tt.username, tt.folderName)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Storage.DeleteFolder() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -140,9 +153,9 @@ func TestStorage_DeleteFolder(t *testing.T) {
 func TestStorage_ListFolders(t *testing.T) {
 	s := NewStorage()
 	_ = s.AddUser("testuser")
-	_ = s.CreateFolder("testuser", "documents", "My documents")
+	_ = s.CreateFolder("testuser", "testuser", "documents", "My documents")
 	time.Sleep(1 * time.Second) // 確保創建時間不同
-	_ = s.CreateFolder("testuser", "pictures", "My pictures")
+	_ = s.CreateFolder("testuser", "testuser", "pictures", "My pictures")
 
 	tests := []struct {
 		name      string
@@ -185,7 +198,7 @@ func TestStorage_ListFolders(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := s.ListFolders(tt.username, tt.sortField, tt.sortOrder)
+			got, err := s.ListFolders(tt.username, tt.username, SortSpec{{Field: SortField(tt.sortField), Desc: tt.sortOrder == "desc"}}, ListFilter{})
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Storage.ListFolders() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -203,7 +216,7 @@ func TestStorage_ListFolders(t *testing.T) {
 func TestStorage_CreateFile(t *testing.T) {
 	s := NewStorage()
 	_ = s.AddUser("testuser")
-	_ = s.CreateFolder("testuser", "documents", "My documents")
+	_ = s.CreateFolder("testuser", "testuser", "documents", "My documents")
 
 	tests := []struct {
 		name        string
@@ -222,7 +235,7 @@ func TestStorage_CreateFile(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := s.CreateFile(tt.username, tt.folderName, tt.fileName, tt.description)
+			err := s.CreateFile(tt.username, tt.username, tt.folderName, tt.fileName, tt.description)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Storage.CreateFile() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -233,8 +246,8 @@ func TestStorage_CreateFile(t *testing.T) {
 func TestStorage_DeleteFile(t *testing.T) {
 	s := NewStorage()
 	_ = s.AddUser("testuser")
-	_ = s.CreateFolder("testuser", "documents", "My documents")
-	_ = s.CreateFile("testuser", "documents", "file1.txt", "File description")
+	_ = s.CreateFolder("testuser", "testuser", "documents", "My documents")
+	_ = s.CreateFile("testuser", "testuser", "documents", "file1.txt", "File description")
 
 	tests := []struct {
 		name       string
@@ -251,7 +264,7 @@ func TestStorage_DeleteFile(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := s.DeleteFile(tt.username, tt.folderName, tt.fileName)
+			err := s.DeleteFile(tt.username, tt.username, tt.folderName, tt.fileName)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Storage.DeleteFile() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -262,10 +275,10 @@ func TestStorage_DeleteFile(t *testing.T) {
 func TestStorage_ListFiles(t *testing.T) {
 	s := NewStorage()
 	_ = s.AddUser("testuser")
-	_ = s.CreateFolder("testuser", "documents", "My documents")
-	_ = s.CreateFile("testuser", "documents", "file1.txt", "File description")
+	_ = s.CreateFolder("testuser", "testuser", "documents", "My documents")
+	_ = s.CreateFile("testuser", "testuser", "documents", "file1.txt", "File description")
 	time.Sleep(1 * time.Second) // 確保創建時間不同
-	_ = s.CreateFile("testuser", "documents", "file2.txt", "Another file description")
+	_ = s.CreateFile("testuser", "testuser", "documents", "file2.txt", "Another file description")
 
 	tests := []struct {
 		name       string
@@ -279,29 +292,29 @@ func TestStorage_ListFiles(t *testing.T) {
 		{
 			"Sort by name asc", "testuser", "documents", "name", "asc",
 			[]file.File{
-				{Name: "file1.txt", Description: "File description"},
-				{Name: "file2.txt", Description: "Another file description"},
+				{Name: "file1.txt", Description: "File description", Version: 4},
+				{Name: "file2.txt", Description: "Another file description", Version: 6},
 			}, false,
 		},
 		{
 			"Sort by name desc", "testuser", "documents", "name", "desc",
 			[]file.File{
-				{Name: "file2.txt", Description: "Another file description"},
-				{Name: "file1.txt", Description: "File description"},
+				{Name: "file2.txt", Description: "Another file description", Version: 6},
+				{Name: "file1.txt", Description: "File description", Version: 4},
 			}, false,
 		},
 		{
 			"Sort by created asc", "testuser", "documents", "created", "asc",
 			[]file.File{
-				{Name: "file1.txt", Description: "File description"},
-				{Name: "file2.txt", Description: "Another file description"},
+				{Name: "file1.txt", Description: "File description", Version: 4},
+				{Name: "file2.txt", Description: "Another file description", Version: 6},
 			}, false,
 		},
 		{
 			"Sort by created desc", "testuser", "documents", "created", "desc",
 			[]file.File{
-				{Name: "file2.txt", Description: "Another file description"},
-				{Name: "file1.txt", Description: "File description"},
+				{Name: "file2.txt", Description: "Another file description", Version: 6},
+				{Name: "file1.txt", Description: "File description", Version: 4},
 			}, false,
 		},
 		{"Non-existent folder", "testuser", "nonexistent", "name", "asc", nil, true},
@@ -310,7 +323,7 @@ func TestStorage_ListFiles(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := s.ListFiles(tt.username, tt.folderName, tt.sortField, tt.sortOrder)
+			got, err := s.ListFiles(tt.username, tt.username, tt.folderName, SortSpec{{Field: SortField(tt.sortField), Desc: tt.sortOrder == "desc"}}, ListFilter{})
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Storage.ListFiles() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -318,6 +331,8 @@ func TestStorage_ListFiles(t *testing.T) {
 
 			for i := range got {
 				tt.want[i].CreatedAt = got[i].CreatedAt
+				tt.want[i].ModifiedAt = got[i].ModifiedAt
+				tt.want[i].ACL = got[i].ACL
 			}
 
 			if !reflect.DeepEqual(got, tt.want) {
@@ -325,4 +340,1310 @@ func TestStorage_ListFiles(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestStorage_UnicodeNames(t *testing.T) {
+	s := NewStorage()
+	if err := s.AddUser("jos\u00e9"); err != nil {
+		t.Fatalf("Storage.AddUser() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		username string
+	}{
+		{"Decomposed form", "jose\u0301"},
+		{"Upper case", "JOS\u00c9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.AddUser(tt.username); err == nil {
+				t.Errorf("Storage.AddUser(%q) succeeded, want duplicate error", tt.username)
+			}
+			if _, err := s.GetUser(tt.username); err != nil {
+				t.Errorf("Storage.GetUser(%q) error = %v", tt.username, err)
+			}
+		})
+	}
+
+	_ = s.CreateFolder("jos\u00e9", "jos\u00e9", "stra\u00dfe", "Street")
+	if err := s.CreateFolder("jose\u0301", "jose\u0301", "STRASSE", "Duplicate"); err == nil {
+		t.Errorf("Storage.CreateFolder() succeeded for a case-folded duplicate")
+	}
+	if err := s.DeleteFolder("jos\u00e9", "jos\u00e9", "Strasse"); err != nil {
+		t.Errorf("Storage.DeleteFolder() error = %v", err)
+	}
+	_ = s.AddUser("other")
+	if err := s.DeleteUser("jose\u0301", "other"); err != nil {
+		t.Errorf("Storage.DeleteUser() error = %v", err)
+	}
+}
+
+func TestStorage_CasePreserving(t *testing.T) {
+	s := NewStorage()
+	_ = s.AddUser("Alice")
+	_ = s.CreateFolder("alice", "alice", "Reports", "Quarterly reports")
+	_ = s.CreateFolder("ALICE", "alice", "archive", "Old files")
+	_ = s.CreateFile("alice", "alice", "REPORTS", "MyReport.PDF", "Q1")
+
+	if err := s.CreateFile("alice", "alice", "reports", "myreport.pdf", "Duplicate"); err == nil {
+		t.Errorf("Storage.CreateFile() succeeded for a duplicate differing only in case")
+	}
+
+	u, err := s.GetUser("ALICE")
+	if err != nil || u.Username != "Alice" {
+		t.Errorf("Storage.GetUser() = %v, %v, want Alice", u, err)
+	}
+
+	folders, _ := s.ListFolders("alice", "alice", nil, ListFilter{})
+	if len(folders) != 2 || folders[0].Name != "archive" || folders[1].Name != "Reports" {
+		t.Errorf("Storage.ListFolders() = %v, want [archive Reports]", folders)
+	}
+
+	files, _ := s.ListFiles("alice", "alice", "reports", nil, ListFilter{})
+	if len(files) != 1 || files[0].Name != "MyReport.PDF" {
+		t.Errorf("Storage.ListFiles() = %v, want [MyReport.PDF]", files)
+	}
+
+	if err := s.DeleteFile("alice", "alice", "reports", "MYREPORT.pdf"); err != nil {
+		t.Errorf("Storage.DeleteFile() error = %v", err)
+	}
+}
+
+func TestStorage_AccessControl(t *testing.T) {
+	s := NewStorage()
+	_ = s.AddUser("owner")
+	_ = s.AddUser("reader")
+	_ = s.AddUser("writer")
+	_ = s.AddUser("stranger")
+	_ = s.CreateFolder("owner", "owner", "shared", "Shared folder")
+	_ = s.CreateFolder("owner", "owner", "private", "Private folder")
+	_ = s.CreateFile("owner", "owner", "shared", "report.txt", "Report")
+	_ = s.CreateFile("owner", "owner", "private", "secret.txt", "Secret")
+
+	if err := s.ShareFolder("reader", "owner", "shared", "reader", acl.Write); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Storage.ShareFolder() by non-owner error = %v, want permission denied", err)
+	}
+	if err := s.ShareFolder("owner", "owner", "shared", "reader", acl.Read); err != nil {
+		t.Fatalf("Storage.ShareFolder() error = %v", err)
+	}
+	if err := s.ShareFolder("owner", "owner", "shared", "writer", acl.Write); err != nil {
+		t.Fatalf("Storage.ShareFolder() error = %v", err)
+	}
+	if err := s.ShareFile("owner", "owner", "private", "secret.txt", "stranger", acl.Read); err != nil {
+		t.Fatalf("Storage.ShareFile() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		op      func() error
+		wantErr bool
+	}{
+		{"Reader lists shared files", func() error { _, err := s.ListFiles("reader", "owner", "shared", nil, ListFilter{}); return err }, false},
+		{"Reader cannot create file", func() error { return s.CreateFile("reader", "owner", "shared", "new.txt", "") }, true},
+		{"Reader cannot delete file", func() error { return s.DeleteFile("reader", "owner", "shared", "report.txt") }, true},
+		{"Reader cannot list private files", func() error { _, err := s.ListFiles("reader", "owner", "private", nil, ListFilter{}); return err }, true},
+		{"Writer creates file", func() error { return s.CreateFile("writer", "owner", "shared", "draft.txt", "") }, false},
+		{"Writer cannot delete folder", func() error { return s.DeleteFolder("writer", "owner", "shared") }, true},
+		{"Writer cannot create folder for owner", func() error { return s.CreateFolder("writer", "owner", "mine", "") }, true},
+		{"Stranger cannot delete owner", func() error { return s.DeleteUser("stranger", "owner") }, true},
+		{"Stranger reads shared file", func() error { _, err := s.ListFiles("stranger", "owner", "private", nil, ListFilter{}); return err }, false},
+		{"Stranger cannot delete shared file", func() error { return s.DeleteFile("stranger", "owner", "private", "secret.txt") }, true},
+		{"Unknown actor", func() error { return s.CreateFile("nobody", "owner", "shared", "x.txt", "") }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.op(); (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	folders, _ := s.ListFolders("reader", "owner", nil, ListFilter{})
+	if len(folders) != 1 || folders[0].Name != "shared" {
+		t.Errorf("Storage.ListFolders() for reader = %v, want [shared]", folders)
+	}
+
+	files, _ := s.ListFiles("stranger", "owner", "private", nil, ListFilter{})
+	if len(files) != 1 || files[0].Name != "secret.txt" {
+		t.Errorf("Storage.ListFiles() for stranger = %v, want [secret.txt]", files)
+	}
+
+	// Grants do not survive the grantee being deleted and re-registered
+	_ = s.DeleteUser("owner", "reader")
+	_ = s.AddUser("reader")
+	if folders, _ := s.ListFolders("reader", "owner", nil, ListFilter{}); len(folders) != 0 {
+		t.Errorf("Storage.ListFolders() for re-registered reader = %v, want none", folders)
+	}
+}
+
+func TestStorage_Authenticate(t *testing.T) {
+	s := NewStorage()
+	_ = s.AddUser("alice")
+	_ = s.AddUser("bob")
+
+	if err := s.SetPassword("bob", "alice", "takeover!"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Storage.SetPassword() for another user error = %v, want permission denied", err)
+	}
+	if err := s.SetPassword("alice", "alice", "wonderland"); err != nil {
+		t.Fatalf("Storage.SetPassword() error = %v", err)
+	}
+
+	if err := s.AddUserWithPassword("carol", "carol-password"); err != nil {
+		t.Fatalf("Storage.AddUserWithPassword() error = %v", err)
+	}
+	if err := s.AddUserWithPassword("dave", "short"); err == nil {
+		t.Errorf("Storage.AddUserWithPassword() with a short password succeeded")
+	}
+	if _, err := s.GetUser("dave"); err == nil {
+		t.Errorf("Storage.AddUserWithPassword() with a short password registered the user")
+	}
+	_ = s.AddUser("dave")
+	// alice is an admin, being the first user
+	if err := s.SetPassword("alice", "dave", "reset-password"); err != nil {
+		t.Fatalf("Storage.SetPassword() by an admin error = %v", err)
+	}
+
+	secret, token, err := s.CreateToken("alice", "alice", "ci")
+	if err != nil {
+		t.Fatalf("Storage.CreateToken() error = %v", err)
+	}
+	if _, _, err := s.CreateToken("bob", "alice", "stolen"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Storage.CreateToken() for another user error = %v, want permission denied", err)
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		secret   string
+		wantErr  bool
+	}{
+		{"Password", "alice", "wonderland", false},
+		{"Token", "ALICE", secret, false},
+		{"Wrong password", "alice", "wrong", true},
+		{"No credentials", "bob", "", true},
+		{"Registered with password", "carol", "carol-password", false},
+		{"Reset by admin", "dave", "reset-password", false},
+		{"Unknown user", "erin", "wonderland", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.Authenticate(tt.username, tt.secret)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Storage.Authenticate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && err != ErrAuthenticationFailed {
+				t.Errorf("Storage.Authenticate() error = %v, want %v", err, ErrAuthenticationFailed)
+			}
+		})
+	}
+
+	if tokens, _ := s.ListTokens("alice", "alice"); len(tokens) != 1 || tokens[0].ID != token.ID {
+		t.Errorf("Storage.ListTokens() = %v", tokens)
+	}
+	_ = s.RevokeToken("alice", "alice", token.ID)
+	if _, err := s.Authenticate("alice", secret); err == nil {
+		t.Errorf("Storage.Authenticate() accepted a revoked token")
+	}
+}
+
+func TestStorage_Roles(t *testing.T) {
+	s := NewStorage()
+	_ = s.AddUser("root")
+	_ = s.AddUser("alice")
+
+	if u, _ := s.GetUser("root"); !u.IsAdmin() {
+		t.Errorf("first user role = %v, want admin", u.Role)
+	}
+	if u, _ := s.GetUser("alice"); u.IsAdmin() {
+		t.Errorf("second user role = %v, want user", u.Role)
+	}
+
+	if err := s.SetRole("alice", "alice", user.RoleAdmin); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Storage.SetRole() by non-admin error = %v, want permission denied", err)
+	}
+	if err := s.SetRole("root", "root", user.RoleUser); err == nil {
+		t.Errorf("Storage.SetRole() demoted the last admin")
+	}
+	if err := s.SetRole("root", "alice", user.RoleAdmin); err != nil {
+		t.Fatalf("Storage.SetRole() error = %v", err)
+	}
+	if err := s.DeleteUser("alice", "root"); err != nil {
+		t.Errorf("Storage.DeleteUser() by promoted admin error = %v", err)
+	}
+}
+
+func TestStorage_Groups(t *testing.T) {
+	s := NewStorage()
+	_ = s.AddUser("root")
+	_ = s.AddUser("owner")
+	_ = s.AddUser("member")
+	_ = s.AddUser("stranger")
+	_ = s.CreateFolder("owner", "owner", "project", "Project files")
+
+	if err := s.CreateGroup("owner", "Devs"); err != nil {
+		t.Fatalf("Storage.CreateGroup() error = %v", err)
+	}
+	if err := s.CreateGroup("stranger", "DEVS"); err == nil {
+		t.Errorf("Storage.CreateGroup() succeeded for a duplicate differing only in case")
+	}
+	if err := s.AddGroupMember("stranger", "devs", "stranger"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Storage.AddGroupMember() by non-owner error = %v, want permission denied", err)
+	}
+	if err := s.AddGroupMember("owner", "devs", "Member"); err != nil {
+		t.Fatalf("Storage.AddGroupMember() error = %v", err)
+	}
+	if err := s.ShareFolderWithGroup("member", "owner", "project", "devs", acl.Write); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Storage.ShareFolderWithGroup() by non-owner error = %v, want permission denied", err)
+	}
+	if err := s.ShareFolderWithGroup("owner", "owner", "project", "devs", acl.Write); err != nil {
+		t.Fatalf("Storage.ShareFolderWithGroup() error = %v", err)
+	}
+
+	if members, _ := s.ListGroupMembers("devs"); !reflect.DeepEqual(members, []string{"member", "owner"}) {
+		t.Errorf("Storage.ListGroupMembers() = %v", members)
+	}
+	if err := s.CreateFile("member", "owner", "project", "plan.txt", ""); err != nil {
+		t.Errorf("Storage.CreateFile() by group member error = %v", err)
+	}
+	if err := s.CreateFile("stranger", "owner", "project", "x.txt", ""); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Storage.CreateFile() by non-member error = %v, want permission denied", err)
+	}
+
+	// Members may leave; afterwards they lose the group's access
+	if err := s.RemoveGroupMember("member", "devs", "member"); err != nil {
+		t.Fatalf("Storage.RemoveGroupMember() error = %v", err)
+	}
+	if err := s.CreateFile("member", "owner", "project", "late.txt", ""); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Storage.CreateFile() after leaving error = %v, want permission denied", err)
+	}
+
+	// Admins may manage any group, and deleting it removes its grants
+	_ = s.AddGroupMember("root", "devs", "stranger")
+	if err := s.DeleteGroup("root", "devs"); err != nil {
+		t.Fatalf("Storage.DeleteGroup() error = %v", err)
+	}
+	_ = s.CreateGroup("owner", "devs")
+	_ = s.AddGroupMember("owner", "devs", "stranger")
+	if folders, _ := s.ListFolders("stranger", "owner", nil, ListFilter{}); len(folders) != 0 {
+		t.Errorf("Storage.ListFolders() through a recreated group = %v, want none", folders)
+	}
+	if groups, _ := s.ListGroups(); len(groups) != 1 || groups[0].Name != "devs" {
+		t.Errorf("Storage.ListGroups() = %v", groups)
+	}
+}
+
+func TestStorage_Quota(t *testing.T) {
+	s := NewStorage()
+	_ = s.AddUser("root")
+	_ = s.AddUser("alice")
+	_ = s.AddUser("bob")
+
+	if err := s.SetQuota("alice", "alice", user.Quota{}); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Storage.SetQuota() by non-admin error = %v, want permission denied", err)
+	}
+	if err := s.SetQuota("root", "alice", user.Quota{MaxFolders: 1, MaxFiles: 2, MaxBytes: 10}); err != nil {
+		t.Fatalf("Storage.SetQuota() error = %v", err)
+	}
+
+	_ = s.CreateFolder("alice", "alice", "docs", "four")
+	_ = s.ShareFolder("alice", "alice", "docs", "bob", acl.Write)
+
+	tests := []struct {
+		name    string
+		op      func() error
+		wantErr bool
+	}{
+		{"Too many folders", func() error { return s.CreateFolder("alice", "alice", "more", "") }, true},
+		{"File within quota", func() error { return s.CreateFile("alice", "alice", "docs", "a.txt", "six...") }, false},
+		{"Too many bytes", func() error { return s.CreateFile("alice", "alice", "docs", "b.txt", "x") }, true},
+		{"Shared writers count against the owner", func() error { return s.CreateFile("bob", "alice", "docs", "c.txt", "x") }, true},
+		{"File without description", func() error { return s.CreateFile("bob", "alice", "docs", "d.txt", "") }, false},
+		{"Too many files", func() error { return s.CreateFile("alice", "alice", "docs", "e.txt", "") }, true},
+		{"Other users are unaffected", func() error { return s.CreateFolder("bob", "bob", "more", "") }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.op()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, ErrQuotaExceeded) {
+				t.Errorf("error = %v, want quota exceeded", err)
+			}
+		})
+	}
+
+	quota, usage, err := s.GetQuota("alice", "alice")
+	if err != nil || quota.MaxFiles != 2 || usage != (user.Usage{Folders: 1, Files: 2, Bytes: 10}) {
+		t.Errorf("Storage.GetQuota() = %+v, %+v, %v", quota, usage, err)
+	}
+	if _, _, err := s.GetQuota("bob", "alice"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Storage.GetQuota() of another user error = %v, want permission denied", err)
+	}
+
+	// Restoring from the trash cannot take the user over their folder or file limits
+	restore := func(kind string) error {
+		items, _ := s.ListTrash("alice", "alice")
+		for _, item := range items {
+			if item.Kind() == kind {
+				_, err := s.RestoreFromTrash("alice", "alice", item.ID)
+				return err
+			}
+		}
+		t.Fatalf("no %s in the trash", kind)
+		return nil
+	}
+	_ = s.DeleteFile("alice", "alice", "docs", "a.txt")
+	if err := s.CreateFile("alice", "alice", "docs", "e.txt", ""); err != nil {
+		t.Fatalf("Storage.CreateFile() after deleting a file error = %v", err)
+	}
+	if err := restore("file"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Storage.RestoreFromTrash() of a file error = %v, want quota exceeded", err)
+	}
+	_ = s.DeleteFolder("alice", "alice", "docs")
+	if err := s.CreateFolder("alice", "alice", "more", ""); err != nil {
+		t.Fatalf("Storage.CreateFolder() after deleting a folder error = %v", err)
+	}
+	if err := restore("folder"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Storage.RestoreFromTrash() of a folder error = %v, want quota exceeded", err)
+	}
+}
+
+func TestStorage_Trash(t *testing.T) {
+	s := NewStorage()
+	_ = s.AddUser("alice")
+	_ = s.AddUser("bob")
+	_ = s.CreateFolder("alice", "alice", "docs", "Documents")
+	_ = s.CreateFile("alice", "alice", "docs", "a.txt", "A")
+	_ = s.CreateFile("alice", "alice", "docs", "b.txt", "B")
+	_ = s.ShareFolder("alice", "alice", "docs", "bob", acl.Write)
+
+	_ = s.DeleteFile("bob", "alice", "docs", "a.txt")
+	_ = s.DeleteFolder("alice", "alice", "docs")
+
+	items, err := s.ListTrash("alice", "alice")
+	if err != nil || len(items) != 2 {
+		t.Fatalf("Storage.ListTrash() = %v, %v", items, err)
+	}
+	if items[0].Location() != "docs/a.txt" || items[0].DeletedBy != "bob" || items[1].Location() != "docs" {
+		t.Errorf("Storage.ListTrash() = %v", items)
+	}
+	if _, err := s.ListTrash("bob", "alice"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Storage.ListTrash() of another user error = %v, want permission denied", err)
+	}
+	if _, usage, _ := s.GetQuota("alice", "alice"); usage != (user.Usage{Bytes: 11}) {
+		t.Errorf("usage with trashed items = %+v", usage)
+	}
+
+	// The file's folder is gone, so it cannot be restored yet
+	if _, err := s.RestoreFromTrash("alice", "alice", items[0].ID); err == nil {
+		t.Errorf("Storage.RestoreFromTrash() restored a file without its folder")
+	}
+	if _, err := s.RestoreFromTrash("alice", "alice", items[1].ID); err != nil {
+		t.Fatalf("Storage.RestoreFromTrash() folder error = %v", err)
+	}
+	if _, err := s.RestoreFromTrash("alice", "alice", items[0].ID); err != nil {
+		t.Fatalf("Storage.RestoreFromTrash() file error = %v", err)
+	}
+
+	files, _ := s.ListFiles("bob", "alice", "docs", nil, ListFilter{})
+	if len(files) != 2 || files[0].Name != "a.txt" || files[1].Name != "b.txt" {
+		t.Errorf("Storage.ListFiles() after restore = %v", files)
+	}
+
+	// A restored folder conflicts with one created in the meantime
+	_ = s.DeleteFolder("alice", "alice", "docs")
+	_ = s.CreateFolder("alice", "alice", "docs", "")
+	items, _ = s.ListTrash("alice", "alice")
+	if _, err := s.RestoreFromTrash("alice", "alice", items[0].ID); err == nil {
+		t.Errorf("Storage.RestoreFromTrash() overwrote an existing folder")
+	}
+
+	if n, err := s.EmptyTrash("alice", "alice"); err != nil || n != 1 {
+		t.Errorf("Storage.EmptyTrash() = %d, %v", n, err)
+	}
+
+	s.SetTrashRetention(time.Nanosecond)
+	_ = s.DeleteFolder("alice", "alice", "docs")
+	time.Sleep(time.Millisecond)
+	if n := s.PurgeTrash(); n != 1 {
+		t.Errorf("Storage.PurgeTrash() = %d, want 1", n)
+	}
+}
+
+func TestStorage_DeleteUserWithOptions(t *testing.T) {
+	s := NewStorage()
+	_ = s.AddUser("root")
+	_ = s.AddUser("alice")
+	_ = s.AddUser("bob")
+	_ = s.AddUser("carol")
+	_ = s.CreateFolder("alice", "alice", "docs", "Docs")
+	_ = s.CreateFolder("alice", "alice", "old", "")
+	_ = s.CreateFile("alice", "alice", "docs", "a.txt", "A")
+	_ = s.CreateFile("alice", "alice", "old", "b.txt", "")
+	_ = s.DeleteFolder("alice", "alice", "old")
+	_ = s.CreateFolder("carol", "carol", "shared", "")
+	_ = s.ShareFolder("carol", "carol", "shared", "alice", acl.Write)
+	_ = s.CreateFile("alice", "carol", "shared", "from-alice.txt", "")
+	_ = s.CreateGroup("alice", "team")
+
+	report, err := s.DeleteUserWithOptions("root", "alice", DeleteUserOptions{DryRun: true})
+	want := DeletionReport{Username: "alice", Folders: 1, Files: 1, Bytes: 5, TrashedItems: 1}
+	if err != nil || report != want {
+		t.Errorf("dry run = %+v, %v, want %+v", report, err, want)
+	}
+	if _, err := s.GetUser("alice"); err != nil {
+		t.Errorf("dry run deleted the user: %v", err)
+	}
+
+	_ = s.CreateFolder("bob", "bob", "docs", "")
+	if _, err := s.DeleteUserWithOptions("root", "alice", DeleteUserOptions{TransferTo: "bob"}); err == nil {
+		t.Errorf("transfer succeeded despite a folder name clash")
+	}
+	if _, err := s.DeleteUserWithOptions("root", "alice", DeleteUserOptions{TransferTo: "alice"}); err == nil {
+		t.Errorf("transfer to the deleted user succeeded")
+	}
+	_ = s.DeleteFolder("bob", "bob", "docs")
+
+	report, err = s.DeleteUserWithOptions("root", "alice", DeleteUserOptions{TransferTo: "bob"})
+	if err != nil || report.TransferredTo != "bob" {
+		t.Fatalf("transfer = %+v, %v", report, err)
+	}
+
+	// bob now owns the folder and everything alice created
+	if err := s.DeleteFile("bob", "bob", "docs", "a.txt"); err != nil {
+		t.Errorf("Storage.DeleteFile() in transferred folder error = %v", err)
+	}
+	if err := s.ShareFile("bob", "carol", "shared", "from-alice.txt", "root", acl.Read); err != nil {
+		t.Errorf("Storage.ShareFile() of a transferred file error = %v", err)
+	}
+	if err := s.AddGroupMember("bob", "team", "carol"); err != nil {
+		t.Errorf("Storage.AddGroupMember() of a transferred group error = %v", err)
+	}
+
+	// Without a transfer, files in other namespaces fall to the folder owner
+	_ = s.ShareFolder("carol", "carol", "shared", "bob", acl.Write)
+	_ = s.CreateFile("bob", "carol", "shared", "from-bob.txt", "")
+	_ = s.DeleteUser("root", "bob")
+	_ = s.AddUser("bob")
+	if err := s.ShareFile("bob", "carol", "shared", "from-bob.txt", "root", acl.Read); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("re-registered user kept ownership: %v", err)
+	}
+	if err := s.ShareFile("carol", "carol", "shared", "from-bob.txt", "root", acl.Read); err != nil {
+		t.Errorf("Storage.ShareFile() by the new owner error = %v", err)
+	}
+}
+
+func TestStorage_FileVersions(t *testing.T) {
+	s := NewStorage()
+	_ = s.AddUser("alice")
+	_ = s.AddUser("bob")
+	_ = s.CreateFolder("alice", "alice", "docs", "")
+	_ = s.CreateFile("alice", "alice", "docs", "notes.txt", "")
+	_ = s.ShareFolder("alice", "alice", "docs", "bob", acl.Read)
+
+	if _, err := s.WriteFile("alice", "alice", "docs", "notes.txt", []byte("first")); err != nil {
+		t.Fatalf("Storage.WriteFile() error = %v", err)
+	}
+	if _, err := s.WriteFile("bob", "alice", "docs", "notes.txt", []byte("vandalized")); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Storage.WriteFile() by reader error = %v, want permission denied", err)
+	}
+	_, _ = s.WriteFile("alice", "alice", "docs", "notes.txt", []byte("second"))
+
+	rev, err := s.ReadFile("bob", "alice", "docs", "notes.txt", 0)
+	if err != nil || rev.Number != 2 || string(rev.Content()) != "second" {
+		t.Errorf("Storage.ReadFile() current = %+v, %v", rev, err)
+	}
+	if rev, _ := s.ReadFile("bob", "alice", "docs", "notes.txt", 1); string(rev.Content()) != "first" {
+		t.Errorf("Storage.ReadFile() revision 1 = %q", rev.Content())
+	}
+
+	rev, err = s.RevertFile("alice", "alice", "docs", "notes.txt", 1)
+	if err != nil || rev.Number != 3 || rev.Author != "alice" || string(rev.Content()) != "first" {
+		t.Errorf("Storage.RevertFile() = %+v, %v", rev, err)
+	}
+
+	if err := s.SetRevisionLimit("bob", "alice", "docs", 1); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Storage.SetRevisionLimit() by non-owner error = %v, want permission denied", err)
+	}
+	if err := s.SetRevisionLimit("alice", "alice", "docs", 2); err != nil {
+		t.Fatalf("Storage.SetRevisionLimit() error = %v", err)
+	}
+	history, _ := s.FileHistory("alice", "alice", "docs", "notes.txt")
+	if len(history) != 2 || history[0].Number != 2 {
+		t.Errorf("Storage.FileHistory() after limit = %v", history)
+	}
+
+	// Every retained revision counts toward the quota
+	if _, usage, _ := s.GetQuota("alice", "alice"); usage.Bytes != int64(len("second")+len("first")) {
+		t.Errorf("usage = %+v", usage)
+	}
+	_ = s.SetQuota("alice", "alice", user.Quota{MaxBytes: 15})
+	if _, err := s.WriteFile("alice", "alice", "docs", "notes.txt", []byte("too long")); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Storage.WriteFile() over quota error = %v", err)
+	}
+}
+
+func TestStorage_Snapshots(t *testing.T) {
+	s := NewStorage()
+	_ = s.AddUser("alice")
+	_ = s.AddUser("bob")
+	_ = s.CreateFolder("alice", "alice", "docs", "")
+	_ = s.CreateFolder("alice", "alice", "pics", "")
+	_ = s.CreateFile("alice", "alice", "docs", "notes.txt", "")
+	_, _ = s.WriteFile("alice", "alice", "docs", "notes.txt", []byte("v1"))
+
+	if _, err := s.CreateSnapshot("bob", "alice", "nightly"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Storage.CreateSnapshot() by another user error = %v, want permission denied", err)
+	}
+	if _, err := s.CreateSnapshot("alice", "alice", "nightly"); err != nil {
+		t.Fatalf("Storage.CreateSnapshot() error = %v", err)
+	}
+	if _, err := s.CreateSnapshot("alice", "alice", "NIGHTLY"); err == nil {
+		t.Errorf("Storage.CreateSnapshot() succeeded for a duplicate name")
+	}
+
+	_, _ = s.WriteFile("alice", "alice", "docs", "notes.txt", []byte("v2"))
+	_ = s.CreateFile("alice", "alice", "docs", "new.txt", "")
+	_ = s.DeleteFolder("alice", "alice", "pics")
+	_ = s.CreateFolder("alice", "alice", "music", "")
+
+	// Only the changed folder and file were copied
+	u, _ := s.getUserNoLock("alice")
+	snap := u.Snapshots["nightly"]
+	live, _ := s.getFolderNoLock(u, "docs")
+	if snap.SharesFolder(live) {
+		t.Errorf("changed folder is still shared with the snapshot")
+	}
+	_ = s.CreateFolder("alice", "alice", "pics", "")
+	_ = s.RestoreSnapshot("alice", "alice", "nightly")
+	_ = s.CreateFolder("alice", "alice", "tmp", "")
+	if pics, _ := s.getFolderNoLock(u, "pics"); !snap.SharesFolder(pics) {
+		t.Errorf("unchanged folder was copied on restore")
+	}
+
+	folders, _ := s.ListFolders("alice", "alice", nil, ListFilter{})
+	if len(folders) != 3 || folders[0].Name != "docs" || folders[1].Name != "pics" || folders[2].Name != "tmp" {
+		t.Errorf("Storage.ListFolders() after restore = %v", folders)
+	}
+	if rev, _ := s.ReadFile("alice", "alice", "docs", "notes.txt", 0); string(rev.Content()) != "v1" {
+		t.Errorf("restored contents = %q, want v1", rev.Content())
+	}
+	if _, err := s.ReadFile("alice", "alice", "docs", "new.txt", 0); err == nil {
+		t.Errorf("file created after the snapshot survived the restore")
+	}
+
+	// Writing after a restore must not change the snapshot
+	_, _ = s.WriteFile("alice", "alice", "docs", "notes.txt", []byte("v3"))
+	_ = s.RestoreSnapshot("alice", "alice", "nightly")
+	if rev, _ := s.ReadFile("alice", "alice", "docs", "notes.txt", 0); string(rev.Content()) != "v1" {
+		t.Errorf("snapshot contents changed to %q", rev.Content())
+	}
+
+	snapshots, _ := s.ListSnapshots("alice", "alice")
+	if len(snapshots) != 1 || snapshots[0].Name != "nightly" {
+		t.Errorf("Storage.ListSnapshots() = %v", snapshots)
+	}
+	if err := s.DeleteSnapshot("alice", "alice", "nightly"); err != nil {
+		t.Errorf("Storage.DeleteSnapshot() error = %v", err)
+	}
+	if err := s.RestoreSnapshot("alice", "alice", "nightly"); err == nil {
+		t.Errorf("Storage.RestoreSnapshot() of a deleted snapshot succeeded")
+	}
+}
+
+func TestStorage_Tx(t *testing.T) {
+	s := NewStorage()
+	_ = s.AddUser("root")
+
+	// A failing transaction leaves no trace
+	err := s.Tx(func(tx *Tx) error {
+		if err := tx.AddUser("alice"); err != nil {
+			return err
+		}
+		if err := tx.CreateFolder("alice", "alice", "docs", ""); err != nil {
+			return err
+		}
+		if err := tx.ShareFolder("root", "root", "missing", "alice", acl.Read); err != nil {
+			return err
+		}
+		return nil
+	})
+	if err == nil {
+		t.Fatalf("Storage.Tx() error = nil, want the failing operation's error")
+	}
+	if _, err := s.GetUser("alice"); err == nil {
+		t.Errorf("user from a rolled back transaction exists")
+	}
+
+	err = s.Tx(func(tx *Tx) error {
+		if err := tx.AddUser("alice"); err != nil {
+			return err
+		}
+		if err := tx.CreateFolder("alice", "alice", "docs", ""); err != nil {
+			return err
+		}
+		if err := tx.CreateFile("alice", "alice", "docs", "a.txt", ""); err != nil {
+			return err
+		}
+		_, err := tx.WriteFile("alice", "alice", "docs", "a.txt", []byte("hello"))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Storage.Tx() error = %v", err)
+	}
+	if rev, err := s.ReadFile("alice", "alice", "docs", "a.txt", 0); err != nil || string(rev.Content()) != "hello" {
+		t.Errorf("committed file = %q, %v", rev.Content(), err)
+	}
+
+	// Changes inside a failed transaction do not leak into existing state,
+	// including snapshots that share items with the live tree
+	_, _ = s.CreateSnapshot("alice", "alice", "before")
+	_ = s.Tx(func(tx *Tx) error {
+		_, _ = tx.WriteFile("alice", "alice", "docs", "a.txt", []byte("changed"))
+		_ = tx.DeleteFolder("alice", "alice", "docs")
+		return errors.New("abort")
+	})
+	if rev, err := s.ReadFile("alice", "alice", "docs", "a.txt", 0); err != nil || string(rev.Content()) != "hello" {
+		t.Errorf("file after rollback = %q, %v", rev.Content(), err)
+	}
+	if items, _ := s.ListTrash("alice", "alice"); len(items) != 0 {
+		t.Errorf("trash after rollback = %v", items)
+	}
+
+	// Sharing between the live tree and snapshots survives a commit
+	_ = s.Tx(func(tx *Tx) error { return tx.CreateFolder("alice", "alice", "more", "") })
+	u, _ := s.getUserNoLock("alice")
+	docs, _ := s.getFolderNoLock(u, "docs")
+	if !u.Snapshots["before"].SharesFolder(docs) {
+		t.Errorf("commit broke sharing between the tree and its snapshot")
+	}
+
+	// Only the users a transaction uses are copied, and changes it makes to
+	// other users' folders are undone with it
+	_ = s.AddUser("bob")
+	_ = s.ShareFolder("alice", "alice", "docs", "bob", acl.Read)
+	liveRoot, _ := s.users.Search("root")
+	_ = s.Tx(func(tx *Tx) error {
+		if err := tx.DeleteUser("root", "bob"); err != nil {
+			return err
+		}
+		return errors.New("abort")
+	})
+	if _, err := s.ListFiles("bob", "alice", "docs", nil, ListFilter{}); err != nil {
+		t.Errorf("Storage.ListFiles() by a grantee after rollback error = %v", err)
+	}
+	_ = s.Tx(func(tx *Tx) error { return tx.CreateFolder("bob", "bob", "mine", "") })
+	if root, _ := s.users.Search("root"); root != liveRoot {
+		t.Errorf("commit replaced a user the transaction did not use")
+	}
+
+	// Operations of a rolled back transaction are audited as such
+	records, _ := s.QueryAudit("root", audit.Filter{Op: "DeleteUser"})
+	if len(records) != 1 || records[0].Result != audit.ResultRolledBack {
+		t.Errorf("audit records of a rolled back deletion = %v", records)
+	}
+	records, _ = s.QueryAudit("root", audit.Filter{Actor: "bob", Op: "CreateFolder"})
+	if len(records) != 1 || records[0].Result != audit.ResultOK {
+		t.Errorf("audit records of a committed transaction = %v", records)
+	}
+}
+
+func TestStorage_Versions(t *testing.T) {
+	s := NewStorage()
+	_ = s.AddUser("alice")
+	_ = s.AddUser("bob")
+	_ = s.CreateFolder("alice", "alice", "docs", "")
+	_ = s.CreateFile("alice", "alice", "docs", "notes.txt", "")
+
+	f, err := s.GetFolder("alice", "alice", "docs")
+	if err != nil || f.Version == 0 {
+		t.Fatalf("Storage.GetFolder() = %v, %v", f, err)
+	}
+	if _, err := s.GetFolder("bob", "alice", "docs"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Storage.GetFolder() by another user error = %v, want permission denied", err)
+	}
+
+	// Every change gives a higher version
+	fl, _ := s.GetFile("alice", "alice", "docs", "notes.txt")
+	_, _ = s.WriteFile("alice", "alice", "docs", "notes.txt", []byte("v1"))
+	written, _ := s.GetFile("alice", "alice", "docs", "notes.txt")
+	if written.Version <= fl.Version || written.Version <= f.Version {
+		t.Errorf("version after write = %d, before = %d", written.Version, fl.Version)
+	}
+	if files, _ := s.ListFiles("alice", "alice", "docs", nil, ListFilter{}); files[0].Version != written.Version {
+		t.Errorf("Storage.ListFiles() version = %d, want %d", files[0].Version, written.Version)
+	}
+
+	if _, err := s.UpdateFileDescription("alice", "alice", "docs", "notes.txt", "stale", fl.Version); !errors.Is(err, ErrConflict) {
+		t.Errorf("Storage.UpdateFileDescription() with a stale version error = %v, want conflict", err)
+	}
+	updated, err := s.UpdateFileDescription("alice", "alice", "docs", "notes.txt", "Meeting notes", written.Version)
+	if err != nil || updated <= written.Version {
+		t.Errorf("Storage.UpdateFileDescription() = %d, %v", updated, err)
+	}
+	if fl, _ := s.GetFile("alice", "alice", "docs", "notes.txt"); fl.Description != "Meeting notes" || fl.Version != updated {
+		t.Errorf("updated file = %v", fl)
+	}
+
+	if err := s.DeleteFileIfVersion("alice", "alice", "docs", "notes.txt", written.Version); !errors.Is(err, ErrConflict) {
+		t.Errorf("Storage.DeleteFileIfVersion() with a stale version error = %v, want conflict", err)
+	}
+	if err := s.DeleteFileIfVersion("alice", "alice", "docs", "notes.txt", updated); err != nil {
+		t.Errorf("Storage.DeleteFileIfVersion() error = %v", err)
+	}
+
+	// Deleting a file changed the folder
+	if err := s.DeleteFolderIfVersion("alice", "alice", "docs", f.Version); err == nil || err.Error() != "Conflict: alice/docs is at version 9, not 6." {
+		t.Errorf("Storage.DeleteFolderIfVersion() with a stale version error = %v", err)
+	}
+	if _, err := s.UpdateFolderDescription("bob", "alice", "docs", "mine", 0); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Storage.UpdateFolderDescription() by another user error = %v, want permission denied", err)
+	}
+	version, err := s.UpdateFolderDescription("alice", "alice", "docs", "My documents", 0)
+	if err != nil {
+		t.Fatalf("Storage.UpdateFolderDescription() error = %v", err)
+	}
+	if err := s.DeleteFolderIfVersion("alice", "alice", "docs", version); err != nil {
+		t.Errorf("Storage.DeleteFolderIfVersion() error = %v", err)
+	}
+}
+
+func TestStorage_Watch(t *testing.T) {
+	s := NewStorage()
+	_ = s.AddUser("alice")
+	_ = s.AddUser("bob")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := s.Watch(ctx, "alice", "alice", "do")
+	if err != nil {
+		t.Fatalf("Storage.Watch() error = %v", err)
+	}
+	others, _ := s.Watch(ctx, "bob", "alice", "")
+
+	_ = s.CreateFolder("alice", "alice", "docs", "")
+	_ = s.CreateFolder("alice", "alice", "pics", "")
+	_ = s.CreateFile("alice", "alice", "docs", "a.txt", "")
+	_, _ = s.WriteFile("alice", "alice", "docs", "a.txt", []byte("hi"))
+	_ = s.DeleteFile("alice", "alice", "docs", "a.txt")
+	_ = s.CreateFolder("alice", "alice", "docs", "") // fails, so no event
+
+	want := []string{"created alice/docs", "created alice/docs/a.txt", "updated alice/docs/a.txt", "deleted alice/docs/a.txt"}
+	for _, w := range want {
+		if e := <-events; e.Kind.String()+" "+e.Path() != w || e.Actor != "alice" {
+			t.Errorf("event = %s %s by %s, want %s", e.Kind, e.Path(), e.Actor, w)
+		}
+	}
+	if len(events) != 0 || len(others) != 0 {
+		t.Errorf("unexpected events: %d for alice, %d for bob", len(events), len(others))
+	}
+
+	// Only what the watcher can read is sent
+	_ = s.ShareFolder("alice", "alice", "pics", "bob", acl.Read)
+	if e := <-others; e.Kind != EventUpdated || e.Path() != "alice/pics" {
+		t.Errorf("event for bob = %s %s", e.Kind, e.Path())
+	}
+
+	// A transaction's events arrive on commit, and not at all on rollback
+	_ = s.Tx(func(tx *Tx) error {
+		_ = tx.CreateFile("alice", "alice", "docs", "b.txt", "")
+		if len(events) != 0 {
+			t.Errorf("event sent before the commit")
+		}
+		return nil
+	})
+	if e := <-events; e.Kind != EventCreated || e.File != "b.txt" {
+		t.Errorf("committed event = %s %s", e.Kind, e.Path())
+	}
+	_ = s.Tx(func(tx *Tx) error {
+		_ = tx.CreateFile("alice", "alice", "docs", "c.txt", "")
+		return errors.New("abort")
+	})
+	if len(events) != 0 {
+		t.Errorf("rolled back transaction sent %d events", len(events))
+	}
+
+	// A watcher that falls behind is told it missed events
+	for i := 0; i < watchBuffer+10; i++ {
+		_, _ = s.WriteFile("alice", "alice", "docs", "b.txt", []byte("x"))
+	}
+	for i := 0; i < watchBuffer; i++ {
+		<-events
+	}
+	if e := <-events; e.Kind != EventOverflow {
+		t.Errorf("event after a full buffer = %s, want overflow", e.Kind)
+	}
+
+	cancel()
+	for range events {
+	}
+	if _, err := s.Watch(context.Background(), "alice", "nobody", ""); err == nil {
+		t.Errorf("Storage.Watch() succeeded for a non-existent user")
+	}
+}
+
+func TestStorage_Audit(t *testing.T) {
+	s := NewStorage()
+	_ = s.AddUser("admin")
+	_ = s.AddUser("bob")
+	_ = s.CreateFolder("bob", "bob", "docs", "")
+	_ = s.DeleteFolder("admin", "bob", "docs")
+	_, _ = s.ListFiles("bob", "bob", "missing", nil, ListFilter{})
+
+	if _, err := s.QueryAudit("bob", audit.Filter{}); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Storage.QueryAudit() by a user error = %v, want permission denied", err)
+	}
+	records, err := s.QueryAudit("admin", audit.Filter{})
+	if err != nil {
+		t.Fatalf("Storage.QueryAudit() error = %v", err)
+	}
+	want := []struct{ actor, op, target, result string }{
+		{"", "AddUser", "admin", audit.ResultOK},
+		{"", "AddUser", "bob", audit.ResultOK},
+		{"bob", "CreateFolder", "bob/docs", audit.ResultOK},
+		{"admin", "DeleteFolder", "bob/docs", audit.ResultDenied},
+		{"bob", "ListFiles", "bob/missing", audit.ResultError},
+		{"bob", "QueryAudit", "audit", audit.ResultDenied},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("Storage.QueryAudit() = %d records, want %d", len(records), len(want))
+	}
+	for i, w := range want {
+		r := records[i]
+		if r.Actor != w.actor || r.Op != w.op || r.Target != w.target || r.Result != w.result {
+			t.Errorf("record %d = %s", i+1, r.Format())
+		}
+	}
+	if records[3].Error != "Permission denied: admin cannot delete bob/docs." {
+		t.Errorf("record 4 error = %q", records[3].Error)
+	}
+
+	// Operations in a transaction are recorded even if it is rolled back
+	_ = s.Tx(func(tx *Tx) error {
+		_ = tx.CreateFolder("bob", "bob", "tmp", "")
+		return errors.New("abort")
+	})
+	records, _ = s.QueryAudit("admin", audit.Filter{Actor: "bob", Op: "createfolder"})
+	if len(records) != 2 || records[1].Target != "bob/tmp" {
+		t.Errorf("Storage.QueryAudit(bob, CreateFolder) = %v", records)
+	}
+	if n, err := s.VerifyAudit("admin"); n != 10 || err != nil {
+		t.Errorf("Storage.VerifyAudit() = %d, %v", n, err)
+	}
+}
+
+func TestStorage_Hooks(t *testing.T) {
+	s := NewStorage()
+	_ = s.AddUser("alice")
+	_ = s.AddUser("bob")
+	_ = s.CreateFolder("alice", "alice", "private", "")
+	_ = s.CreateFolder("alice", "alice", "shared", "")
+
+	// No executables in shared folders
+	errExecutable := errors.New("No executables in shared folders.")
+	s.Before(OpCreateFile, func(ctx *HookContext) error {
+		shared := len(ctx.Folder.ACL.Grants(acl.Read))+len(ctx.Folder.ACL.Grants(acl.Write)) > 0
+		if shared && strings.HasSuffix(ctx.File.Name, ".exe") {
+			return errExecutable
+		}
+		return nil
+	})
+	var seen []string
+	s.After(OpCreateFile, func(ctx *HookContext) {
+		seen = append(seen, ctx.Actor.Username+" "+ctx.User.Username+"/"+ctx.Folder.Name+"/"+ctx.File.Name)
+	})
+	s.After(OpShareFolder, func(ctx *HookContext) {
+		seen = append(seen, "share "+ctx.Folder.Name+" with "+ctx.Grantee+" "+ctx.Permission.String())
+	})
+
+	_ = s.ShareFolder("alice", "alice", "shared", "bob", acl.Write)
+	if err := s.CreateFile("alice", "alice", "private", "tool.exe", ""); err != nil {
+		t.Errorf("Storage.CreateFile() in a private folder error = %v", err)
+	}
+	if err := s.CreateFile("bob", "alice", "shared", "tool.exe", ""); err != errExecutable {
+		t.Errorf("Storage.CreateFile() in a shared folder error = %v, want veto", err)
+	}
+	if _, err := s.GetFile("alice", "alice", "shared", "tool.exe"); err == nil {
+		t.Errorf("vetoed file was created")
+	}
+	_ = s.CreateFile("bob", "alice", "shared", "notes.txt", "")
+	_ = s.CreateFile("bob", "alice", "missing", "notes.txt", "")
+
+	// After hooks of a transaction run on commit only
+	_ = s.Tx(func(tx *Tx) error {
+		_ = tx.CreateFile("alice", "alice", "private", "a.txt", "")
+		if len(seen) != 3 {
+			t.Errorf("after hook ran before the commit")
+		}
+		return nil
+	})
+	_ = s.Tx(func(tx *Tx) error {
+		_ = tx.CreateFile("alice", "alice", "private", "b.txt", "")
+		return errors.New("abort")
+	})
+
+	want := []string{"share shared with bob write", "alice alice/private/tool.exe", "bob alice/shared/notes.txt", "alice alice/private/a.txt"}
+	if !reflect.DeepEqual(seen, want) {
+		t.Errorf("after hooks saw %q, want %q", seen, want)
+	}
+}
+
+func TestStorage_Update(t *testing.T) {
+	s := NewStorage()
+	_ = s.AddUser("alice")
+	_ = s.AddUser("bob")
+	_ = s.CreateFolder("alice", "alice", "docs", "Old")
+	_ = s.CreateFile("alice", "alice", "docs", "notes.txt", "Old")
+	_ = s.ShareFile("alice", "alice", "docs", "notes.txt", "bob", acl.Write)
+	before, _ := s.GetFolder("alice", "alice", "docs")
+	time.Sleep(10 * time.Millisecond)
+
+	description := "My documents"
+	if _, err := s.UpdateFolder("alice", "alice", "docs", FolderUpdate{}, 0); err == nil {
+		t.Errorf("Storage.UpdateFolder() without changes succeeded")
+	}
+	if _, err := s.UpdateFolder("bob", "alice", "docs", FolderUpdate{Description: &description}, 0); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Storage.UpdateFolder() by another user error = %v, want permission denied", err)
+	}
+	f, err := s.UpdateFolder("alice", "alice", "docs", FolderUpdate{Description: &description}, before.Version)
+	if err != nil {
+		t.Fatalf("Storage.UpdateFolder() error = %v", err)
+	}
+	if f.Description != description || f.MaxRevisions != 0 || f.Version <= before.Version {
+		t.Errorf("Storage.UpdateFolder() = %+v", f)
+	}
+	if !f.ModifiedAt.After(before.ModifiedAt) || !f.CreatedAt.Equal(before.CreatedAt) {
+		t.Errorf("Storage.UpdateFolder() ModifiedAt = %v, CreatedAt = %v, created %v", f.ModifiedAt, f.CreatedAt, before.CreatedAt)
+	}
+
+	// Only the fields given change
+	limit := 2
+	if f, err = s.UpdateFolder("alice", "alice", "docs", FolderUpdate{MaxRevisions: &limit}, 0); err != nil || f.Description != description || f.MaxRevisions != 2 {
+		t.Errorf("Storage.UpdateFolder() = %+v, %v", f, err)
+	}
+
+	fileDescription := "Meeting notes"
+	fl, err := s.UpdateFile("bob", "alice", "docs", "notes.txt", FileUpdate{Description: &fileDescription}, 0)
+	if err != nil || fl.Description != fileDescription {
+		t.Errorf("Storage.UpdateFile() = %+v, %v", fl, err)
+	}
+	if !fl.ModifiedAt.After(fl.CreatedAt) {
+		t.Errorf("Storage.UpdateFile() ModifiedAt = %v, not after %v", fl.ModifiedAt, fl.CreatedAt)
+	}
+
+	// Modified files sort first, newest first
+	_ = s.CreateFile("alice", "alice", "docs", "todo.txt", "")
+	time.Sleep(10 * time.Millisecond)
+	_, _ = s.WriteFile("alice", "alice", "docs", "notes.txt", []byte("agenda"))
+	files, _ := s.ListFiles("alice", "alice", "docs", SortSpec{{Field: SortModified, Desc: true}}, ListFilter{})
+	if len(files) != 2 || files[0].Name != "notes.txt" {
+		t.Errorf("Storage.ListFiles() by modification = %v", files)
+	}
+}
+
+func TestStorage_FindByTags(t *testing.T) {
+	s := NewStorage()
+	_ = s.AddUser("alice")
+	_ = s.AddUser("bob")
+	_ = s.CreateFolder("alice", "alice", "apollo", "")
+	_ = s.CreateFolder("alice", "alice", "gemini", "")
+	_ = s.CreateFile("alice", "alice", "apollo", "plan.txt", "")
+	_ = s.CreateFile("alice", "alice", "apollo", "budget.txt", "")
+	_ = s.CreateFile("alice", "alice", "gemini", "plan.txt", "")
+	_ = s.ShareFile("alice", "alice", "gemini", "plan.txt", "bob", acl.Read)
+
+	_, _ = s.UpdateFolder("alice", "alice", "apollo", FolderUpdate{SetTags: tag.Tags{"project": "apollo", "env": "prod"}}, 0)
+	_, _ = s.UpdateFile("alice", "alice", "apollo", "plan.txt", FileUpdate{SetTags: tag.Tags{"project": "apollo"}}, 0)
+	_, _ = s.UpdateFile("alice", "alice", "gemini", "plan.txt", FileUpdate{SetTags: tag.Tags{"project": "gemini", "env": "dev"}}, 0)
+	if _, err := s.UpdateFile("alice", "alice", "apollo", "budget.txt", FileUpdate{SetTags: tag.Tags{"bad key": "x"}}, 0); err == nil {
+		t.Errorf("Storage.UpdateFile() with an invalid tag succeeded")
+	}
+
+	fl, err := s.UpdateFile("alice", "alice", "apollo", "plan.txt", FileUpdate{SetTags: tag.Tags{"env": "dev"}, RemoveTags: []string{"project"}}, 0)
+	if err != nil || !reflect.DeepEqual(fl.Tags, tag.Tags{"env": "dev"}) {
+		t.Errorf("Storage.UpdateFile() = %v, %v", fl.Tags, err)
+	}
+
+	paths := func(actor, selector string) []string {
+		t.Helper()
+		sel, err := tag.ParseSelector(selector)
+		if err != nil {
+			t.Fatalf("ParseSelector(%q) error = %v", selector, err)
+		}
+		matches, err := s.FindByTags(actor, "alice", sel)
+		if err != nil {
+			t.Fatalf("Storage.FindByTags(%q) error = %v", selector, err)
+		}
+		var got []string
+		for _, m := range matches {
+			got = append(got, m.Path())
+		}
+		return got
+	}
+
+	tests := []struct {
+		actor    string
+		selector string
+		want     []string
+	}{
+		{"alice", "env=dev", []string{"apollo/plan.txt", "gemini/plan.txt"}},
+		{"alice", "project", []string{"apollo", "gemini/plan.txt"}},
+		{"alice", "project!=gemini,env", []string{"apollo", "apollo/plan.txt"}},
+		{"alice", "!env", []string{"apollo/budget.txt", "gemini"}},
+		{"bob", "env", []string{"gemini/plan.txt"}},
+	}
+	for _, tt := range tests {
+		if got := paths(tt.actor, tt.selector); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Storage.FindByTags(%q) by %s = %v, want %v", tt.selector, tt.actor, got, tt.want)
+		}
+	}
+
+	// Tags count against the byte quota
+	_ = s.SetQuota("alice", "alice", user.Quota{MaxBytes: 30})
+	if _, err := s.UpdateFolder("alice", "alice", "gemini", FolderUpdate{SetTags: tag.Tags{"owner": "a-very-long-team-name"}}, 0); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Storage.UpdateFolder() over quota error = %v", err)
+	}
+}
+
+func TestStorage_Search(t *testing.T) {
+	s := NewStorage()
+	_ = s.AddUser("alice")
+	_ = s.AddUser("bob")
+	_ = s.CreateFolder("alice", "alice", "apollo", "Apollo launch plans")
+	_ = s.CreateFolder("alice", "alice", "private", "")
+	_ = s.CreateFile("alice", "alice", "apollo", "plan.txt", "The launch plan")
+	_ = s.CreateFile("alice", "alice", "apollo", "notes.txt", "")
+	_ = s.CreateFile("alice", "alice", "private", "diary.txt", "Launch day")
+	_, _ = s.WriteFile("alice", "alice", "apollo", "notes.txt", []byte("Launch plan review: the launch slipped, launch again"))
+	_ = s.ShareFolder("alice", "alice", "apollo", "bob", acl.Read)
+
+	paths := func(actor, query string) []string {
+		t.Helper()
+		q, err := search.ParseQuery(query)
+		if err != nil {
+			t.Fatalf("ParseQuery(%q) error = %v", query, err)
+		}
+		results, err := s.Search(actor, "alice", q)
+		if err != nil {
+			t.Fatalf("Storage.Search(%q) error = %v", query, err)
+		}
+		var got []string
+		for _, r := range results {
+			got = append(got, r.Path())
+		}
+		return got
+	}
+
+	tests := []struct {
+		actor string
+		query string
+		want  []string
+	}{
+		{"alice", "launch", []string{"apollo/notes.txt", "apollo", "apollo/plan.txt", "private/diary.txt"}},
+		{"alice", `"launch plan"`, []string{"apollo/notes.txt", "apollo/plan.txt"}},
+		{"alice", "LAUNCH day", []string{"private/diary.txt"}},
+		{"bob", "launch", []string{"apollo/notes.txt", "apollo", "apollo/plan.txt"}},
+	}
+	for _, tt := range tests {
+		if got := paths(tt.actor, tt.query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Storage.Search(%q) by %s = %v, want %v", tt.query, tt.actor, got, tt.want)
+		}
+	}
+
+	// The index follows updates and deletions, and ignores rolled back transactions
+	_, _ = s.UpdateFileDescription("alice", "alice", "apollo", "plan.txt", "Budget", 0)
+	_ = s.DeleteFolder("alice", "alice", "private")
+	_ = s.Tx(func(tx *Tx) error {
+		_ = tx.CreateFile("alice", "alice", "apollo", "launch.txt", "Launch checklist")
+		return errors.New("abort")
+	})
+	if got := paths("alice", "launch"); !reflect.DeepEqual(got, []string{"apollo/notes.txt", "apollo"}) {
+		t.Errorf("Storage.Search() after changes = %v", got)
+	}
+	if got := paths("alice", "budget"); !reflect.DeepEqual(got, []string{"apollo/plan.txt"}) {
+		t.Errorf("Storage.Search() for a new description = %v", got)
+	}
+
+	// Restoring from the trash indexes the folder and its files again
+	items, _ := s.ListTrash("alice", "alice")
+	_, _ = s.RestoreFromTrash("alice", "alice", items[0].ID)
+	if got := paths("alice", "day"); !reflect.DeepEqual(got, []string{"private/diary.txt"}) {
+		t.Errorf("Storage.Search() after restoring = %v", got)
+	}
+
+	// Folder updates keep their files indexed, and snapshot restores index them again
+	_, _ = s.CreateSnapshot("alice", "alice", "before")
+	_, _ = s.UpdateFolderDescription("alice", "alice", "apollo", "Moon", 0)
+	_ = s.DeleteFile("alice", "alice", "apollo", "notes.txt")
+	if got := paths("alice", "budget"); !reflect.DeepEqual(got, []string{"apollo/plan.txt"}) {
+		t.Errorf("Storage.Search() after a folder update = %v", got)
+	}
+	_ = s.RestoreSnapshot("alice", "alice", "before")
+	if got := paths("alice", "launch"); !reflect.DeepEqual(got, []string{"apollo/notes.txt", "apollo", "private/diary.txt"}) {
+		t.Errorf("Storage.Search() after restoring a snapshot = %v", got)
+	}
+}
+
+func TestStorage_SearchNamesWithSlashes(t *testing.T) {
+	policy := naming.DefaultPolicy()
+	policy.Folder.Pattern = `^[\p{L}\p{N}/]+$`
+	policy.File.Pattern = `^[\p{L}\p{N}/.]+$`
+	if err := naming.Set(policy); err != nil {
+		t.Fatal(err)
+	}
+	defer naming.Set(naming.DefaultPolicy())
+
+	s := NewStorage()
+	_ = s.AddUser("alice")
+	_ = s.CreateFolder("alice", "alice", "a", "")
+	_ = s.CreateFolder("alice", "alice", "a/b", "")
+	_ = s.CreateFile("alice", "alice", "a", "b/c.txt", "Outer report")
+	_ = s.CreateFile("alice", "alice", "a/b", "c.txt", "Inner report")
+
+	reports := func() []string {
+		t.Helper()
+		results, err := s.Search("alice", "alice", search.Query{Phrases: [][]string{{"report"}}})
+		if err != nil {
+			t.Fatalf("Storage.Search() error = %v", err)
+		}
+		var got []string
+		for _, r := range results {
+			got = append(got, r.Folder.Name+" "+r.File.Name+" "+r.File.Description)
+		}
+		sort.Strings(got)
+		return got
+	}
+
+	if got, want := reports(), []string{"a b/c.txt Outer report", "a/b c.txt Inner report"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Storage.Search() = %q, want %q", got, want)
+	}
+	_ = s.DeleteFolder("alice", "alice", "a")
+	if got, want := reports(), []string{"a/b c.txt Inner report"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Storage.Search() after deleting the outer folder = %q, want %q", got, want)
+	}
+}
+
+func TestStorage_ListFilter(t *testing.T) {
+	s := NewStorage()
+	_ = s.AddUser("alice")
+	_ = s.AddUser("bob")
+	_ = s.CreateFolder("alice", "alice", "reports", "Quarterly REPORTS")
+	_ = s.CreateFolder("alice", "alice", "Recipes", "Family recipes")
+	_ = s.CreateFolder("alice", "alice", "photos", "Holiday photos")
+	_ = s.CreateFolder("alice", "alice", "re-2024", "")
+	recipes, _ := s.GetFolder("alice", "alice", "Recipes")
+	photos, _ := s.GetFolder("alice", "alice", "photos")
+
+	names := func(filter ListFilter) []string {
+		t.Helper()
+		folders, err := s.ListFolders("alice", "alice", nil, filter)
+		if err != nil {
+			t.Fatalf("Storage.ListFolders() error = %v", err)
+		}
+		var got []string
+		for _, f := range folders {
+			got = append(got, f.Name)
+		}
+		return got
+	}
+
+	tests := []struct {
+		name   string
+		filter ListFilter
+		want   []string
+	}{
+		{"No filter", ListFilter{}, []string{"photos", "re-2024", "Recipes", "reports"}},
+		{"Prefix", ListFilter{Prefix: "RE"}, []string{"re-2024", "Recipes", "reports"}},
+		{"Missing prefix", ListFilter{Prefix: "x"}, nil},
+		{"Regex", ListFilter{Match: regexp.MustCompile(`^[a-z]+$`)}, []string{"photos", "reports"}},
+		{"Description", ListFilter{Description: "reports"}, []string{"reports"}},
+		{"Created range", ListFilter{Since: recipes.CreatedAt, Until: photos.CreatedAt}, []string{"Recipes"}},
+		{"Limit after sorting", ListFilter{Prefix: "re", Limit: 2}, []string{"re-2024", "Recipes"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := names(tt.filter); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Storage.ListFolders() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := s.ListFolders("alice", "alice", nil, ListFilter{Limit: -1}); err == nil {
+		t.Errorf("Storage.ListFolders() with a negative limit succeeded")
+	}
+
+	// Filtering out every file a reader may see still lists nothing rather than denying access
+	_ = s.CreateFile("alice", "alice", "reports", "q1.txt", "")
+	_ = s.ShareFile("alice", "alice", "reports", "q1.txt", "bob", acl.Read)
+	files, err := s.ListFiles("bob", "alice", "reports", nil, ListFilter{Prefix: "q2"})
+	if err != nil || len(files) != 0 {
+		t.Errorf("Storage.ListFiles() filtered = %v, %v", files, err)
+	}
+	if _, err := s.ListFiles("bob", "alice", "photos", nil, ListFilter{Prefix: "q2"}); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Storage.ListFiles() of an unreadable folder error = %v", err)
+	}
+}
+
+func TestStorage_SortSpec(t *testing.T) {
+	s := NewStorage()
+	_ = s.AddUser("alice")
+	_ = s.CreateFolder("alice", "alice", "b", "Same")
+	_ = s.CreateFolder("alice", "alice", "a", "same")
+	_ = s.CreateFolder("alice", "alice", "c", "Other")
+	_ = s.CreateFile("alice", "alice", "c", "one.txt", "")
+	_ = s.CreateFile("alice", "alice", "c", "two.txt", "")
+	_ = s.CreateFile("alice", "alice", "a", "big.txt", "")
+	_, _ = s.WriteFile("alice", "alice", "a", "big.txt", []byte("a large amount of text"))
+
+	names := func(spec string) []string {
+		t.Helper()
+		sortSpec, err := ParseSortSpec(spec)
+		if err != nil {
+			t.Fatalf("ParseSortSpec(%q) error = %v", spec, err)
+		}
+		folders, err := s.ListFolders("alice", "alice", sortSpec, ListFilter{})
+		if err != nil {
+			t.Fatalf("Storage.ListFolders(%q) error = %v", spec, err)
+		}
+		var got []string
+		for _, f := range folders {
+			got = append(got, f.Name)
+		}
+		return got
+	}
+
+	tests := []struct {
+		spec string
+		want []string
+	}{
+		{"name:desc", []string{"c", "b", "a"}},
+		{"created", []string{"b", "a", "c"}},
+		// Descriptions equal but for case fall back to their case, then to the name
+		{"description", []string{"c", "b", "a"}},
+		{"files:desc,name", []string{"c", "a", "b"}},
+		{"size:desc", []string{"a", "c", "b"}},
+		{"modified:desc, name:asc", []string{"a", "c", "b"}},
+	}
+	for _, tt := range tests {
+		if got := names(tt.spec); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Storage.ListFolders(%q) = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+
+	for _, spec := range []string{"owner", "name:up", ""} {
+		if _, err := ParseSortSpec(spec); err == nil {
+			t.Errorf("ParseSortSpec(%q) succeeded", spec)
+		}
+	}
+	if _, err := s.ListFiles("alice", "alice", "c", SortSpec{{Field: SortFiles}}, ListFilter{}); err == nil {
+		t.Errorf("Storage.ListFiles() sorted by number of files succeeded")
+	}
+	if spec, _ := ParseSortSpec("created:DESC,name"); spec.String() != "created:desc,name:asc" {
+		t.Errorf("SortSpec.String() = %q", spec.String())
+	}
+}
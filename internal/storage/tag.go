@@ -0,0 +1,82 @@
+package storage
+
+import (
+    "sort"
+
+    "github.com/fatbrother/virtual-file-system/internal/acl"
+    "github.com/fatbrother/virtual-file-system/internal/file"
+    "github.com/fatbrother/virtual-file-system/internal/folder"
+    "github.com/fatbrother/virtual-file-system/internal/tag"
+)
+
+// TagMatch is a folder or file found by FindByTags. File is nil when the
+// folder itself matched.
+type TagMatch struct {
+    Folder folder.Folder
+    File   *file.File
+}
+
+// Path returns the folder or file path within its owner's namespace
+func (m TagMatch) Path() string {
+    if m.File == nil {
+        return m.Folder.Name
+    }
+    return m.Folder.Name + "/" + m.File.Name
+}
+
+// Tags returns the tags of the folder or file that matched
+func (m TagMatch) Tags() tag.Tags {
+    if m.File == nil {
+        return m.Folder.Tags
+    }
+    return m.File.Tags
+}
+
+// FindByTags returns the folders and files in a user's namespace whose tags
+// match the selector, among those the actor can read. Matches are sorted by
+// folder name, each folder coming before its files.
+func (s *Storage) FindByTags(actor, username string, selector tag.Selector) (_ []TagMatch, err error) {
+    unlock := s.rlockUser(username)
+    defer unlock()
+    defer s.record(actor, "FindByTags", username, &err)
+
+    actorUser, err := s.getUserNoLock(actor)
+    if err != nil {
+        return nil, err
+    }
+
+    u, err := s.getUserNoLock(username)
+    if err != nil {
+        return nil, err
+    }
+
+    principals := s.principalsNoLock(actorUser)
+    var matches []TagMatch
+    for _, value := range u.Folders.PrefixSearch("") {
+        f, ok := value.(*folder.Folder)
+        if !ok {
+            continue
+        }
+        if f.ACL.AllowsAny(principals, acl.Read) && selector.Matches(f.Tags) {
+            matches = append(matches, TagMatch{Folder: detachedFolder(f)})
+        }
+        for _, fileValue := range f.Files.PrefixSearch("") {
+            if fl, ok := fileValue.(*file.File); ok && canAccessFile(principals, f, fl, acl.Read) && selector.Matches(fl.Tags) {
+                c := detachedFile(fl)
+                matches = append(matches, TagMatch{Folder: detachedFolder(f), File: &c})
+            }
+        }
+    }
+
+    sort.Slice(matches, func(i, j int) bool {
+        a, b := matches[i], matches[j]
+        if a.Folder.Key() != b.Folder.Key() {
+            return a.Folder.Key() < b.Folder.Key()
+        }
+        if a.File == nil || b.File == nil {
+            return a.File == nil && b.File != nil
+        }
+        return lessName(a.File.Key(), a.File.Name, b.File.Key(), b.File.Name)
+    })
+    return matches, nil
+}
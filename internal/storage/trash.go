@@ -0,0 +1,139 @@
+package storage
+
+import (
+    "errors"
+    "strconv"
+    "time"
+
+    "github.com/fatbrother/virtual-file-system/internal/naming"
+    "github.com/fatbrother/virtual-file-system/internal/trash"
+    "github.com/fatbrother/virtual-file-system/internal/user"
+)
+
+// DefaultTrashRetention is how long deleted items are kept unless changed with SetTrashRetention
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// SetTrashRetention changes how long deleted items are kept before they are
+// purged. A retention of 0 keeps them until the trash is emptied.
+func (s *Storage) SetTrashRetention(retention time.Duration) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    s.trashRetention = retention
+    s.record("", "SetTrashRetention", retention.String(), nil)
+}
+
+// PurgeTrash permanently deletes every trashed item older than the retention
+// period and returns how many were purged
+func (s *Storage) PurgeTrash() int {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+
+    n := 0
+    for _, u := range s.usersNoLock() {
+        l := s.userLock(u.Key())
+        l.Lock()
+        n += s.purgeExpiredNoLock(u)
+        l.Unlock()
+    }
+    s.record("", "PurgeTrash", strconv.Itoa(n)+" items", nil)
+    return n
+}
+
+// ListTrash returns the items in a user's trash, oldest first. Users may view
+// their own trash; admins may view anyone's.
+func (s *Storage) ListTrash(actor, username string) (_ []trash.Item, err error) {
+    unlock := s.lockUser(username)
+    defer unlock()
+    defer s.record(actor, "ListTrash", username, &err)
+
+    u, err := s.getManagedUserNoLock(actor, username, "view the trash of")
+    if err != nil {
+        return nil, err
+    }
+
+    s.purgeExpiredNoLock(u)
+    results := u.Trash.Items()
+    items := make([]trash.Item, 0, len(results))
+    for _, item := range results {
+        items = append(items, detachedItem(item))
+    }
+    return items, nil
+}
+
+// RestoreFromTrash moves a trashed item back to its original location and
+// returns it. A file can only be restored while its folder exists.
+func (s *Storage) RestoreFromTrash(actor, username, id string) (_ trash.Item, err error) {
+    unlock := s.lockUser(username)
+    defer unlock()
+    defer s.record(actor, "RestoreFromTrash", username+":"+id, &err)
+
+    u, err := s.getManagedUserNoLock(actor, username, "restore from the trash of")
+    if err != nil {
+        return trash.Item{}, err
+    }
+    actorUser, err := s.getUserNoLock(actor)
+    if err != nil {
+        return trash.Item{}, err
+    }
+
+    s.purgeExpiredNoLock(u)
+    item, err := u.Trash.Get(id)
+    if err != nil {
+        return trash.Item{}, err
+    }
+
+    if item.Folder != nil {
+        folderKey := item.Folder.Key()
+        if _, exists := u.Folders.Search(folderKey); exists {
+            return trash.Item{}, errors.New("The " + item.Folder.Name + " has already existed.")
+        }
+        // Trashed items still count toward bytes, but not toward folders or files
+        if err := checkQuotaNoLock(u, 1, len(item.Folder.Files.PrefixSearch("")), 0); err != nil {
+            return trash.Item{}, err
+        }
+        u.Folders.Insert(folderKey, item.Folder)
+        u.Version = s.nextVersion()
+        s.publishNoLock(EventCreated, actorUser, u, item.Folder, nil)
+    } else {
+        folder, err := s.getFolderNoLock(u, item.FolderName)
+        if err != nil {
+            return trash.Item{}, err
+        }
+        fileKey := naming.Key(item.File.Name)
+        if _, exists := folder.Files.Search(fileKey); exists {
+            return trash.Item{}, errors.New("The " + item.File.Name + " has already existed.")
+        }
+        if err := checkQuotaNoLock(u, 0, 1, 0); err != nil {
+            return trash.Item{}, err
+        }
+        folder = writableFolderNoLock(u, folder)
+        folder.Files.Insert(fileKey, item.File)
+        s.touchFolder(folder)
+        s.publishNoLock(EventCreated, actorUser, u, folder, item.File)
+    }
+
+    u.Trash.Remove(id)
+    return detachedItem(item), nil
+}
+
+// EmptyTrash permanently deletes everything in a user's trash and returns how many items were deleted
+func (s *Storage) EmptyTrash(actor, username string) (_ int, err error) {
+    unlock := s.lockUser(username)
+    defer unlock()
+    defer s.record(actor, "EmptyTrash", username, &err)
+
+    u, err := s.getManagedUserNoLock(actor, username, "empty the trash of")
+    if err != nil {
+        return 0, err
+    }
+    return u.Trash.Empty(), nil
+}
+
+// purgeExpiredNoLock permanently deletes a user's trashed items older than the retention period
+func (s *Storage) purgeExpiredNoLock(u *user.User) int {
+    if s.trashRetention <= 0 {
+        return 0
+    }
+    return u.Trash.Purge(time.Now().Add(-s.trashRetention))
+}
@@ -0,0 +1,180 @@
+package storage
+
+import (
+    "sync"
+    "sync/atomic"
+
+    "github.com/fatbrother/virtual-file-system/internal/audit"
+    "github.com/fatbrother/virtual-file-system/internal/file"
+    "github.com/fatbrother/virtual-file-system/internal/folder"
+    "github.com/fatbrother/virtual-file-system/internal/group"
+    "github.com/fatbrother/virtual-file-system/internal/user"
+    "github.com/fatbrother/virtual-file-system/pkg/trie"
+)
+
+// Tx is a batch of operations that take effect together. It offers every
+// Storage operation, applied to a private copy of the storage.
+type Tx struct {
+    *Storage
+}
+
+// Tx runs fn with the storage locked and applies everything fn did through
+// tx at once if fn returns nil. If fn returns an error or panics, none of it
+// takes effect. fn must use tx rather than s, which stays locked until fn returns.
+// Watchers are told about the changes once they are applied. The operations
+// are audited when the transaction ends, as rolled back if it did not commit.
+func (s *Storage) Tx(fn func(tx *Tx) error) (err error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    defer s.record("", "Tx", "", &err)
+
+    shadow := s.shadowNoLock()
+    committed := false
+    defer func() {
+        for _, r := range shadow.pendingAudit {
+            if !committed && r.result == audit.ResultOK {
+                r.result = audit.ResultRolledBack
+            }
+            s.appendAudit(r)
+        }
+    }()
+    if err := fn(&Tx{Storage: shadow}); err != nil {
+        return err
+    }
+
+    s.users = shadow.users
+    s.groups = shadow.groups
+    s.trashRetention = shadow.trashRetention
+    atomic.StoreUint64(&s.version, shadow.version)
+    for _, p := range shadow.pending {
+        s.deliverNoLock(p)
+    }
+    for _, hook := range shadow.pendingHooks {
+        s.afterNoLock(hook)
+    }
+    committed = true
+    return nil
+}
+
+// shadowNoLock returns a copy of the storage for a transaction. Users are
+// only copied when the transaction first uses them, so what a transaction
+// costs depends on the namespaces it touches rather than on the whole storage.
+func (s *Storage) shadowNoLock() *Storage {
+    users := trie.NewTrie()
+    for key, value := range s.users.PrefixSearch("") {
+        users.Insert(key, value)
+    }
+
+    groups := trie.NewTrie()
+    for key, value := range s.groups.PrefixSearch("") {
+        if g, ok := value.(*group.Group); ok {
+            groups.Insert(key, g.Clone())
+        }
+    }
+
+    return &Storage{
+        users:          users,
+        groups:         groups,
+        trashRetention: s.trashRetention,
+        version:        atomic.LoadUint64(&s.version),
+        audit:          s.audit,
+        hooks:          s.hooks,
+        index:          s.index,
+        inTx:           true,
+        cloner:         newCloner(),
+    }
+}
+
+// ownUserNoLock returns u, or inside a transaction the transaction's copy
+// of u, which it makes when the transaction first uses u. The caller holds
+// s.cloner.mu inside a transaction.
+func (s *Storage) ownUserNoLock(u *user.User) *user.User {
+    if s.cloner == nil {
+        return u
+    }
+    if copied, ok := s.cloner.users[u]; ok {
+        return copied
+    }
+    copied := s.cloner.user(u)
+    s.cloner.users[copied] = copied
+    s.users.Insert(u.Key(), copied)
+    return copied
+}
+
+// usersNoLock returns every user, for operations that change users other
+// than the ones they look up. Inside a transaction they are all copied.
+func (s *Storage) usersNoLock() []*user.User {
+    if s.cloner != nil {
+        s.cloner.mu.Lock()
+        defer s.cloner.mu.Unlock()
+    }
+
+    var users []*user.User
+    for _, value := range s.users.PrefixSearch("") {
+        if u, ok := value.(*user.User); ok {
+            users = append(users, s.ownUserNoLock(u))
+        }
+    }
+    return users
+}
+
+// cloner copies users, folders and files at most once, so copies keep the
+// sharing of the originals between the live tree, the trash and snapshots
+type cloner struct {
+    // mu guards the copies and the transaction's users, which operations
+    // holding the transaction's mu shared may copy at the same time
+    mu      sync.Mutex
+    users   map[*user.User]*user.User
+    folders map[*folder.Folder]*folder.Folder
+    files   map[*file.File]*file.File
+}
+
+func newCloner() *cloner {
+    return &cloner{
+        users:   make(map[*user.User]*user.User),
+        folders: make(map[*folder.Folder]*folder.Folder),
+        files:   make(map[*file.File]*file.File),
+    }
+}
+
+func (c *cloner) user(u *user.User) *user.User {
+    if copied, ok := c.users[u]; ok {
+        return copied
+    }
+    copied := u.Clone()
+    copied.Folders = trie.NewTrie()
+    for key, value := range u.Folders.PrefixSearch("") {
+        if f, ok := value.(*folder.Folder); ok {
+            copied.Folders.Insert(key, c.folder(f))
+        }
+    }
+    copied.Trash = u.Trash.Clone(c.folder, c.file)
+    for key, snap := range copied.Snapshots {
+        copied.Snapshots[key] = snap.Clone(c.folder)
+    }
+    c.users[u] = copied
+    return copied
+}
+
+func (c *cloner) folder(f *folder.Folder) *folder.Folder {
+    if copied, ok := c.folders[f]; ok {
+        return copied
+    }
+    copied := f.Clone()
+    for key, value := range copied.Files.PrefixSearch("") {
+        if fl, ok := value.(*file.File); ok {
+            copied.Files.Insert(key, c.file(fl))
+        }
+    }
+    c.folders[f] = copied
+    return copied
+}
+
+func (c *cloner) file(fl *file.File) *file.File {
+    if copied, ok := c.files[fl]; ok {
+        return copied
+    }
+    copied := fl.Clone()
+    c.files[fl] = copied
+    return copied
+}
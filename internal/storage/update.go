@@ -0,0 +1,184 @@
+package storage
+
+import (
+    "errors"
+
+    "github.com/fatbrother/virtual-file-system/internal/acl"
+    "github.com/fatbrother/virtual-file-system/internal/file"
+    "github.com/fatbrother/virtual-file-system/internal/folder"
+    "github.com/fatbrother/virtual-file-system/internal/tag"
+)
+
+// FolderUpdate lists the changes UpdateFolder makes. Nil fields are left unchanged.
+type FolderUpdate struct {
+    Description *string
+    // MaxRevisions is the new revision limit, 0 keeping all revisions
+    MaxRevisions *int
+    // SetTags adds or replaces tags; RemoveTags then removes tags by key
+    SetTags    tag.Tags
+    RemoveTags []string
+}
+
+// empty reports whether the update changes nothing
+func (update FolderUpdate) empty() bool {
+    return update.Description == nil && update.MaxRevisions == nil && len(update.SetTags) == 0 && len(update.RemoveTags) == 0
+}
+
+// apply makes the changes to f
+func (update FolderUpdate) apply(f *folder.Folder) {
+    if update.Description != nil {
+        f.Description = *update.Description
+    }
+    if update.MaxRevisions != nil {
+        f.MaxRevisions = *update.MaxRevisions
+    }
+    if len(update.SetTags) > 0 || len(update.RemoveTags) > 0 {
+        f.Tags = f.Tags.With(update.SetTags, update.RemoveTags)
+    }
+}
+
+// FileUpdate lists the changes UpdateFile makes. Nil fields are left unchanged.
+type FileUpdate struct {
+    Description *string
+    // SetTags adds or replaces tags; RemoveTags then removes tags by key
+    SetTags    tag.Tags
+    RemoveTags []string
+}
+
+// empty reports whether the update changes nothing
+func (update FileUpdate) empty() bool {
+    return update.Description == nil && len(update.SetTags) == 0 && len(update.RemoveTags) == 0
+}
+
+// apply makes the changes to fl
+func (update FileUpdate) apply(fl *file.File) {
+    if update.Description != nil {
+        fl.Description = *update.Description
+    }
+    if len(update.SetTags) > 0 || len(update.RemoveTags) > 0 {
+        fl.Tags = fl.Tags.With(update.SetTags, update.RemoveTags)
+    }
+}
+
+// UpdateFolder changes a folder's description, revision limit and tags in
+// place and returns the updated folder. Only the owner may do so, and unless
+// ifVersion is 0 the folder must still be at that version. Lowering the
+// revision limit prunes the older revisions of the folder's files.
+func (s *Storage) UpdateFolder(actor, username, folderName string, update FolderUpdate, ifVersion uint64) (_ folder.Folder, err error) {
+    unlock := s.lockUser(username)
+    defer unlock()
+    defer s.record(actor, "UpdateFolder", username+"/"+folderName, &err)
+
+    if update.empty() {
+        return folder.Folder{}, errors.New("Nothing to update.")
+    }
+    if update.MaxRevisions != nil && *update.MaxRevisions < 0 {
+        return folder.Folder{}, errors.New("The revision limit must not be negative.")
+    }
+    if err := update.SetTags.Check(); err != nil {
+        return folder.Folder{}, err
+    }
+
+    actorUser, err := s.getUserNoLock(actor)
+    if err != nil {
+        return folder.Folder{}, err
+    }
+    u, err := s.getUserNoLock(username)
+    if err != nil {
+        return folder.Folder{}, err
+    }
+    f, err := s.getFolderNoLock(u, folderName)
+    if err != nil {
+        return folder.Folder{}, err
+    }
+    if f.ACL.Owner != actorUser.Key() {
+        return folder.Folder{}, &PermissionError{Actor: actor, Action: "update", Target: username + "/" + folderName}
+    }
+    if err := checkVersion(username+"/"+folderName, ifVersion, f.Version); err != nil {
+        return folder.Folder{}, err
+    }
+    next := *f
+    update.apply(&next)
+    if grow := next.Size() - f.Size(); grow > 0 {
+        if err := checkQuotaNoLock(u, 0, 0, grow); err != nil {
+            return folder.Folder{}, err
+        }
+    }
+    hook := &HookContext{Op: OpUpdateFolder, Actor: actorUser, User: u, Folder: f, FolderUpdate: &update}
+    if err := s.beforeNoLock(hook); err != nil {
+        return folder.Folder{}, err
+    }
+
+    f = writableFolderNoLock(u, f)
+    update.apply(f)
+    s.touchFolder(f)
+    s.publishNoLock(EventUpdated, actorUser, u, f, nil)
+    if limit := f.MaxRevisions; update.MaxRevisions != nil && limit > 0 {
+        for _, value := range f.Files.PrefixSearch("") {
+            if fl, ok := value.(*file.File); ok && len(fl.Revisions()) > limit {
+                _, fl = writableFileNoLock(u, f, fl)
+                fl.Prune(limit)
+                s.touchFile(fl)
+                s.publishNoLock(EventUpdated, actorUser, u, f, fl)
+            }
+        }
+    }
+    hook.Folder = f
+    s.afterNoLock(hook)
+    return detachedFolder(f), nil
+}
+
+// UpdateFile changes a file's description and tags in place and returns the
+// updated file. The actor needs write access, and unless ifVersion is 0 the
+// file must still be at that version.
+func (s *Storage) UpdateFile(actor, username, folderName, fileName string, update FileUpdate, ifVersion uint64) (_ file.File, err error) {
+    unlock := s.lockUser(username)
+    defer unlock()
+    defer s.record(actor, "UpdateFile", username+"/"+folderName+"/"+fileName, &err)
+
+    if update.empty() {
+        return file.File{}, errors.New("Nothing to update.")
+    }
+    if err := update.SetTags.Check(); err != nil {
+        return file.File{}, err
+    }
+
+    actorUser, u, f, fl, err := s.getFileForNoLock(actor, username, folderName, fileName, acl.Write, "update")
+    if err != nil {
+        return file.File{}, err
+    }
+    if err := checkVersion(username+"/"+folderName+"/"+fileName, ifVersion, fl.Version); err != nil {
+        return file.File{}, err
+    }
+    next := *fl
+    update.apply(&next)
+    if grow := next.Size() - fl.Size(); grow > 0 {
+        if err := checkQuotaNoLock(u, 0, 0, grow); err != nil {
+            return file.File{}, err
+        }
+    }
+    hook := &HookContext{Op: OpUpdateFile, Actor: actorUser, User: u, Folder: f, File: fl, FileUpdate: &update}
+    if err := s.beforeNoLock(hook); err != nil {
+        return file.File{}, err
+    }
+
+    f, fl = writableFileNoLock(u, f, fl)
+    update.apply(fl)
+    s.touchFile(fl)
+    s.publishNoLock(EventUpdated, actorUser, u, f, fl)
+    hook.Folder, hook.File = f, fl
+    s.afterNoLock(hook)
+    return detachedFile(fl), nil
+}
+
+// UpdateFolderDescription replaces a folder's description and returns its new version
+func (s *Storage) UpdateFolderDescription(actor, username, folderName, description string, ifVersion uint64) (uint64, error) {
+    f, err := s.UpdateFolder(actor, username, folderName, FolderUpdate{Description: &description}, ifVersion)
+    return f.Version, err
+}
+
+// UpdateFileDescription replaces a file's description and returns its new version
+func (s *Storage) UpdateFileDescription(actor, username, folderName, fileName, description string, ifVersion uint64) (uint64, error) {
+    fl, err := s.UpdateFile(actor, username, folderName, fileName, FileUpdate{Description: &description}, ifVersion)
+    return fl.Version, err
+}
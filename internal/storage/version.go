@@ -0,0 +1,70 @@
+package storage
+
+import (
+    "github.com/fatbrother/virtual-file-system/internal/acl"
+    "github.com/fatbrother/virtual-file-system/internal/file"
+    "github.com/fatbrother/virtual-file-system/internal/folder"
+)
+
+// GetFolder returns a copy of a folder the actor can read, including its current version, without its files
+func (s *Storage) GetFolder(actor, username, folderName string) (_ folder.Folder, err error) {
+    unlock := s.rlockUser(username)
+    defer unlock()
+    defer s.record(actor, "GetFolder", username+"/"+folderName, &err)
+
+    actorUser, err := s.getUserNoLock(actor)
+    if err != nil {
+        return folder.Folder{}, err
+    }
+    u, err := s.getUserNoLock(username)
+    if err != nil {
+        return folder.Folder{}, err
+    }
+    f, err := s.getFolderNoLock(u, folderName)
+    if err != nil {
+        return folder.Folder{}, err
+    }
+    if !f.ACL.AllowsAny(s.principalsNoLock(actorUser), acl.Read) {
+        return folder.Folder{}, &PermissionError{Actor: actor, Action: "read", Target: username + "/" + folderName}
+    }
+    return detachedFolder(f), nil
+}
+
+// GetFile returns a copy of a file the actor can read, including its current version
+func (s *Storage) GetFile(actor, username, folderName, fileName string) (_ file.File, err error) {
+    unlock := s.rlockUser(username)
+    defer unlock()
+    defer s.record(actor, "GetFile", username+"/"+folderName+"/"+fileName, &err)
+
+    _, _, _, fl, err := s.getFileForNoLock(actor, username, folderName, fileName, acl.Read, "read")
+    if err != nil {
+        return file.File{}, err
+    }
+    return detachedFile(fl), nil
+}
+
+// DeleteFolderIfVersion deletes a folder only if it is still at ifVersion
+func (s *Storage) DeleteFolderIfVersion(actor, username, folderName string, ifVersion uint64) (err error) {
+    unlock := s.lockUser(username)
+    defer unlock()
+    defer s.record(actor, "DeleteFolder", username+"/"+folderName, &err)
+
+    return s.deleteFolderNoLock(actor, username, folderName, ifVersion)
+}
+
+// DeleteFileIfVersion deletes a file only if it is still at ifVersion
+func (s *Storage) DeleteFileIfVersion(actor, username, folderName, fileName string, ifVersion uint64) (err error) {
+    unlock := s.lockUser(username)
+    defer unlock()
+    defer s.record(actor, "DeleteFile", username+"/"+folderName+"/"+fileName, &err)
+
+    return s.deleteFileNoLock(actor, username, folderName, fileName, ifVersion)
+}
+
+// checkVersion returns a ConflictError unless ifVersion is 0 or matches actual
+func checkVersion(target string, ifVersion, actual uint64) error {
+    if ifVersion != 0 && ifVersion != actual {
+        return &ConflictError{Target: target, Expected: ifVersion, Actual: actual}
+    }
+    return nil
+}
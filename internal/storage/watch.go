@@ -0,0 +1,216 @@
+package storage
+
+import (
+    "context"
+    "strings"
+    "time"
+
+    "github.com/fatbrother/virtual-file-system/internal/acl"
+    "github.com/fatbrother/virtual-file-system/internal/file"
+    "github.com/fatbrother/virtual-file-system/internal/folder"
+    "github.com/fatbrother/virtual-file-system/internal/naming"
+    "github.com/fatbrother/virtual-file-system/internal/user"
+)
+
+// watchBuffer is how many events a watcher may fall behind before events are dropped
+const watchBuffer = 64
+
+// EventKind is the kind of change an Event reports
+type EventKind int
+
+const (
+    // EventCreated reports a new folder or file, including one restored from the trash
+    EventCreated EventKind = iota + 1
+    // EventDeleted reports a folder or file that was removed
+    EventDeleted
+    // EventRenamed reports a folder or file that now has another name; OldName
+    // holds the previous one. No operation renames anything yet.
+    EventRenamed
+    // EventUpdated reports a change to a folder's or file's description, access or contents
+    EventUpdated
+    // EventOverflow reports that events were dropped because the watcher fell behind
+    EventOverflow
+)
+
+func (k EventKind) String() string {
+    switch k {
+    case EventCreated:
+        return "created"
+    case EventDeleted:
+        return "deleted"
+    case EventRenamed:
+        return "renamed"
+    case EventUpdated:
+        return "updated"
+    case EventOverflow:
+        return "overflow"
+    }
+    return "unknown"
+}
+
+// Event is a change to a folder or file. File is empty for changes to the folder itself.
+type Event struct {
+    Kind        EventKind
+    Time        time.Time
+    Actor       string
+    Username    string
+    Folder      string
+    File        string
+    OldName     string
+    Description string
+    Version     uint64
+}
+
+// Path returns where the change happened, as username/folder or username/folder/file
+func (e Event) Path() string {
+    path := e.Username + "/" + e.Folder
+    if e.File != "" {
+        path += "/" + e.File
+    }
+    return path
+}
+
+// Format prints the event details
+func (e Event) Format() string {
+    prefix := e.Time.Format(time.RFC3339) + " " + e.Kind.String()
+    switch e.Kind {
+    case EventOverflow:
+        return prefix + ": some events were dropped"
+    case EventRenamed:
+        return prefix + " " + e.Path() + " from " + e.OldName + " by " + e.Actor
+    }
+    return prefix + " " + e.Path() + " by " + e.Actor
+}
+
+// watcher receives the events of one namespace, limited to folders starting with prefix
+type watcher struct {
+    actor      string
+    userKey    string
+    prefix     string
+    ch         chan Event
+    overflowed bool
+}
+
+// pendingEvent is an event held back until its transaction commits, with
+// what is needed to decide who may see it. reindex is set when the files of
+// an updated folder changed without events of their own.
+type pendingEvent struct {
+    event   Event
+    folder  *folder.Folder
+    file    *file.File
+    reindex bool
+}
+
+// Watch returns a channel of the changes made to the folders of username
+// whose names start with folderPrefix, and to their files. Only changes to
+// what the actor can read are sent. The channel is closed once ctx is done.
+// A watcher that falls behind loses events and receives an EventOverflow.
+func (s *Storage) Watch(ctx context.Context, actor, username, folderPrefix string) (_ <-chan Event, err error) {
+    unlock := s.rlockUser(username)
+    defer unlock()
+    defer s.record(actor, "Watch", username+"/"+folderPrefix, &err)
+
+    actorUser, err := s.getUserNoLock(actor)
+    if err != nil {
+        return nil, err
+    }
+    u, err := s.getUserNoLock(username)
+    if err != nil {
+        return nil, err
+    }
+
+    w := &watcher{
+        actor:   actorUser.Key(),
+        userKey: u.Key(),
+        prefix:  naming.Key(folderPrefix),
+        // One more than the buffer so the overflow event always fits
+        ch: make(chan Event, watchBuffer+1),
+    }
+    s.watchMu.Lock()
+    if s.watchers == nil {
+        s.watchers = make(map[*watcher]struct{})
+    }
+    s.watchers[w] = struct{}{}
+    s.watchMu.Unlock()
+
+    go func() {
+        <-ctx.Done()
+        s.watchMu.Lock()
+        delete(s.watchers, w)
+        close(w.ch)
+        s.watchMu.Unlock()
+    }()
+    return w.ch, nil
+}
+
+// publishNoLock reports a change to folder f, or to file fl in it, made by
+// actor in the namespace of u. Inside a transaction the event waits for the commit.
+func (s *Storage) publishNoLock(kind EventKind, actor, u *user.User, f *folder.Folder, fl *file.File) {
+    s.deliverNoLock(newPendingEvent(kind, actor, u, f, fl))
+}
+
+// newPendingEvent returns the event reporting a change to folder f, or to
+// file fl in it
+func newPendingEvent(kind EventKind, actor, u *user.User, f *folder.Folder, fl *file.File) pendingEvent {
+    event := Event{
+        Kind:        kind,
+        Time:        time.Now(),
+        Actor:       actor.Username,
+        Username:    u.Username,
+        Folder:      f.Name,
+        Description: f.Description,
+        Version:     f.Version,
+    }
+    if fl != nil {
+        event.File = fl.Name
+        event.Description = fl.Description
+        event.Version = fl.Version
+    }
+    return pendingEvent{event: event, folder: f, file: fl}
+}
+
+// deliverNoLock indexes what an event is about and sends the event to every
+// watcher that may see it without blocking. The index has locks of its own,
+// so watchers are not held up by it.
+func (s *Storage) deliverNoLock(p pendingEvent) {
+    s.watchMu.Lock()
+    if s.inTx {
+        s.pending = append(s.pending, p)
+        s.watchMu.Unlock()
+        return
+    }
+    s.watchMu.Unlock()
+    s.index.update(p)
+
+    s.watchMu.Lock()
+    defer s.watchMu.Unlock()
+
+    userKey, folderKey := naming.Key(p.event.Username), naming.Key(p.event.Folder)
+    for w := range s.watchers {
+        if w.userKey != userKey || !strings.HasPrefix(folderKey, w.prefix) || !s.canSeeNoLock(w.actor, p) {
+            continue
+        }
+        if len(w.ch) >= watchBuffer {
+            if !w.overflowed {
+                w.ch <- Event{Kind: EventOverflow, Time: time.Now()}
+                w.overflowed = true
+            }
+            continue
+        }
+        w.ch <- p.event
+        w.overflowed = false
+    }
+}
+
+// canSeeNoLock reports whether actor may read what an event is about
+func (s *Storage) canSeeNoLock(actor string, p pendingEvent) bool {
+    actorUser, err := s.getUserNoLock(actor)
+    if err != nil {
+        return false
+    }
+    principals := s.principalsNoLock(actorUser)
+    if p.file != nil {
+        return canAccessFile(principals, p.folder, p.file, acl.Read)
+    }
+    return p.folder.ACL.AllowsAny(principals, acl.Read)
+}
@@ -0,0 +1,219 @@
+package tag
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// maxLength caps the length of keys and values
+const maxLength = 63
+
+var (
+	keyPattern   = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]*[A-Za-z0-9])?$`)
+	valuePattern = regexp.MustCompile(`^([A-Za-z0-9]([A-Za-z0-9._-]*[A-Za-z0-9])?)?$`)
+)
+
+// Tags are key/value labels such as project=apollo. Keys and values are
+// case-sensitive, and a value may be empty. Tags are never changed in
+// place, so copies of a folder or file can share them.
+type Tags map[string]string
+
+// CheckKey validates a tag key
+func CheckKey(key string) error {
+	if len(key) > maxLength || !keyPattern.MatchString(key) {
+		return errors.New("The tag key " + key + " is invalid: it must be 1 to 63 letters, digits, '.', '_', '-' or '/', starting and ending with a letter or digit.")
+	}
+	return nil
+}
+
+// CheckValue validates a tag value
+func CheckValue(value string) error {
+	if len(value) > maxLength || !valuePattern.MatchString(value) {
+		return errors.New("The tag value " + value + " is invalid: it must be up to 63 letters, digits, '.', '_' or '-', starting and ending with a letter or digit.")
+	}
+	return nil
+}
+
+// Parse reads tags written as key=value
+func Parse(pairs []string) (Tags, error) {
+	tags := Tags{}
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, errors.New("The tag " + pair + " is not in key=value form.")
+		}
+		tags[key] = value
+	}
+	if err := tags.Check(); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// Check validates every key and value
+func (t Tags) Check() error {
+	for _, key := range t.Keys() {
+		if err := CheckKey(key); err != nil {
+			return err
+		}
+		if err := CheckValue(t[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// With returns the tags with set added and the keys in remove taken out,
+// leaving t unchanged. It returns nil when no tags are left.
+func (t Tags) With(set Tags, remove []string) Tags {
+	c := make(Tags, len(t)+len(set))
+	for key, value := range t {
+		c[key] = value
+	}
+	for key, value := range set {
+		c[key] = value
+	}
+	for _, key := range remove {
+		delete(c, key)
+	}
+	if len(c) == 0 {
+		return nil
+	}
+	return c
+}
+
+// Keys returns the keys in sorted order
+func (t Tags) Keys() []string {
+	keys := make([]string, 0, len(t))
+	for key := range t {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// String prints the tags as key=value pairs separated by commas, sorted by key
+func (t Tags) String() string {
+	pairs := make([]string, 0, len(t))
+	for _, key := range t.Keys() {
+		pairs = append(pairs, key+"="+t[key])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// Size returns the number of bytes the tags count against a quota
+func (t Tags) Size() int64 {
+	var size int64
+	for key, value := range t {
+		size += int64(len(key) + len(value))
+	}
+	return size
+}
+
+// Operator is how a requirement tests a key
+type Operator int
+
+// Operators of a requirement
+const (
+	Equals Operator = iota
+	NotEquals
+	Exists
+	NotExists
+)
+
+// Requirement is one condition of a selector
+type Requirement struct {
+	Key      string
+	Operator Operator
+	// Value is compared by Equals and NotEquals
+	Value string
+}
+
+// Matches reports whether tags meet the requirement. As with Kubernetes
+// label selectors, key!=value also matches tags without the key.
+func (r Requirement) Matches(t Tags) bool {
+	value, ok := t[r.Key]
+	switch r.Operator {
+	case Equals:
+		return ok && value == r.Value
+	case NotEquals:
+		return !ok || value != r.Value
+	case Exists:
+		return ok
+	default:
+		return !ok
+	}
+}
+
+// String prints the requirement in selector syntax
+func (r Requirement) String() string {
+	switch r.Operator {
+	case Equals:
+		return r.Key + "=" + r.Value
+	case NotEquals:
+		return r.Key + "!=" + r.Value
+	case Exists:
+		return r.Key
+	default:
+		return "!" + r.Key
+	}
+}
+
+// Selector selects tags meeting all of its requirements. An empty selector
+// selects everything.
+type Selector []Requirement
+
+// ParseSelector reads a comma-separated list of requirements, each one of
+// key=value (or key==value), key!=value, key (the key is set) and !key
+// (the key is not set)
+func ParseSelector(s string) (Selector, error) {
+	var sel Selector
+	if strings.TrimSpace(s) == "" {
+		return sel, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		var r Requirement
+		switch {
+		case strings.HasPrefix(part, "!") && !strings.Contains(part, "="):
+			r = Requirement{Key: strings.TrimSpace(part[1:]), Operator: NotExists}
+		case strings.Contains(part, "!="):
+			key, value, _ := strings.Cut(part, "!=")
+			r = Requirement{Key: strings.TrimSpace(key), Operator: NotEquals, Value: strings.TrimSpace(value)}
+		case strings.Contains(part, "="):
+			key, value, _ := strings.Cut(part, "=")
+			r = Requirement{Key: strings.TrimSpace(key), Operator: Equals, Value: strings.TrimSpace(strings.TrimPrefix(value, "="))}
+		default:
+			r = Requirement{Key: part, Operator: Exists}
+		}
+		if err := CheckKey(r.Key); err != nil {
+			return nil, err
+		}
+		if err := CheckValue(r.Value); err != nil {
+			return nil, err
+		}
+		sel = append(sel, r)
+	}
+	return sel, nil
+}
+
+// Matches reports whether tags meet every requirement
+func (sel Selector) Matches(t Tags) bool {
+	for _, r := range sel {
+		if !r.Matches(t) {
+			return false
+		}
+	}
+	return true
+}
+
+// String prints the selector in the form ParseSelector reads
+func (sel Selector) String() string {
+	parts := make([]string, len(sel))
+	for i, r := range sel {
+		parts[i] = r.String()
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,87 @@
+package tag
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tags, err := Parse([]string{"project=apollo", "env=prod", "reviewed="})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if want := (Tags{"project": "apollo", "env": "prod", "reviewed": ""}); !reflect.DeepEqual(tags, want) {
+		t.Errorf("Parse() = %v, want %v", tags, want)
+	}
+	if tags.String() != "env=prod,project=apollo,reviewed=" {
+		t.Errorf("String() = %q", tags.String())
+	}
+
+	for _, pair := range []string{"project", "=apollo", "-x=1", "env=prod!", "env=" + string(make([]byte, 64))} {
+		if _, err := Parse([]string{pair}); err == nil {
+			t.Errorf("Parse(%q) succeeded", pair)
+		}
+	}
+}
+
+func TestTags_With(t *testing.T) {
+	tags := Tags{"project": "apollo", "env": "dev"}
+	got := tags.With(Tags{"env": "prod"}, []string{"project", "missing"})
+	if !reflect.DeepEqual(got, Tags{"env": "prod"}) {
+		t.Errorf("With() = %v", got)
+	}
+	if tags["env"] != "dev" || len(tags) != 2 {
+		t.Errorf("With() changed the original tags: %v", tags)
+	}
+	if got := tags.With(nil, []string{"project", "env"}); got != nil {
+		t.Errorf("With() removing every tag = %v, want nil", got)
+	}
+	if got := tags.Size(); got != int64(len("projectapolloenvdev")) {
+		t.Errorf("Size() = %d", got)
+	}
+}
+
+func TestSelector(t *testing.T) {
+	tags := Tags{"project": "apollo", "env": "prod"}
+
+	tests := []struct {
+		selector string
+		want     bool
+	}{
+		{"", true},
+		{"project=apollo", true},
+		{"project==apollo", true},
+		{"project=gemini", false},
+		{"project!=gemini", true},
+		{"team!=ops", true},
+		{"env", true},
+		{"team", false},
+		{"!team", true},
+		{"!env", false},
+		{"project=apollo, env!=dev, !legacy", true},
+		{"project=apollo,env=dev", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			sel, err := ParseSelector(tt.selector)
+			if err != nil {
+				t.Fatalf("ParseSelector(%q) error = %v", tt.selector, err)
+			}
+			if got := sel.Matches(tags); got != tt.want {
+				t.Errorf("ParseSelector(%q).Matches() = %v, want %v", tt.selector, got, tt.want)
+			}
+		})
+	}
+
+	sel, _ := ParseSelector("project==apollo, env!=dev,team,!legacy")
+	if sel.String() != "project=apollo,env!=dev,team,!legacy" {
+		t.Errorf("String() = %q", sel.String())
+	}
+
+	for _, s := range []string{"=apollo", "project=apollo,", "!", "env!=dev!"} {
+		if _, err := ParseSelector(s); err == nil {
+			t.Errorf("ParseSelector(%q) succeeded", s)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package trash
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/fatbrother/virtual-file-system/internal/file"
+	"github.com/fatbrother/virtual-file-system/internal/folder"
+)
+
+// Item is a deleted folder or file. A trashed folder keeps its files.
+type Item struct {
+	ID     string
+	Folder *folder.Folder
+	File   *file.File
+	// FolderName is the folder a trashed file was deleted from
+	FolderName string
+	DeletedAt  time.Time
+	DeletedBy  string
+
+	seq int
+}
+
+// Kind returns "folder" or "file"
+func (i *Item) Kind() string {
+	if i.File != nil {
+		return "file"
+	}
+	return "folder"
+}
+
+// Location returns the original path of the item within its owner's namespace
+func (i *Item) Location() string {
+	if i.File != nil {
+		return i.FolderName + "/" + i.File.Name
+	}
+	return i.Folder.Name
+}
+
+// Size returns the number of bytes the item counts against its owner's quota
+func (i *Item) Size() int64 {
+	if i.File != nil {
+		return i.File.Size()
+	}
+	size := i.Folder.Size()
+	for _, f := range i.Files() {
+		size += f.Size()
+	}
+	return size
+}
+
+// Files returns the files of a trashed folder
+func (i *Item) Files() []*file.File {
+	if i.Folder == nil {
+		return nil
+	}
+	results := i.Folder.Files.PrefixSearch("")
+	files := make([]*file.File, 0, len(results))
+	for _, value := range results {
+		if f, ok := value.(*file.File); ok {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// Format prints the item details
+func (i *Item) Format() string {
+	return i.ID + " " + i.Kind() + " " + i.Location() + " " + i.DeletedAt.Format(time.RFC3339)
+}
+
+// Bin holds a user's deleted items until they are restored or purged
+type Bin struct {
+	items  map[string]*Item
+	nextID int
+}
+
+// NewBin creates an empty Bin
+func NewBin() *Bin {
+	return &Bin{items: make(map[string]*Item)}
+}
+
+// AddFolder moves a deleted folder into the bin and returns its item
+func (b *Bin) AddFolder(f *folder.Folder, deletedBy string) *Item {
+	return b.add(&Item{Folder: f, DeletedBy: deletedBy})
+}
+
+// AddFile moves a file deleted from folderName into the bin and returns its item
+func (b *Bin) AddFile(folderName string, f *file.File, deletedBy string) *Item {
+	return b.add(&Item{File: f, FolderName: folderName, DeletedBy: deletedBy})
+}
+
+func (b *Bin) add(item *Item) *Item {
+	b.nextID++
+	item.seq = b.nextID
+	item.ID = strconv.Itoa(b.nextID)
+	item.DeletedAt = time.Now()
+	b.items[item.ID] = item
+	return item
+}
+
+// Get returns the item with the given ID
+func (b *Bin) Get(id string) (*Item, error) {
+	item, ok := b.items[id]
+	if !ok {
+		return nil, errors.New("The trash item " + id + " not found.")
+	}
+	return item, nil
+}
+
+// Remove takes an item out of the bin
+func (b *Bin) Remove(id string) {
+	delete(b.items, id)
+}
+
+// Items returns the items in the bin, oldest first
+func (b *Bin) Items() []*Item {
+	items := make([]*Item, 0, len(b.items))
+	for _, item := range b.items {
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].seq < items[j].seq
+	})
+	return items
+}
+
+// Empty permanently deletes every item and returns how many there were
+func (b *Bin) Empty() int {
+	n := len(b.items)
+	b.items = make(map[string]*Item)
+	return n
+}
+
+// Purge permanently deletes the items deleted before cutoff and returns how many there were
+func (b *Bin) Purge(cutoff time.Time) int {
+	n := 0
+	for id, item := range b.items {
+		if item.DeletedAt.Before(cutoff) {
+			delete(b.items, id)
+			n++
+		}
+	}
+	return n
+}
+
+// Clone returns a copy of the bin whose items hold the folders and files that
+// mapFolder and mapFile return for the originals
+func (b *Bin) Clone(mapFolder func(*folder.Folder) *folder.Folder, mapFile func(*file.File) *file.File) *Bin {
+	c := &Bin{items: make(map[string]*Item, len(b.items)), nextID: b.nextID}
+	for id, item := range b.items {
+		copied := *item
+		if item.Folder != nil {
+			copied.Folder = mapFolder(item.Folder)
+		}
+		if item.File != nil {
+			copied.File = mapFile(item.File)
+		}
+		c.items[id] = &copied
+	}
+	return c
+}
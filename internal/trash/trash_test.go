@@ -0,0 +1,53 @@
+package trash
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fatbrother/virtual-file-system/internal/file"
+	"github.com/fatbrother/virtual-file-system/internal/folder"
+)
+
+func TestBin(t *testing.T) {
+	b := NewBin()
+
+	docs, _ := folder.NewFolder("docs", "Documents", "owner")
+	report, _ := file.NewFile("report.txt", "Report", "owner")
+	docs.Files.Insert(report.Key(), report)
+	notes, _ := file.NewFile("notes.txt", "", "owner")
+
+	folderItem := b.AddFolder(docs, "owner")
+	fileItem := b.AddFile("work", notes, "bob")
+
+	if folderItem.Kind() != "folder" || folderItem.Location() != "docs" || folderItem.Size() != int64(len("Documents")+len("Report")) {
+		t.Errorf("folder item = %s, size %d", folderItem.Format(), folderItem.Size())
+	}
+	if fileItem.Kind() != "file" || fileItem.Location() != "work/notes.txt" || fileItem.DeletedBy != "bob" {
+		t.Errorf("file item = %s", fileItem.Format())
+	}
+
+	items := b.Items()
+	if len(items) != 2 || items[0] != folderItem || items[1] != fileItem {
+		t.Errorf("Items() = %v, want deletion order", items)
+	}
+
+	if got, err := b.Get(fileItem.ID); err != nil || got != fileItem {
+		t.Errorf("Get() = %v, %v", got, err)
+	}
+	b.Remove(fileItem.ID)
+	if _, err := b.Get(fileItem.ID); err == nil {
+		t.Errorf("Get() found a removed item")
+	}
+
+	if n := b.Purge(time.Now().Add(-time.Hour)); n != 0 {
+		t.Errorf("Purge() removed %d recent items", n)
+	}
+	if n := b.Purge(time.Now().Add(time.Second)); n != 1 || len(b.Items()) != 0 {
+		t.Errorf("Purge() removed %d items, %d left", n, len(b.Items()))
+	}
+
+	b.AddFile("work", notes, "owner")
+	if n := b.Empty(); n != 1 || len(b.Items()) != 0 {
+		t.Errorf("Empty() removed %d items", n)
+	}
+}
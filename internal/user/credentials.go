@@ -0,0 +1,149 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	minPasswordLength = 8
+	// maxPasswordLength is the most bcrypt will hash
+	maxPasswordLength = 72
+	tokenPrefix       = "vfs_"
+)
+
+// Token is an API token that can be used instead of the password.
+// Only a hash of the secret is kept.
+type Token struct {
+	ID        string
+	Name      string
+	CreatedAt time.Time
+	hash      []byte
+}
+
+// SetPassword replaces the user's password with a salted bcrypt hash of password
+func (u *User) SetPassword(password string) error {
+	if len([]rune(password)) < minPasswordLength {
+		return errors.New("The password must be at least 8 characters long.")
+	}
+	if len(password) > maxPasswordLength {
+		return errors.New("The password must be at most 72 bytes long.")
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	u.passwordHash = hash
+	return nil
+}
+
+// CheckPassword reports whether password matches the user's password
+func (u *User) CheckPassword(password string) bool {
+	if u.passwordHash == nil {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword(u.passwordHash, []byte(password)) == nil
+}
+
+// HasPassword reports whether a password has been set
+func (u *User) HasPassword() bool {
+	return u.passwordHash != nil
+}
+
+// HasCredentials reports whether the user can only be acted as after authenticating
+func (u *User) HasCredentials() bool {
+	return u.passwordHash != nil || len(u.tokens) > 0
+}
+
+// CreateToken issues a new API token and returns its secret, which is not stored and cannot be shown again
+func (u *User) CreateToken(name string) (string, Token, error) {
+	id, err := randomHex(4)
+	if err != nil {
+		return "", Token{}, err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return "", Token{}, err
+	}
+
+	sum := sha256.Sum256([]byte(secret))
+	token := Token{ID: id, Name: name, CreatedAt: time.Now(), hash: sum[:]}
+	if u.tokens == nil {
+		u.tokens = make(map[string]Token)
+	}
+	u.tokens[id] = token
+	return tokenPrefix + id + "_" + secret, token, nil
+}
+
+// CheckToken reports whether value is an unrevoked token of the user
+func (u *User) CheckToken(value string) bool {
+	rest := strings.TrimPrefix(value, tokenPrefix)
+	if rest == value {
+		return false
+	}
+	parts := strings.SplitN(rest, "_", 2)
+	if len(parts) != 2 {
+		return false
+	}
+
+	token, ok := u.tokens[parts[0]]
+	if !ok {
+		return false
+	}
+	sum := sha256.Sum256([]byte(parts[1]))
+	return subtle.ConstantTimeCompare(sum[:], token.hash) == 1
+}
+
+// RevokeToken deletes the token with the given ID
+func (u *User) RevokeToken(id string) error {
+	if _, ok := u.tokens[id]; !ok {
+		return errors.New("The token " + id + " not found.")
+	}
+	delete(u.tokens, id)
+	return nil
+}
+
+// Tokens returns the user's tokens, oldest first
+func (u *User) Tokens() []Token {
+	tokens := make([]Token, 0, len(u.tokens))
+	for _, token := range u.tokens {
+		tokens = append(tokens, token)
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		if tokens[i].CreatedAt.Equal(tokens[j].CreatedAt) {
+			return tokens[i].ID < tokens[j].ID
+		}
+		return tokens[i].CreatedAt.Before(tokens[j].CreatedAt)
+	})
+	return tokens
+}
+
+// Authenticate reports whether secret is the user's password or one of their tokens
+func (u *User) Authenticate(secret string) bool {
+	if strings.HasPrefix(secret, tokenPrefix) && u.CheckToken(secret) {
+		return true
+	}
+	return u.CheckPassword(secret)
+}
+
+// Format prints the token details
+func (t Token) Format() string {
+	return t.ID + " " + t.Name + " " + t.CreatedAt.Format(time.RFC3339)
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
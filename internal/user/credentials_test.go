@@ -0,0 +1,75 @@
+package user
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUser_SetPassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		wantErr  bool
+	}{
+		{"Valid password", "correct horse", false},
+		{"Too short", "short", true},
+		{"Too long", strings.Repeat("a", 73), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, _ := NewUser("testuser")
+			err := u.SetPassword(tt.password)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SetPassword() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if u.HasPassword() == tt.wantErr {
+				t.Errorf("HasPassword() = %v after error %v", u.HasPassword(), err)
+			}
+		})
+	}
+}
+
+func TestUser_CheckPassword(t *testing.T) {
+	u, _ := NewUser("testuser")
+	if u.CheckPassword("") || u.HasCredentials() {
+		t.Errorf("a user without a password must not authenticate")
+	}
+
+	_ = u.SetPassword("correct horse")
+	if !u.CheckPassword("correct horse") || !u.Authenticate("correct horse") {
+		t.Errorf("CheckPassword() rejected the right password")
+	}
+	if u.CheckPassword("wrong horse") {
+		t.Errorf("CheckPassword() accepted a wrong password")
+	}
+}
+
+func TestUser_Tokens(t *testing.T) {
+	u, _ := NewUser("testuser")
+	secret, token, err := u.CreateToken("ci")
+	if err != nil {
+		t.Fatalf("CreateToken() error = %v", err)
+	}
+	other, _, _ := u.CreateToken("laptop")
+
+	if !u.HasCredentials() || !u.Authenticate(secret) || !u.Authenticate(other) {
+		t.Errorf("Authenticate() rejected an issued token")
+	}
+	if u.Authenticate(secret+"x") || u.Authenticate("vfs_"+token.ID) || u.Authenticate("vfs_nope_nope") {
+		t.Errorf("Authenticate() accepted a forged token")
+	}
+	if tokens := u.Tokens(); len(tokens) != 2 || tokens[0].Name != "ci" || tokens[1].Name != "laptop" {
+		t.Errorf("Tokens() = %v", tokens)
+	}
+
+	if err := u.RevokeToken(token.ID); err != nil {
+		t.Fatalf("RevokeToken() error = %v", err)
+	}
+	if u.Authenticate(secret) || !u.Authenticate(other) {
+		t.Errorf("RevokeToken() revoked the wrong token")
+	}
+	if err := u.RevokeToken(token.ID); err == nil {
+		t.Errorf("RevokeToken() of a revoked token succeeded")
+	}
+}
@@ -0,0 +1,88 @@
+package user
+
+import (
+	"errors"
+	"strconv"
+)
+
+// Quota resources
+const (
+	QuotaFolders = "folders"
+	QuotaFiles   = "files"
+	QuotaBytes   = "bytes"
+)
+
+// Quota limits how much a user may store. A zero limit means unlimited.
+type Quota struct {
+	MaxFolders int
+	MaxFiles   int
+	MaxBytes   int64
+}
+
+// Usage is how much a user currently stores. Bytes counts descriptions and stored data.
+type Usage struct {
+	Folders int
+	Files   int
+	Bytes   int64
+}
+
+// Add returns the combined usage of u and other
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		Folders: u.Folders + other.Folders,
+		Files:   u.Files + other.Files,
+		Bytes:   u.Bytes + other.Bytes,
+	}
+}
+
+// Exceeded returns the first resource for which usage goes over the quota, or "" if none does
+func (q Quota) Exceeded(usage Usage) string {
+	switch {
+	case q.MaxFolders > 0 && usage.Folders > q.MaxFolders:
+		return QuotaFolders
+	case q.MaxFiles > 0 && usage.Files > q.MaxFiles:
+		return QuotaFiles
+	case q.MaxBytes > 0 && usage.Bytes > q.MaxBytes:
+		return QuotaBytes
+	}
+	return ""
+}
+
+// Limit returns the limit for a resource, 0 meaning unlimited
+func (q Quota) Limit(resource string) int64 {
+	switch resource {
+	case QuotaFolders:
+		return int64(q.MaxFolders)
+	case QuotaFiles:
+		return int64(q.MaxFiles)
+	case QuotaBytes:
+		return q.MaxBytes
+	}
+	return 0
+}
+
+// Set changes the limit for a resource. A limit of 0 removes it.
+func (q *Quota) Set(resource string, limit int64) error {
+	if limit < 0 {
+		return errors.New("The quota limit must not be negative.")
+	}
+	switch resource {
+	case QuotaFolders:
+		q.MaxFolders = int(limit)
+	case QuotaFiles:
+		q.MaxFiles = int(limit)
+	case QuotaBytes:
+		q.MaxBytes = limit
+	default:
+		return errors.New("The " + resource + " is not a quota resource.")
+	}
+	return nil
+}
+
+// FormatLimit prints a limit, showing 0 as unlimited
+func FormatLimit(limit int64) string {
+	if limit == 0 {
+		return "unlimited"
+	}
+	return strconv.FormatInt(limit, 10)
+}
@@ -0,0 +1,41 @@
+package user
+
+import "testing"
+
+func TestQuota_Exceeded(t *testing.T) {
+	q := Quota{MaxFolders: 2, MaxBytes: 100}
+
+	tests := []struct {
+		name  string
+		usage Usage
+		want  string
+	}{
+		{"Within limits", Usage{Folders: 2, Files: 1000, Bytes: 100}, ""},
+		{"Too many folders", Usage{Folders: 3}, QuotaFolders},
+		{"Too many bytes", Usage{Bytes: 101}, QuotaBytes},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := q.Exceeded(tt.usage); got != tt.want {
+				t.Errorf("Exceeded(%+v) = %q, want %q", tt.usage, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuota_Set(t *testing.T) {
+	var q Quota
+	if err := q.Set(QuotaFiles, 5); err != nil || q.Limit(QuotaFiles) != 5 {
+		t.Errorf("Set(files, 5) = %v, limit %d", err, q.Limit(QuotaFiles))
+	}
+	if err := q.Set("disks", 1); err == nil {
+		t.Errorf("Set() accepted an unknown resource")
+	}
+	if err := q.Set(QuotaBytes, -1); err == nil {
+		t.Errorf("Set() accepted a negative limit")
+	}
+	if FormatLimit(q.Limit(QuotaBytes)) != "unlimited" {
+		t.Errorf("FormatLimit(0) = %q", FormatLimit(0))
+	}
+}
@@ -5,15 +5,47 @@ import (
 	"strings"
 	"time"
 
+	"github.com/fatbrother/virtual-file-system/internal/naming"
+	"github.com/fatbrother/virtual-file-system/internal/snapshot"
+	"github.com/fatbrother/virtual-file-system/internal/trash"
 	"github.com/fatbrother/virtual-file-system/pkg/trie"
-	"github.com/fatbrother/virtual-file-system/pkg/validator"
 )
 
-// User represents a user in the virtual file system
+// Role determines what a user may do beyond their own namespace
+type Role string
+
+const (
+	// RoleUser manages only their own folders and files
+	RoleUser Role = "user"
+	// RoleAdmin may also manage other users and any group
+	RoleAdmin Role = "admin"
+)
+
+// ParseRole converts "user" or "admin" into a Role
+func ParseRole(s string) (Role, error) {
+	switch role := Role(strings.ToLower(s)); role {
+	case RoleUser, RoleAdmin:
+		return role, nil
+	}
+	return "", errors.New("The " + s + " is not a valid role.")
+}
+
+// User represents a user in the virtual file system. Username keeps the
+// casing it was registered with; lookups use Key.
 type User struct {
 	Username  string
+	Role      Role
+	Quota     Quota
 	CreatedAt time.Time
 	Folders   *trie.Trie
+	Trash     *trash.Bin
+	// Snapshots are keyed by snapshot key
+	Snapshots map[string]*snapshot.Snapshot
+	// Version changes whenever the user's settings or list of folders change
+	Version uint64
+
+	passwordHash []byte
+	tokens       map[string]Token
 }
 
 // NewUser creates a new User with the given username
@@ -22,24 +54,41 @@ func NewUser(username string) (*User, error) {
 		return nil, err
 	}
 	return &User{
-		Username:  strings.ToLower(username),
+		Username:  naming.Normalize(username),
+		Role:      RoleUser,
 		CreatedAt: time.Now(),
 		Folders:   trie.NewTrie(),
+		Trash:     trash.NewBin(),
+		Snapshots: make(map[string]*snapshot.Snapshot),
 	}, nil
 }
 
 // validateUsername checks if the username is valid
 func validateUsername(username string) error {
-	validators := []validator.Validator{
-		validator.NewLengthValidator(1, 50),
-		validator.NewPatternValidator("^[a-zA-Z0-9_-]+$"),
-	}
+	return naming.CheckUsername(username)
+}
 
-	for _, v := range validators {
-		if pass := v.Validate(username); !pass {
-			return errors.New("The " + username + " is invalid.")
-		}
-	}
+// Key returns the case-insensitive lookup key for the user
+func (u *User) Key() string {
+	return naming.Key(u.Username)
+}
 
-	return nil
+// IsAdmin reports whether the user has the admin role
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+// Clone returns a copy of the user with their own tokens and snapshot index. The folder trie and trash are shared; callers that need
+// those independent must replace them.
+func (u *User) Clone() *User {
+	c := *u
+	c.tokens = make(map[string]Token, len(u.tokens))
+	for id, token := range u.tokens {
+		c.tokens[id] = token
+	}
+	c.Snapshots = make(map[string]*snapshot.Snapshot, len(u.Snapshots))
+	for key, snap := range u.Snapshots {
+		c.Snapshots[key] = snap
+	}
+	return &c
 }
@@ -1,8 +1,8 @@
 package user
 
 import (
-	"testing"
 	"strings"
+	"testing"
 )
 
 func TestNewUser(t *testing.T) {
@@ -18,6 +18,7 @@ func TestNewUser(t *testing.T) {
 		{"Valid with numbers", "user123", false},
 		{"Valid with underscore", "valid_user", false},
 		{"Valid with hyphen", "valid-user", false},
+		{"Mixed case", "ValidUser", false},
 	}
 
 	for _, tt := range tests {
@@ -27,9 +28,38 @@ func TestNewUser(t *testing.T) {
 				t.Errorf("NewUser() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !tt.wantErr && got.Username != strings.ToLower(tt.username) {
-				t.Errorf("NewUser() got = %v, want %v", got.Username, strings.ToLower(tt.username))
+			if !tt.wantErr && got.Username != tt.username {
+				t.Errorf("NewUser() got = %v, want %v", got.Username, tt.username)
+			}
+			if !tt.wantErr && got.Key() != strings.ToLower(tt.username) {
+				t.Errorf("NewUser() key = %v, want %v", got.Key(), strings.ToLower(tt.username))
+			}
+		})
+	}
+}
+
+func TestParseRole(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Role
+		wantErr bool
+	}{
+		{"user", RoleUser, false},
+		{"Admin", RoleAdmin, false},
+		{"root", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseRole(tt.input)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ParseRole(%q) = %v, %v", tt.input, got, err)
 			}
 		})
 	}
-}
\ No newline at end of file
+
+	u, _ := NewUser("validuser")
+	if u.Role != RoleUser || u.IsAdmin() {
+		t.Errorf("NewUser() role = %v, want %v", u.Role, RoleUser)
+	}
+}
@@ -0,0 +1,279 @@
+package trie
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sort"
+	"unicode/utf8"
+)
+
+// formatVersion is the current version of the binary trie format
+const formatVersion byte = 1
+
+// magic identifies the start of a serialized trie
+var magic = [4]byte{'T', 'R', 'I', 'E'}
+
+const (
+	headerSize   = len(magic) + 1
+	checksumSize = 4
+)
+
+const (
+	// flagEnd marks a node that terminates a key
+	flagEnd byte = 1 << iota
+	// flagValue marks a node carrying an encoded value
+	flagValue
+)
+
+// maxDepth bounds the key length accepted when decoding, so hostile
+// input cannot recurse without limit
+const maxDepth = 4096
+
+var (
+	// ErrInvalidFormat is returned when the input is not a serialized trie
+	ErrInvalidFormat = errors.New("trie: invalid binary format")
+	// ErrUnsupportedVersion is returned when the input was written by an unknown format version
+	ErrUnsupportedVersion = errors.New("trie: unsupported format version")
+	// ErrChecksumMismatch is returned when the input fails checksum verification
+	ErrChecksumMismatch = errors.New("trie: checksum mismatch")
+	// ErrTruncated is returned when the input ends before the trie is complete
+	ErrTruncated = errors.New("trie: truncated input")
+	// ErrNoCodec is returned when values must be encoded or decoded but no codec is set
+	ErrNoCodec = errors.New("trie: no value codec set")
+)
+
+// ValueCodec converts trie values to and from bytes
+type ValueCodec interface {
+	EncodeValue(value interface{}) ([]byte, error)
+	DecodeValue(data []byte) (interface{}, error)
+}
+
+// StringCodec is a ValueCodec for string values
+type StringCodec struct{}
+
+// EncodeValue encodes a string value
+func (StringCodec) EncodeValue(value interface{}) ([]byte, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("trie: StringCodec cannot encode %T", value)
+	}
+	return []byte(s), nil
+}
+
+// DecodeValue decodes a string value
+func (StringCodec) DecodeValue(data []byte) (interface{}, error) {
+	return string(data), nil
+}
+
+// NewTrieWithCodec creates a new Trie that serializes its values with codec
+func NewTrieWithCodec(codec ValueCodec) *Trie {
+	t := NewTrie()
+	t.codec = codec
+	return t
+}
+
+// SetCodec sets the codec used by MarshalBinary and UnmarshalBinary
+func (t *Trie) SetCodec(codec ValueCodec) {
+	t.codec = codec
+}
+
+// MarshalBinary encodes the trie into a compact binary form.
+//
+// The layout is a header (magic and format version), the nodes in
+// depth-first order, and a trailing CRC-32 of everything before it.
+// Chains of nodes with a single child are collapsed into one edge so
+// shared prefixes are stored once.
+func (t *Trie) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(magic[:])
+	buf.WriteByte(formatVersion)
+
+	if err := t.encodeNode(&buf, t.root); err != nil {
+		return nil, err
+	}
+
+	var sum [checksumSize]byte
+	binary.BigEndian.PutUint32(sum[:], crc32.ChecksumIEEE(buf.Bytes()))
+	buf.Write(sum[:])
+	return buf.Bytes(), nil
+}
+
+func (t *Trie) encodeNode(buf *bytes.Buffer, node *Node) error {
+	var flags byte
+	if node.isEnd {
+		flags |= flagEnd
+	}
+	if node.isEnd && node.value != nil {
+		flags |= flagValue
+	}
+	buf.WriteByte(flags)
+
+	if flags&flagValue != 0 {
+		if t.codec == nil {
+			return ErrNoCodec
+		}
+		data, err := t.codec.EncodeValue(node.value)
+		if err != nil {
+			return err
+		}
+		writeUvarint(buf, uint64(len(data)))
+		buf.Write(data)
+	}
+
+	keys := make([]rune, 0, len(node.children))
+	for ch := range node.children {
+		keys = append(keys, ch)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	writeUvarint(buf, uint64(len(keys)))
+	for _, ch := range keys {
+		label := []rune{ch}
+		child := node.children[ch]
+		for !child.isEnd && len(child.children) == 1 {
+			for next, grandchild := range child.children {
+				label = append(label, next)
+				child = grandchild
+			}
+		}
+
+		edge := []byte(string(label))
+		writeUvarint(buf, uint64(len(edge)))
+		buf.Write(edge)
+		if err := t.encodeNode(buf, child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnmarshalBinary replaces the contents of the trie with data produced by MarshalBinary
+func (t *Trie) UnmarshalBinary(data []byte) error {
+	if len(data) < headerSize+checksumSize {
+		return ErrTruncated
+	}
+	if !bytes.Equal(data[:len(magic)], magic[:]) {
+		return ErrInvalidFormat
+	}
+	if version := data[len(magic)]; version != formatVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+
+	body, sum := data[:len(data)-checksumSize], data[len(data)-checksumSize:]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(sum) {
+		return ErrChecksumMismatch
+	}
+
+	r := bytes.NewReader(body[headerSize:])
+	root, err := t.decodeNode(r, 0)
+	if err != nil {
+		return err
+	}
+	if r.Len() != 0 {
+		return fmt.Errorf("%w: %d trailing bytes", ErrInvalidFormat, r.Len())
+	}
+
+	t.root = root
+	return nil
+}
+
+func (t *Trie) decodeNode(r *bytes.Reader, depth int) (*Node, error) {
+	flags, err := r.ReadByte()
+	if err != nil {
+		return nil, ErrTruncated
+	}
+	if flags&^(flagEnd|flagValue) != 0 || flags == flagValue {
+		return nil, fmt.Errorf("%w: unknown node flags %#x", ErrInvalidFormat, flags)
+	}
+
+	node := &Node{children: make(map[rune]*Node), isEnd: flags&flagEnd != 0}
+	if flags&flagValue != 0 {
+		data, err := readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		if t.codec == nil {
+			return nil, ErrNoCodec
+		}
+		if node.value, err = t.codec.DecodeValue(data); err != nil {
+			return nil, err
+		}
+	}
+
+	count, err := readLength(r)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < count; i++ {
+		edge, err := readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(edge) == 0 || !utf8.Valid(edge) {
+			return nil, fmt.Errorf("%w: malformed edge label", ErrInvalidFormat)
+		}
+
+		label := []rune(string(edge))
+		if depth+len(label) > maxDepth {
+			return nil, fmt.Errorf("%w: key exceeds %d characters", ErrInvalidFormat, maxDepth)
+		}
+
+		parent := node
+		for _, ch := range label[:len(label)-1] {
+			if parent.children[ch] != nil {
+				return nil, fmt.Errorf("%w: duplicate edge", ErrInvalidFormat)
+			}
+			next := &Node{children: make(map[rune]*Node)}
+			parent.children[ch] = next
+			parent = next
+		}
+
+		last := label[len(label)-1]
+		if parent.children[last] != nil {
+			return nil, fmt.Errorf("%w: duplicate edge", ErrInvalidFormat)
+		}
+		child, err := t.decodeNode(r, depth+len(label))
+		if err != nil {
+			return nil, err
+		}
+		parent.children[last] = child
+	}
+	return node, nil
+}
+
+func writeUvarint(buf *bytes.Buffer, v uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	buf.Write(tmp[:n])
+}
+
+// readLength reads a length prefix and checks it against the remaining input
+func readLength(r *bytes.Reader) (int, error) {
+	v, err := binary.ReadUvarint(r)
+	if err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return 0, ErrTruncated
+		}
+		return 0, fmt.Errorf("%w: %v", ErrInvalidFormat, err)
+	}
+	if v > uint64(r.Len()) {
+		return 0, ErrTruncated
+	}
+	return int(v), nil
+}
+
+func readBytes(r *bytes.Reader) ([]byte, error) {
+	n, err := readLength(r)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, ErrTruncated
+	}
+	return data, nil
+}
@@ -0,0 +1,137 @@
+package trie
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+type intCodec struct{}
+
+func (intCodec) EncodeValue(value interface{}) ([]byte, error) {
+	return []byte(strconv.Itoa(value.(int))), nil
+}
+
+func (intCodec) DecodeValue(data []byte) (interface{}, error) {
+	return strconv.Atoi(string(data))
+}
+
+func TestTrie_MarshalBinary(t *testing.T) {
+	trie := NewTrieWithCodec(intCodec{})
+	trie.Insert("hello", 1)
+	trie.Insert("help", 2)
+	trie.Insert("helm", 3)
+	trie.Insert("he", 4)
+	trie.Insert("world", 5)
+	trie.Insert("日本語", 6)
+
+	data, err := trie.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() error = %v", err)
+	}
+
+	got := NewTrieWithCodec(intCodec{})
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(got.PrefixSearch(""), trie.PrefixSearch("")) {
+		t.Errorf("UnmarshalBinary() = %v, want %v", got.PrefixSearch(""), trie.PrefixSearch(""))
+	}
+
+	again, err := got.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() error = %v", err)
+	}
+	if !reflect.DeepEqual(again, data) {
+		t.Errorf("MarshalBinary() is not deterministic")
+	}
+}
+
+func TestTrie_MarshalBinaryEmptyString(t *testing.T) {
+	trie := NewTrieWithCodec(StringCodec{})
+	trie.Insert("empty", "")
+
+	data, err := trie.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() error = %v", err)
+	}
+
+	got := NewTrieWithCodec(StringCodec{})
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary() error = %v", err)
+	}
+	if val, found := got.Search("empty"); !found || val != "" {
+		t.Errorf("Search() = (%v, %v), want (\"\", true)", val, found)
+	}
+}
+
+func TestTrie_MarshalBinaryNoCodec(t *testing.T) {
+	trie := NewTrie()
+	trie.Insert("key", 1)
+
+	if _, err := trie.MarshalBinary(); !errors.Is(err, ErrNoCodec) {
+		t.Errorf("MarshalBinary() error = %v, want %v", err, ErrNoCodec)
+	}
+}
+
+func TestTrie_UnmarshalBinaryCorrupt(t *testing.T) {
+	trie := NewTrieWithCodec(intCodec{})
+	trie.Insert("hello", 1)
+	trie.Insert("help", 2)
+	valid, _ := trie.MarshalBinary()
+
+	flipped := append([]byte(nil), valid...)
+	flipped[len(flipped)/2] ^= 0xff
+
+	version := append([]byte(nil), valid...)
+	version[len(magic)] = formatVersion + 1
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{"Empty input", nil, ErrTruncated},
+		{"Short input", valid[:6], ErrTruncated},
+		{"Bad magic", append([]byte("NOPE"), valid[4:]...), ErrInvalidFormat},
+		{"Unknown version", version, ErrUnsupportedVersion},
+		{"Flipped byte", flipped, ErrChecksumMismatch},
+		{"Truncated body", valid[:len(valid)-1], ErrChecksumMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewTrieWithCodec(intCodec{})
+			if err := got.UnmarshalBinary(tt.data); !errors.Is(err, tt.wantErr) {
+				t.Errorf("UnmarshalBinary() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTrie_UnmarshalBinaryFuzz(t *testing.T) {
+	trie := NewTrieWithCodec(intCodec{})
+	trie.Insert("hello", 1)
+	trie.Insert("help", 2)
+	trie.Insert("world", 3)
+	valid, _ := trie.MarshalBinary()
+
+	// Every prefix of the input must fail cleanly, even with a valid checksum
+	for n := headerSize; n < len(valid)-checksumSize; n++ {
+		data := withChecksum(valid[:n])
+		if err := NewTrieWithCodec(intCodec{}).UnmarshalBinary(data); err == nil {
+			t.Errorf("UnmarshalBinary() of %d body bytes succeeded", n)
+		}
+	}
+}
+
+func withChecksum(body []byte) []byte {
+	data := append([]byte(nil), body...)
+	var sum [checksumSize]byte
+	binary.BigEndian.PutUint32(sum[:], crc32.ChecksumIEEE(data))
+	return append(data, sum[:]...)
+}
@@ -1,9 +1,6 @@
 package trie
 
-import (
-	"strings"
-	"sync"
-)
+import "strings"
 
 // Node represents a node in the Trie
 type Node struct {
@@ -12,10 +9,11 @@ type Node struct {
 	value    interface{}
 }
 
-// Trie represents a trie data structure
+// Trie represents a trie data structure. A Trie is not safe for concurrent
+// use: callers that share one between goroutines must synchronize access.
 type Trie struct {
-	root *Node
-	mu   sync.RWMutex
+	root  *Node
+	codec ValueCodec
 }
 
 // NewTrie creates a new Trie
@@ -27,9 +25,6 @@ func NewTrie() *Trie {
 
 // Insert adds a key-value pair to the trie
 func (t *Trie) Insert(key string, value interface{}) {
-	t.mu.Lock()
-	defer t.mu.Unlock()
-
 	node := t.root
 	for _, ch := range strings.ToLower(key) {
 		if node.children[ch] == nil {
@@ -43,9 +38,6 @@ func (t *Trie) Insert(key string, value interface{}) {
 
 // Search looks for a key in the trie and returns its value
 func (t *Trie) Search(key string) (interface{}, bool) {
-	t.mu.RLock()
-	defer t.mu.RUnlock()
-
 	node := t.root
 	for _, ch := range strings.ToLower(key) {
 		if node.children[ch] == nil {
@@ -58,42 +50,41 @@ func (t *Trie) Search(key string) (interface{}, bool) {
 
 // Delete removes a key from the trie
 func (t *Trie) Delete(key string) bool {
-	t.mu.Lock()
-	defer t.mu.Unlock()
-
-	return t.delete(t.root, strings.ToLower(key), 0)
+	found, _ := t.delete(t.root, []rune(strings.ToLower(key)), 0)
+	return found
 }
 
-func (t *Trie) delete(node *Node, key string, depth int) bool {
+// delete reports whether the key was found and whether node can be pruned
+func (t *Trie) delete(node *Node, key []rune, depth int) (bool, bool) {
 	if node == nil {
-		return false
+		return false, false
 	}
 
 	if depth == len(key) {
 		if !node.isEnd {
-			return false
+			return false, false
 		}
 		node.isEnd = false
 		node.value = nil
-		return len(node.children) == 0
+		return true, len(node.children) == 0
 	}
 
-	ch := rune(key[depth])
-	if t.delete(node.children[ch], key, depth+1) {
+	ch := key[depth]
+	found, prune := t.delete(node.children[ch], key, depth+1)
+	if prune {
 		delete(node.children, ch)
-		return !node.isEnd && len(node.children) == 0
+		return found, !node.isEnd && len(node.children) == 0
 	}
 
-	return false
+	return found, false
 }
 
-// PrefixSearch returns all key-value pairs with the given prefix
+// PrefixSearch returns all key-value pairs with the given prefix. Like keys,
+// the prefix is lowercased, and only the subtree below it is visited.
 func (t *Trie) PrefixSearch(prefix string) map[string]interface{} {
-	t.mu.RLock()
-	defer t.mu.RUnlock()
-
+	prefix = strings.ToLower(prefix)
 	node := t.root
-	for _, ch := range strings.ToLower(prefix) {
+	for _, ch := range prefix {
 		if node.children[ch] == nil {
 			return nil
 		}
@@ -53,4 +53,33 @@ func TestTrie(t *testing.T) {
 	if !reflect.DeepEqual(prefixResults, expectedResults) {
 		t.Errorf("PrefixSearch() = %v, want %v", prefixResults, expectedResults)
 	}
-}
\ No newline at end of file
+	if got := trie.PrefixSearch("HEL"); !reflect.DeepEqual(got, expectedResults) {
+		t.Errorf("PrefixSearch(HEL) = %v, want %v", got, expectedResults)
+	}
+	if got := trie.PrefixSearch("hex"); len(got) != 0 {
+		t.Errorf("PrefixSearch(hex) = %v, want none", got)
+	}
+}
+
+func TestTrie_DeleteSharedPrefix(t *testing.T) {
+	trie := NewTrie()
+	trie.Insert("doc", 1)
+	trie.Insert("docs", 2)
+	trie.Insert("文件", 3)
+
+	if !trie.Delete("docs") {
+		t.Errorf("Delete(docs) = false, want true")
+	}
+	if !trie.Delete("文件") {
+		t.Errorf("Delete(文件) = false, want true")
+	}
+	if trie.Delete("missing") {
+		t.Errorf("Delete(missing) = true, want false")
+	}
+	if val, found := trie.Search("doc"); !found || val != 1 {
+		t.Errorf("Search(doc) = (%v, %v), want (1, true)", val, found)
+	}
+	if _, found := trie.Search("文件"); found {
+		t.Errorf("Search(文件) found a deleted key")
+	}
+}
@@ -0,0 +1,137 @@
+package validator
+
+import (
+	"fmt"
+	"unicode"
+
+	"github.com/rivo/uniseg"
+	"golang.org/x/text/unicode/norm"
+)
+
+type GraphemeLengthValidator struct {
+	min int
+	max int
+}
+
+type ControlCharacterValidator struct{}
+
+type MixedScriptValidator struct{}
+
+type CompatibilityCharacterValidator struct{}
+
+// NewGraphemeLengthValidator creates a validator for the number of user-perceived
+// characters (extended grapheme clusters) in the input
+func NewGraphemeLengthValidator(min, max int) *GraphemeLengthValidator {
+	return &GraphemeLengthValidator{min: min, max: max}
+}
+
+func (v *GraphemeLengthValidator) Validate(input string) bool {
+	return v.Check(input) == nil
+}
+
+func (v *GraphemeLengthValidator) Check(input string) error {
+	length := uniseg.GraphemeClusterCount(input)
+	if length >= v.min && length <= v.max {
+		return nil
+	}
+	return &ValidationError{Input: input, Rule: fmt.Sprintf("must be between %d and %d characters long", v.min, v.max)}
+}
+
+// NewControlCharacterValidator creates a validator rejecting control and invisible
+// formatting characters. Zero-width joiners are allowed so emoji sequences survive.
+func NewControlCharacterValidator() *ControlCharacterValidator {
+	return &ControlCharacterValidator{}
+}
+
+func (v *ControlCharacterValidator) Validate(input string) bool {
+	return v.Check(input) == nil
+}
+
+func (v *ControlCharacterValidator) Check(input string) error {
+	for _, r := range input {
+		if r == '\u200c' || r == '\u200d' {
+			continue
+		}
+		if unicode.IsControl(r) || unicode.Is(unicode.Cf, r) || r == unicode.ReplacementChar {
+			return &ValidationError{Input: input, Rule: fmt.Sprintf("must not contain control character %U", r)}
+		}
+	}
+	return nil
+}
+
+// NewMixedScriptValidator creates a validator rejecting input that mixes letters from
+// different scripts, such as a Cyrillic 'а' inside a Latin name. Common and inherited
+// characters (digits, punctuation, combining marks) go with any script, and Han may
+// be combined with Hiragana, Katakana, Hangul or Bopomofo.
+func NewMixedScriptValidator() *MixedScriptValidator {
+	return &MixedScriptValidator{}
+}
+
+func (v *MixedScriptValidator) Validate(input string) bool {
+	return v.Check(input) == nil
+}
+
+func (v *MixedScriptValidator) Check(input string) error {
+	seen := make(map[string]bool)
+	for _, r := range input {
+		if script := scriptOf(r); script != "" {
+			seen[script] = true
+		}
+	}
+	if len(seen) <= 1 || cjkCompatible(seen) {
+		return nil
+	}
+	return &ValidationError{Input: input, Rule: "must not mix characters from different scripts"}
+}
+
+// NewCompatibilityCharacterValidator creates a validator rejecting characters that
+// only differ from ordinary ones in presentation, such as fullwidth letters,
+// ligatures and superscripts, which are easily confused with their plain forms
+func NewCompatibilityCharacterValidator() *CompatibilityCharacterValidator {
+	return &CompatibilityCharacterValidator{}
+}
+
+func (v *CompatibilityCharacterValidator) Validate(input string) bool {
+	return v.Check(input) == nil
+}
+
+func (v *CompatibilityCharacterValidator) Check(input string) error {
+	if norm.NFKC.String(input) == norm.NFC.String(input) {
+		return nil
+	}
+	return &ValidationError{Input: input, Rule: "must not contain lookalike compatibility characters"}
+}
+
+// scriptOf returns the script of r, or "" for characters shared between scripts
+func scriptOf(r rune) string {
+	if unicode.In(r, unicode.Common, unicode.Inherited) {
+		return ""
+	}
+	for name, table := range unicode.Scripts {
+		if unicode.Is(table, r) {
+			return name
+		}
+	}
+	return ""
+}
+
+// cjkCompatible reports whether the scripts form a combination normally used together
+func cjkCompatible(scripts map[string]bool) bool {
+	allowed := [][]string{
+		{"Han", "Hiragana", "Katakana"},
+		{"Han", "Hangul"},
+		{"Han", "Bopomofo"},
+	}
+	for _, set := range allowed {
+		matched := 0
+		for _, script := range set {
+			if scripts[script] {
+				matched++
+			}
+		}
+		if matched == len(scripts) {
+			return true
+		}
+	}
+	return false
+}
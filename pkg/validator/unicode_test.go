@@ -0,0 +1,105 @@
+package validator
+
+import (
+	"testing"
+)
+
+func TestGraphemeLengthValidator(t *testing.T) {
+	tests := []struct {
+		name   string
+		min    int
+		max    int
+		input  string
+		expect bool
+	}{
+		{"ascii", 1, 5, "hello", true},
+		{"combining mark counts once", 1, 4, "cafe\u0301", true},
+		{"emoji sequence counts once", 1, 1, "\U0001F469\u200d\U0001F4BB", true},
+		{"flag counts once", 1, 1, "🇹🇼", true},
+		{"too long", 1, 3, "日本語です", false},
+		{"empty", 1, 3, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validator := NewGraphemeLengthValidator(tt.min, tt.max)
+			if result := validator.Validate(tt.input); result != tt.expect {
+				t.Errorf("expected %v, got %v", tt.expect, result)
+			}
+		})
+	}
+}
+
+func TestControlCharacterValidator(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		expect bool
+	}{
+		{"plain", "report", true},
+		{"newline", "re\nport", false},
+		{"null", "re\x00port", false},
+		{"right-to-left override", "report\u202etxt.exe", false},
+		{"zero width space", "re\u200bport", false},
+		{"zero width joiner", "\U0001F469\u200d\U0001F4BB", true},
+		{"invalid utf-8", "re\xffport", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validator := NewControlCharacterValidator()
+			if result := validator.Validate(tt.input); result != tt.expect {
+				t.Errorf("expected %v, got %v", tt.expect, result)
+			}
+		})
+	}
+}
+
+func TestMixedScriptValidator(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		expect bool
+	}{
+		{"latin", "paypal_2024", true},
+		{"cyrillic", "привет", true},
+		{"latin with cyrillic a", "p\u0430ypal", false},
+		{"greek omicron in latin", "g\u03bfogle", false},
+		{"japanese", "日本語のファイル", true},
+		{"korean with han", "한국語", true},
+		{"han with latin", "日本abc", false},
+		{"accented latin", "café", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validator := NewMixedScriptValidator()
+			if result := validator.Validate(tt.input); result != tt.expect {
+				t.Errorf("expected %v, got %v", tt.expect, result)
+			}
+		})
+	}
+}
+
+func TestCompatibilityCharacterValidator(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		expect bool
+	}{
+		{"plain", "file", true},
+		{"decomposed accent", "cafe\u0301", true},
+		{"fullwidth letters", "ｆｉｌｅ", false},
+		{"ligature", "ﬁle", false},
+		{"superscript", "x²", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validator := NewCompatibilityCharacterValidator()
+			if result := validator.Validate(tt.input); result != tt.expect {
+				t.Errorf("expected %v, got %v", tt.expect, result)
+			}
+		})
+	}
+}
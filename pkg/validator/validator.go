@@ -1,34 +1,240 @@
 package validator
 
 import (
+	"fmt"
 	"regexp"
+	"strings"
+	"unicode/utf8"
 )
+
+// Validator checks input against a rule
 type Validator interface {
+	// Validate reports whether input satisfies the rule
 	Validate(input string) bool
 }
 
+// Checker is a Validator that can also describe the rule input violates.
+// The validators in this package are all Checkers.
+type Checker interface {
+	Validator
+	// Check returns a *ValidationError describing the rule when input does not satisfy it
+	Check(input string) error
+}
+
+// Check validates input with v. The error describes the violated rule when
+// v is a Checker, and only says input is invalid otherwise.
+func Check(v Validator, input string) error {
+	if c, ok := v.(Checker); ok {
+		return c.Check(input)
+	}
+	if v.Validate(input) {
+		return nil
+	}
+	return &ValidationError{Input: input, Rule: "is not allowed"}
+}
+
+// ValidationError describes which rule an input violated
+type ValidationError struct {
+	Input string
+	Rule  string
+}
+
+func (e *ValidationError) Error() string {
+	return "The " + e.Input + " is invalid: " + e.Rule + "."
+}
+
 type LengthValidator struct {
 	min int
 	max int
 }
 
+type ByteLengthValidator struct {
+	max int
+}
+
 type PatternValidator struct {
 	pattern *regexp.Regexp
+	rule    string
+}
+
+type ReservedNameValidator struct {
+	names map[string]bool
+}
+
+type ForbiddenPrefixValidator struct {
+	prefixes []string
 }
 
+// NewLengthValidator creates a validator for the number of characters in the input
 func NewLengthValidator(min, max int) *LengthValidator {
 	return &LengthValidator{min: min, max: max}
 }
 
 func (v *LengthValidator) Validate(input string) bool {
-	length := len(input)
-	return length >= v.min && length <= v.max
+	return v.Check(input) == nil
+}
+
+func (v *LengthValidator) Check(input string) error {
+	length := utf8.RuneCountInString(input)
+	if length >= v.min && length <= v.max {
+		return nil
+	}
+	return &ValidationError{Input: input, Rule: fmt.Sprintf("must be between %d and %d characters long", v.min, v.max)}
+}
+
+// NewByteLengthValidator creates a validator for the encoded size of the input in bytes
+func NewByteLengthValidator(max int) *ByteLengthValidator {
+	return &ByteLengthValidator{max: max}
+}
+
+func (v *ByteLengthValidator) Validate(input string) bool {
+	return v.Check(input) == nil
+}
+
+func (v *ByteLengthValidator) Check(input string) error {
+	if len(input) <= v.max {
+		return nil
+	}
+	return &ValidationError{Input: input, Rule: fmt.Sprintf("must be at most %d bytes long", v.max)}
 }
 
 func NewPatternValidator(pattern string) *PatternValidator {
-	return &PatternValidator{pattern: regexp.MustCompile(pattern)}
+	return &PatternValidator{pattern: regexp.MustCompile(pattern), rule: "must match " + pattern}
+}
+
+// WithRule replaces the description reported when the pattern does not match
+func (v *PatternValidator) WithRule(rule string) *PatternValidator {
+	v.rule = rule
+	return v
 }
 
 func (v *PatternValidator) Validate(input string) bool {
 	return v.pattern.MatchString(input)
-}
\ No newline at end of file
+}
+
+func (v *PatternValidator) Check(input string) error {
+	if v.Validate(input) {
+		return nil
+	}
+	return &ValidationError{Input: input, Rule: v.rule}
+}
+
+// NewReservedNameValidator creates a validator rejecting the given names, ignoring case
+func NewReservedNameValidator(names ...string) *ReservedNameValidator {
+	v := &ReservedNameValidator{names: make(map[string]bool, len(names))}
+	for _, name := range names {
+		v.names[strings.ToLower(name)] = true
+	}
+	return v
+}
+
+func (v *ReservedNameValidator) Validate(input string) bool {
+	return v.Check(input) == nil
+}
+
+func (v *ReservedNameValidator) Check(input string) error {
+	if !v.names[strings.ToLower(input)] {
+		return nil
+	}
+	return &ValidationError{Input: input, Rule: "is a reserved name"}
+}
+
+// NewForbiddenPrefixValidator creates a validator rejecting input that starts with any of the prefixes
+func NewForbiddenPrefixValidator(prefixes ...string) *ForbiddenPrefixValidator {
+	return &ForbiddenPrefixValidator{prefixes: prefixes}
+}
+
+func (v *ForbiddenPrefixValidator) Validate(input string) bool {
+	return v.Check(input) == nil
+}
+
+func (v *ForbiddenPrefixValidator) Check(input string) error {
+	for _, prefix := range v.prefixes {
+		if strings.HasPrefix(input, prefix) {
+			return &ValidationError{Input: input, Rule: fmt.Sprintf("must not start with %q", prefix)}
+		}
+	}
+	return nil
+}
+
+type allValidator struct {
+	validators []Validator
+}
+
+type anyValidator struct {
+	validators []Validator
+}
+
+type notValidator struct {
+	validator Validator
+	rule      string
+}
+
+// All creates a validator that passes when every validator passes,
+// reporting the first failure
+func All(validators ...Validator) Checker {
+	return &allValidator{validators: validators}
+}
+
+func (v *allValidator) Validate(input string) bool {
+	return v.Check(input) == nil
+}
+
+func (v *allValidator) Check(input string) error {
+	for _, validator := range v.validators {
+		if err := Check(validator, input); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Any creates a validator that passes when at least one validator passes,
+// reporting every alternative on failure. It panics without validators, as
+// nothing could pass.
+func Any(validators ...Validator) Checker {
+	if len(validators) == 0 {
+		panic("validator: Any needs at least one validator")
+	}
+	return &anyValidator{validators: validators}
+}
+
+func (v *anyValidator) Validate(input string) bool {
+	return v.Check(input) == nil
+}
+
+func (v *anyValidator) Check(input string) error {
+	rules := make([]string, 0, len(v.validators))
+	for _, validator := range v.validators {
+		err := Check(validator, input)
+		if err == nil {
+			return nil
+		}
+		rules = append(rules, ruleOf(err))
+	}
+	return &ValidationError{Input: input, Rule: strings.Join(rules, " or ")}
+}
+
+// Not creates a validator that passes when validator fails, reporting rule otherwise
+func Not(validator Validator, rule string) Checker {
+	return &notValidator{validator: validator, rule: rule}
+}
+
+func (v *notValidator) Validate(input string) bool {
+	return !v.validator.Validate(input)
+}
+
+func (v *notValidator) Check(input string) error {
+	if v.Validate(input) {
+		return nil
+	}
+	return &ValidationError{Input: input, Rule: v.rule}
+}
+
+// ruleOf extracts the rule description from an error returned by Check
+func ruleOf(err error) string {
+	if verr, ok := err.(*ValidationError); ok {
+		return verr.Rule
+	}
+	return err.Error()
+}
@@ -1,6 +1,7 @@
 package validator
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -51,4 +52,148 @@ func TestPatternValidator(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestByteLengthValidator(t *testing.T) {
+	tests := []struct {
+		name   string
+		max    int
+		input  string
+		expect bool
+	}{
+		{"ascii within limit", 5, "hello", true},
+		{"ascii over limit", 4, "hello", false},
+		{"multibyte counts bytes", 4, "日本", false},
+		{"multibyte within limit", 6, "日本", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validator := NewByteLengthValidator(tt.max)
+			if result := validator.Validate(tt.input); result != tt.expect {
+				t.Errorf("expected %v, got %v", tt.expect, result)
+			}
+		})
+	}
+}
+
+func TestLengthValidatorCountsRunes(t *testing.T) {
+	if !NewLengthValidator(1, 2).Validate("日本") {
+		t.Errorf("expected two runes to pass a 2 character limit")
+	}
+}
+
+func TestReservedNameValidator(t *testing.T) {
+	validator := NewReservedNameValidator("con", "..")
+
+	tests := []struct {
+		input  string
+		expect bool
+	}{
+		{"con", false},
+		{"CON", false},
+		{"..", false},
+		{"console", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if result := validator.Validate(tt.input); result != tt.expect {
+				t.Errorf("expected %v, got %v", tt.expect, result)
+			}
+		})
+	}
+}
+
+func TestForbiddenPrefixValidator(t *testing.T) {
+	validator := NewForbiddenPrefixValidator(".", "-")
+
+	tests := []struct {
+		input  string
+		expect bool
+	}{
+		{".hidden", false},
+		{"-flag", false},
+		{"name.txt", true},
+		{"name-1", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if result := validator.Validate(tt.input); result != tt.expect {
+				t.Errorf("expected %v, got %v", tt.expect, result)
+			}
+		})
+	}
+}
+
+func TestCombinators(t *testing.T) {
+	length := NewLengthValidator(1, 5)
+	lower := NewPatternValidator(`^[a-z]+$`).WithRule("may only contain lowercase letters")
+	digits := NewPatternValidator(`^[0-9]+$`).WithRule("may only contain digits")
+
+	tests := []struct {
+		name      string
+		validator Checker
+		input     string
+		wantRule  string
+	}{
+		{"all passes", All(length, lower), "abc", ""},
+		{"all reports first failure", All(length, lower), "abcdefg", "must be between 1 and 5 characters long"},
+		{"all reports second failure", All(length, lower), "ab1", "may only contain lowercase letters"},
+		{"any passes", Any(lower, digits), "123", ""},
+		{"any reports alternatives", Any(lower, digits), "a1", "may only contain lowercase letters or may only contain digits"},
+		{"not passes", Not(digits, "must not be numeric"), "abc", ""},
+		{"not fails", Not(digits, "must not be numeric"), "123", "must not be numeric"},
+		{"empty all passes", All(), "anything", ""},
+		{"plain validator passes", All(plainValidator{}), "abc", ""},
+		{"plain validator fails", All(length, plainValidator{}), "ABC", "is not allowed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.validator.Check(tt.input)
+			if tt.wantRule == "" {
+				if err != nil || !tt.validator.Validate(tt.input) {
+					t.Errorf("expected %q to pass, got %v", tt.input, err)
+				}
+				return
+			}
+
+			verr, ok := err.(*ValidationError)
+			if !ok {
+				t.Fatalf("expected *ValidationError, got %v", err)
+			}
+			if verr.Rule != tt.wantRule || verr.Input != tt.input {
+				t.Errorf("expected rule %q for %q, got %q for %q", tt.wantRule, tt.input, verr.Rule, verr.Input)
+			}
+			if tt.validator.Validate(tt.input) {
+				t.Errorf("expected Validate(%q) to be false", tt.input)
+			}
+		})
+	}
+}
+
+// plainValidator implements Validator without Check, as validators outside this package may
+type plainValidator struct{}
+
+func (plainValidator) Validate(input string) bool {
+	return strings.ToLower(input) == input
+}
+
+func TestValidationErrorMessage(t *testing.T) {
+	err := NewLengthValidator(1, 3).Check("toolong")
+	want := "The toolong is invalid: must be between 1 and 3 characters long."
+	if err == nil || err.Error() != want {
+		t.Errorf("expected %q, got %v", want, err)
+	}
+}
+
+func TestAnyWithoutValidators(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected Any() without validators to panic")
+		}
+	}()
+	Any()
+}